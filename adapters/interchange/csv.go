@@ -0,0 +1,59 @@
+package interchange
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Write_csv writes a flat stitch list - one row per command with the absolute needle position and
+// the thread of its block. Positions are in mm when the payload scale is known, otherwise in
+// payload units
+func Write_csv(w io.Writer, p *shared.Payload) error {
+	cw := csv.NewWriter(w)
+	scale := p.Scale
+	xh, yh := "x_mm", "y_mm"
+	if scale <= 0 {
+		scale = 1
+		xh, yh = "x", "y"
+	}
+	err := cw.Write([]string{"index", "command", "command2", xh, yh, "color", "thread"})
+	if err != nil {
+		return err
+	}
+
+	pos := p.Positions()
+	blk := 0
+	for i, c := range p.Cmds {
+		for blk < len(p.Blocks)-1 && i >= p.Blocks[blk].End {
+			blk++
+		}
+		col, thread := "", ""
+		if blk < len(p.Blocks) {
+			t := p.Blocks[blk].Thread
+			col = shared.Hex(t.Color)
+			thread = strings.TrimSpace(strings.Join([]string{t.Brand, t.Code, t.Name}, " "))
+		}
+		cmd2 := ""
+		if c.Command2 != 0 {
+			cmd2 = shared.CommandName(c.Command2)
+		}
+		err = cw.Write([]string{
+			strconv.Itoa(i),
+			shared.CommandName(c.Command1),
+			cmd2,
+			strconv.FormatFloat(float64(pos[i].X/scale), 'f', 2, 32),
+			strconv.FormatFloat(float64(pos[i].Y/scale), 'f', 2, 32),
+			col,
+			thread,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
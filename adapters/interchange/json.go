@@ -0,0 +1,303 @@
+/*
+** interchange adapter
+** lossless JSON and flat CSV representations of a payload for debugging, diffing and other tools
+**
+** JSON schema (version 2):
+**
+**	{
+**	  "format":       "emblib-payload",   always this string
+**	  "version":      2,
+**	  "title":        string,
+**	  "path":         string,             image path from the pes header
+**	  "head":         string,             pec label
+**	  "width":        number,             payload units
+**	  "height":       number,             payload units
+**	  "scale":        number,             payload units per mm
+**	  "rotation":     integer,
+**	  "background":   "#rrggbb[aa]",      omitted when unset
+**	  "desc":         {string: string},   pes description block - Design, Category, Author, Keywords, Comments
+**	  "hoop":         {"name": string, "width": number, "height": number, "frame": number},
+**	                                      mm, omitted when the file does not say
+**	  "blocks":       [{"hex": "#rrggbb[aa]", "brand": string, "code": string, "name": string,
+**	                    "chart": string, "start": int, "end": int, "needle": int}],
+**	  "commands":     [{"c1": int, "c2": int, "dx": number, "dy": number, "color": int}]
+**	}
+**
+** Colors carry an alpha byte only when they are not opaque. Block start and end are command
+** indexes and are informational - blocks are rebuilt from the color changes on reading. Command
+** values are the shared constants: 0 none, 1 Stitch, 2 Jump, 3 Trim, 4 ColorChg, 5 End. Zero
+** valued command fields are omitted. dx and dy are relative moves exactly as decoded and the color
+** of a color change is the block it starts.
+**
+** Data a reader keeps only so the same format can be written back byte for byte (Payload.Ext) is
+** not part of the document. A design read from json is written from its commands and metadata, so
+** a pes or jef that goes through json is equivalent to the original but not the same bytes.
+**
+** Version 1 documents had "palette_type" and a "palette" of {"hex", "name"} indexed by the color of
+** each color change. They are still read.
+ */
+
+package interchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Format identifies an emblib json document
+const (
+	Format  = "emblib-payload"
+	Version = 2
+)
+
+// json_color is a version 1 palette entry
+type json_color struct {
+	Hex  string `json:"hex"`
+	Name string `json:"name,omitempty"`
+}
+
+// json_block is a color block and its thread
+type json_block struct {
+	Hex    string `json:"hex"`
+	Brand  string `json:"brand,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Chart  string `json:"chart,omitempty"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Needle int    `json:"needle,omitempty"`
+}
+
+// json_hoop is the hoop a design is sewn in
+type json_hoop struct {
+	Name   string  `json:"name,omitempty"`
+	Width  float32 `json:"width"`
+	Height float32 `json:"height"`
+	Frame  float32 `json:"frame,omitempty"`
+}
+
+// json_cmd is a single command
+type json_cmd struct {
+	C1    int     `json:"c1,omitempty"`
+	C2    int     `json:"c2,omitempty"`
+	Dx    float32 `json:"dx,omitempty"`
+	Dy    float32 `json:"dy,omitempty"`
+	Color int     `json:"color,omitempty"`
+}
+
+// json_payload is the document layout
+type json_payload struct {
+	Format      string            `json:"format"`
+	Version     int               `json:"version"`
+	Title       string            `json:"title"`
+	Path        string            `json:"path"`
+	Head        string            `json:"head"`
+	Width       float32           `json:"width"`
+	Height      float32           `json:"height"`
+	Scale       float32           `json:"scale"`
+	Rot         uint16            `json:"rotation"`
+	BG          string            `json:"background,omitempty"`
+	Desc        map[string]string `json:"desc"`
+	Hoop        *json_hoop        `json:"hoop,omitempty"`
+	PaletteType bool              `json:"palette_type,omitempty"` // version 1
+	Palette     []json_color      `json:"palette,omitempty"`      // version 1
+	Blocks      []json_block      `json:"blocks"`
+	Cmds        []json_cmd        `json:"commands,omitempty"` // written by write_cmds
+}
+
+// hex_rgba writes a color as #rrggbb, adding the alpha byte when it is not opaque
+func hex_rgba(c color.Color) string {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	if rgba.A == 255 {
+		return shared.Hex(rgba)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", rgba.R, rgba.G, rgba.B, rgba.A)
+}
+
+// parse_hex reads a color written by hex_rgba
+func parse_hex(s string) (color.Color, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) != 6 && len(h) != 8 {
+		return nil, fmt.Errorf("bad color %q", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad color %q", s)
+	}
+	if len(h) == 6 {
+		return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+	}
+	return color.RGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// Write_json writes the payload as an indented json document
+func Write_json(w io.Writer, p *shared.Payload) error {
+	doc := json_payload{
+		Format:  Format,
+		Version: Version,
+		Title:   p.Title,
+		Path:    p.Path,
+		Head:    p.Head,
+		Width:   p.Width,
+		Height:  p.Height,
+		Scale:   p.Scale,
+		Rot:     p.Rot,
+		Desc:    p.Desc,
+		Blocks:  []json_block{},
+	}
+	if p.BG != nil {
+		doc.BG = hex_rgba(p.BG)
+	}
+	if p.Hoop != (shared.Hoop{}) {
+		h := p.Hoop
+		doc.Hoop = &json_hoop{Name: h.Name, Width: h.Width, Height: h.Height, Frame: h.Frame}
+	}
+	for _, b := range p.Blocks {
+		t := b.Thread
+		doc.Blocks = append(doc.Blocks, json_block{
+			Hex:    hex_rgba(t.Color),
+			Brand:  t.Brand,
+			Code:   t.Code,
+			Name:   t.Name,
+			Chart:  t.Chart,
+			Start:  b.Start,
+			End:    b.End,
+			Needle: b.Needle,
+		})
+	}
+
+	// commands are written one per line after the rest of the document so that documents diff
+	// nicely. MarshalIndent always closes an object with a newline and brace on the end
+	head, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	head = bytes.TrimSuffix(head, []byte("\n}"))
+	if _, err = fmt.Fprintf(w, "%s,\n  \"commands\": ", head); err != nil {
+		return err
+	}
+	if err = write_cmds(w, p.Cmds); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n}\n")
+	return err
+}
+
+// write_cmds streams the commands as a json array with one command per line
+func write_cmds(w io.Writer, cmds []shared.PCommand) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	for i, c := range cmds {
+		line, err := json.Marshal(json_cmd{C1: c.Command1, C2: c.Command2, Dx: c.Dx, Dy: c.Dy, Color: c.Color})
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n    ")
+		bw.Write(line)
+	}
+	bw.WriteString("\n  ]")
+	return bw.Flush()
+}
+
+// Read_json reads a payload written by Write_json
+func Read_json(r io.Reader) (*shared.Payload, error) {
+	var doc json_payload
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Format != Format {
+		return nil, fmt.Errorf("not an emblib payload: format %q", doc.Format)
+	}
+	if doc.Version > Version {
+		return nil, fmt.Errorf("unsupported payload version %d", doc.Version)
+	}
+	pay := shared.Payload{
+		Width:  doc.Width,
+		Height: doc.Height,
+		Scale:  doc.Scale,
+		Rot:    doc.Rot,
+		Desc:   doc.Desc,
+		Title:  doc.Title,
+		Path:   doc.Path,
+		Head:   doc.Head,
+		Cmds:   make([]shared.PCommand, len(doc.Cmds)),
+	}
+	if doc.BG != "" {
+		pay.BG, err = parse_hex(doc.BG)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if h := doc.Hoop; h != nil {
+		pay.Hoop = shared.Hoop{Name: h.Name, Width: h.Width, Height: h.Height, Frame: h.Frame}
+	}
+	for i, c := range doc.Cmds {
+		pay.Cmds[i] = shared.PCommand{Command1: c.C1, Command2: c.C2, Dx: c.Dx, Dy: c.Dy, Color: c.Color}
+	}
+
+	var threads []shared.Thread
+	if doc.Version < 2 {
+		threads, err = palette_threads(doc.Palette, pay.Cmds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range doc.Blocks {
+		col, err := parse_hex(b.Hex)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, shared.Thread{Color: col, Brand: b.Brand, Code: b.Code, Name: b.Name, Chart: b.Chart})
+	}
+	pay.SetBlocks(threads)
+	for i := range pay.Blocks {
+		if i < len(doc.Blocks) {
+			pay.Blocks[i].Needle = doc.Blocks[i].Needle
+		}
+	}
+	return &pay, nil
+}
+
+// palette_threads works out the thread of each block of a version 1 document where the color of
+// a color change indexed the palette
+func palette_threads(palette []json_color, cmds []shared.PCommand) ([]shared.Thread, error) {
+	var cols []color.Color
+	for _, c := range palette {
+		col, err := parse_hex(c.Hex)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	idx := []int{0}
+	for i, c := range cmds {
+		switch {
+		case c.Command1 != shared.ColorChg:
+		case i == 0:
+			idx[0] = c.Color
+		default:
+			idx = append(idx, c.Color)
+		}
+	}
+	var threads []shared.Thread
+	for _, i := range idx {
+		t := shared.Thread{Color: color.Black}
+		if i >= 0 && i < len(cols) {
+			t = shared.Thread{Color: cols[i], Name: palette[i].Name}
+		}
+		threads = append(threads, t)
+	}
+	return threads, nil
+}
@@ -0,0 +1,86 @@
+package interchange
+
+import (
+	"bytes"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// sample builds a small two color design with every field of the document set
+func sample() *shared.Payload {
+	p := &shared.Payload{
+		Width: 200, Height: 100, Scale: 10, Rot: 90,
+		Desc:  map[string]string{"Design": "sample", "Author": "me"},
+		Title: "sample", Path: `C:\designs\sample.pes`, Head: "LA:sample",
+		BG:   color.RGBA{0x20, 0x30, 0x40, 0x80},
+		Hoop: shared.Hoop{Name: "SA432", Width: 130, Height: 180, Frame: 12.5},
+		Cmds: []shared.PCommand{
+			{Command1: shared.Jump, Dx: 10, Dy: 10},
+			{Command1: shared.Stitch, Dx: 20.5, Dy: -3},
+			{Command1: shared.Trim, Command2: shared.Trim},
+			{Command1: shared.ColorChg, Color: 1},
+			{Command1: shared.Stitch, Dx: -7, Dy: 40},
+			{Command1: shared.End},
+		},
+	}
+	p.SetBlocks([]shared.Thread{
+		{Color: color.RGBA{255, 0, 0, 255}, Brand: "Isacord", Code: "1902", Name: "Poinsettia", Chart: "Isacord 40"},
+		{Color: color.RGBA{0, 0, 255, 255}, Name: "Blue"},
+	})
+	p.Blocks[1].Needle = 3
+	return p
+}
+
+// round_trip writes p as json and reads it back
+func round_trip(t *testing.T, p *shared.Payload) (*shared.Payload, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write_json(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+	q, err := Read_json(&buf)
+	if err != nil {
+		t.Fatalf("%v reading\n%s", err, doc)
+	}
+	return q, doc
+}
+
+func TestJsonRoundTrip(t *testing.T) {
+	p := sample()
+	q, doc := round_trip(t, p)
+	if !strings.Contains(doc, `"hoop": {`) {
+		t.Errorf("no hoop in\n%s", doc)
+	}
+	if q.Hoop != p.Hoop {
+		t.Errorf("hoop %+v, want %+v", q.Hoop, p.Hoop)
+	}
+	if !reflect.DeepEqual(q, p) {
+		t.Errorf("read back\n%+v\nwant\n%+v", q, p)
+	}
+
+	// a design without a hoop has none in the document and none read back
+	p.Hoop = shared.Hoop{}
+	q, doc = round_trip(t, p)
+	if strings.Contains(doc, `"hoop"`) || q.Hoop != (shared.Hoop{}) {
+		t.Errorf("hoop %+v from\n%s", q.Hoop, doc)
+	}
+}
+
+func TestJsonReject(t *testing.T) {
+	for _, doc := range []string{
+		`{"format": "other", "version": 2}`,
+		`{"format": "emblib-payload", "version": 3}`,
+		`{"format": "emblib-payload", "version": 2, "blocks": [{"hex": "red"}]}`,
+		`{"format": "emblib-payload", "version": 2, "hoop": {"width": "wide"}}`,
+		`{"format":`,
+	} {
+		if _, err := Read_json(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
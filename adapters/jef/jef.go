@@ -9,16 +9,54 @@ package jef
 import (
 	"encoding/binary"
 	"fmt"
-	"image/color"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 
 	"github.com/emblib/adapters/shared"
+	"github.com/emblib/threads"
 )
 
-var fh *os.File = os.Stdout
-var expand float32 = 0.5 // Expand: Size of resulting image is dependent on a specific machine
-// this is a fudge factor to ensure the image fits
+// ReadOptions controls Read_jef
+type ReadOptions struct {
+	Scale float32        // payload units per mm, 0 for 5
+	Chart *threads.Chart // chart the thread codes are looked up in, nil for Janome
+	Log   io.Writer      // notes about anything odd in the file, nil for none
+}
+
+// DefaultReadOptions returns 5 units per mm, the Janome chart and no notes
+func DefaultReadOptions() ReadOptions {
+	return ReadOptions{
+		Scale: 5.0,
+		Chart: nil,
+		Log:   nil,
+	}
+}
+
+// WriteOptions controls Encode_jef and Write_jef
+type WriteOptions struct {
+	Scale float32        // payload units per mm of payloads that do not say, 0 for 5
+	Chart *threads.Chart // chart the threads are matched to, nil for Janome
+	Log   io.Writer      // notes about what was rewritten, nil for none
+}
+
+// DefaultWriteOptions returns 5 units per mm, the Janome chart and no notes
+func DefaultWriteOptions() WriteOptions {
+	return WriteOptions{
+		Scale: 5.0,
+		Chart: nil,
+		Log:   nil,
+	}
+}
+
+// scale returns the units per mm to use - s or the default when s is not set
+func scale(s float32) float32 {
+	if s <= 0 {
+		return DefaultReadOptions().Scale
+	}
+	return s
+}
 
 // Masks that do bitwise operations to help parse stitches
 const (
@@ -48,6 +86,8 @@ type Jef_header struct {
 	Pad3    []uint32 // padding inset from hoop 140x200 edge (4 values)
 	Pad4    []uint32 // padding inset from custom hoop edge (4 values)
 	ClrChg  []uint32 // color changes
+	Types   []uint32 // thread type of each color
+	raw     []byte   // bytes this was parsed from
 	count   uint32   // bytes in struct
 }
 
@@ -91,24 +131,19 @@ func (s *Jef_header) Parse(bin []byte) {
 		count += 4
 	}
 
-	// read colours (u32) until we get to 0x0d
-	var clr uint32
-	for {
-		clr = binary.LittleEndian.Uint32(bin[count : count+4])
+	// the color list is followed by a thread type for each color - normally 0x0d
+	s.ClrChg = make([]uint32, s.ClrCnt)
+	for i := range s.ClrChg {
+		s.ClrChg[i] = binary.LittleEndian.Uint32(bin[count : count+4])
 		count += 4
-		if clr == clr_end_mask {
-			break
-		}
-		s.ClrChg = append(s.ClrChg, clr)
 	}
-	for {
-		clr = binary.LittleEndian.Uint32(bin[count : count+4])
-		if clr != clr_end_mask {
-			break
-		}
+	s.Types = make([]uint32, s.ClrCnt)
+	for i := range s.Types {
+		s.Types[i] = binary.LittleEndian.Uint32(bin[count : count+4])
 		count += 4
 	}
 	s.count = count
+	s.raw = bin[:count]
 } // Parse
 
 // Preamble.SizeOf returns the size in bytes - offset into the file of the byte after the preamble. Always 12 bytes
@@ -116,29 +151,30 @@ func (p Jef_header) SizeOf() uint32 {
 	return p.count
 }
 
-// Dump writes out this Struct
-func (p Jef_header) Dump() {
-	fmt.Fprintf(fh, "Header:\n")
-	fmt.Fprintf(fh, "\tOffset: %d 0x%X\n", p.Offset, p.Offset)
-	fmt.Fprintf(fh, "\tunk1: %d 0x%X\n", p.unk1, p.unk1)
-	fmt.Fprintf(fh, "\tDate: %s\n", p.Date)
-	fmt.Fprintf(fh, "\tVer: %s\n", p.Ver)
-	fmt.Fprintf(fh, "\tunk2: %d 0x%X\n", p.unk2, p.unk2)
-	fmt.Fprintf(fh, "\tColorCnt: %d 0x%X\n", p.ClrCnt, p.ClrCnt)
-	fmt.Fprintf(fh, "\tPtsLen: %d 0x%X\n", p.PtsLen, p.PtsLen)
-	fmt.Fprintf(fh, "\tHoop: %d 0x%X\n", p.Hoop, p.Hoop)
-	fmt.Fprintf(fh, "\tExtends: %X\n", p.Extends)
-	fmt.Fprintf(fh, "\tPad1: %X\n", p.Pad1)
-	fmt.Fprintf(fh, "\tPad2: %X\n", p.Pad2)
-	fmt.Fprintf(fh, "\tPad3: %X\n", p.Pad3)
-	fmt.Fprintf(fh, "\tPad4: %X\n", p.Pad4)
-	fmt.Fprintf(fh, "\tColorChg: %X\n", p.ClrChg)
-
-	fmt.Fprintf(fh, "\tcount: %d 0x%X\n\n", p.count, p.count)
+// Inspect describes the header field by field
+func (p Jef_header) Inspect() *shared.Field {
+	in := shared.NewInspector("Jef_header", p.raw)
+	in.Add("Offset", 4, p.Offset)
+	in.Add("unk1", 4, p.unk1)
+	in.Add("Date", 14, p.Date)
+	in.Add("Ver", 1, p.Ver)
+	in.Add("unk2", 1, p.unk2)
+	in.Add("ColorCnt", 4, p.ClrCnt)
+	in.Add("PtsLen", 4, p.PtsLen)
+	in.Add("Hoop", 4, p.Hoop)
+	in.Add("Extends", 16, p.Extends)
+	in.Add("Pad1", 16, p.Pad1)
+	in.Add("Pad2", 16, p.Pad2)
+	in.Add("Pad3", 16, p.Pad3)
+	in.Add("Pad4", 16, p.Pad4)
+	in.Add("ColorChg", 4*uint32(len(p.ClrChg)), p.ClrChg)
+	in.Add("Types", 4*uint32(len(p.Types)), p.Types)
+	return in.Field()
 }
 
-// read_cmds parses stitches to a list of render engine commands
-func read_cmds(bin []byte, cols []uint32, f func() int) []shared.PCommand {
+// read_cmds parses stitches to a list of render engine commands with unit payload units per 0.1mm.
+// Returns the commands, the offset of each in bin and the bytes used
+func read_cmds(bin []byte, cols []uint32, f func() int, unit float32) ([]shared.PCommand, []int, uint32) {
 
 	// set the initial color
 	var cmd = shared.PCommand{
@@ -146,20 +182,23 @@ func read_cmds(bin []byte, cols []uint32, f func() int) []shared.PCommand {
 		Command2: 0,
 		Dx:       2.0,
 		Dy:       2.0,
-		Color:    int(cols[f()] + 1),
+		Color:    int(cols[f()]),
 	}
 
 	var cmds []shared.PCommand // some file formats have a null first command. Add to make same
 	cmds = append(cmds, cmd)
+	offs := []int{-1} // not in the file
 
 	count := uint32(0)
 FORLOOP:
 	for {
+		start := int(count)
 		b0 := int8(bin[count])
 		count++
 		b1 := int8(bin[count])
 		// end of file is marked by a series of 0xff or -1 at this point
 		if b0 == -1 && b1 == -1 {
+			count++
 			break
 		}
 		count++
@@ -171,16 +210,16 @@ FORLOOP:
 			case 01:
 				//color chg
 				cmd.Command1 = shared.ColorChg
-				cmd.Dx = float32(bin[count]) * expand
+				cmd.Dx = float32(bin[count]) * unit
 				count++
-				cmd.Dy = float32(bin[count]) * expand
+				cmd.Dy = float32(bin[count]) * unit
 				count++
 				cmd.Color = int(cols[f()])
 			case 02:
 				//jmp and trim
-				cmd.Dx = float32(int8(bin[count])) * expand
+				cmd.Dx = float32(int8(bin[count])) * unit
 				count++
-				cmd.Dy = float32(int8(bin[count])*-1) * expand
+				cmd.Dy = float32(int8(bin[count])*-1) * unit
 				count++
 				if cmd.Dx == 0 && cmd.Dy == 0 {
 					cmd.Command1 = shared.Trim
@@ -191,53 +230,60 @@ FORLOOP:
 		} else {
 			// stitch
 			cmd.Command1 = shared.Stitch
-			cmd.Dx = float32(int(b0)) * expand
-			cmd.Dy = float32(int(b1)*-1) * expand
+			cmd.Dx = float32(int(b0)) * unit
+			cmd.Dy = float32(int(b1)*-1) * unit
 		}
 		if cmd.Dx == 0xff && cmd.Dy == 0xff {
 			break
 		}
 		cmds = append(cmds, cmd)
+		offs = append(offs, start)
 	}
-	return cmds
+	return cmds, offs, count
 } // read_cmds()
 
-// decode_jef converts jef header information to useable - currently only width and height
+// Hoops are the janome hoops by their code in the header
+var Hoops = map[uint32]shared.Hoop{
+	0: {Name: "Janome 110 x 110", Width: 110, Height: 110, Frame: 15},
+	1: {Name: "Janome 50 x 50", Width: 50, Height: 50, Frame: 15},
+	2: {Name: "Janome 140 x 200", Width: 140, Height: 200, Frame: 15},
+	3: {Name: "Janome 126 x 110", Width: 126, Height: 110, Frame: 15},
+	4: {Name: "Janome 200 x 200", Width: 200, Height: 200, Frame: 15},
+}
+
+// decode_jef converts jef header information to useable - the hoop, width and height in mm
 func decode_jef(h Jef_header) shared.Payload {
 	var p shared.Payload
+	p.Hoop = Hoops[h.Hoop]
 	// two ways to get the width and height - using the extends or the hoop size
-	// prefer extends
+	// prefer extends, which are in 0.1mm
 	if h.Extends[0] != 0 && h.Extends[2] != 0 && h.Extends[1] != 0 && h.Extends[3] != 0 {
-		p.Width = float32(h.Extends[0] + h.Extends[2])
-		p.Height = float32(h.Extends[1] + h.Extends[3])
+		p.Width = float32(h.Extends[0]+h.Extends[2]) / 10
+		p.Height = float32(h.Extends[1]+h.Extends[3]) / 10
 	} else {
-		switch h.Hoop {
-		case 0:
-			// 110 x 110 mm
-			p.Width = 110
-			p.Height = 110
-		case 1:
-			// 50 x 50 mm
-			p.Width = 50
-			p.Height = 50
-		case 2:
-			// 140 x 200 mm
-			p.Width = 140
-			p.Height = 200
-		case 3:
-			// 126 x 110 mm
-			p.Width = 126
-			p.Height = 110
-		case 4:
-			// 200 x 200 mm
-			p.Width = 200
-			p.Height = 200
-
-		}
+		p.Width = p.Hoop.Width
+		p.Height = p.Hoop.Height
 	}
 	return p
 } // decode_jef
 
+// jef_threads looks up the thread of each block in chart, the janome chart when nil
+func jef_threads(cols []uint32, chart *threads.Chart, log io.Writer) []shared.Thread {
+	if chart == nil {
+		chart = threads.Builtin("Janome")
+	}
+	var l []shared.Thread
+	for _, c := range cols {
+		t, ok := chart.Code(strconv.Itoa(int(c)))
+		if !ok {
+			shared.Logf(log, "thread %d is not in the %s chart", c, chart.Name)
+			t, _ = chart.Code("0") // unknown
+		}
+		l = append(l, t)
+	}
+	return l
+}
+
 // inc factory to produce an incrementing closure
 func inc() func() int {
 	index := -1
@@ -248,11 +294,10 @@ func inc() func() int {
 }
 
 // Read_jef reads a jef file and returns the payload ie what we are interested in
-func Read_jef(file string) *shared.Payload {
+func Read_jef(file string, o ReadOptions) *shared.Payload {
 	var pay shared.Payload
+	unit := scale(o.Scale)
 
-	pay.Title = file
-	
 	// get the actual file contents
 	reader, err := os.Open(file)
 	if err != nil {
@@ -268,12 +313,57 @@ func Read_jef(file string) *shared.Payload {
 	jef.Parse(bin)
 	c := jef.SizeOf()
 	pay = decode_jef(jef)
-	pay.Palette = Janome_select()
+	pay.Title = file
+	if !pay.Hoop.Known() {
+		shared.Logf(o.Log, "%s: unknown hoop code %d", file, jef.Hoop)
+	}
 	f := inc()
-	pay.Cmds = read_cmds(bin[c:], jef.ClrChg, f)
+	var n uint32
+	var offs []int
+	pay.Cmds, offs, n = read_cmds(bin[c:], jef.ClrChg, f, unit/10)
+	for _, off := range offs {
+		if off >= 0 {
+			off += int(c)
+		}
+		pay.Offsets = append(pay.Offsets, off)
+	}
+	pay.SetBlocks(jef_threads(jef.ClrChg, o.Chart, o.Log))
+	pay.Width *= unit
+	pay.Height *= unit
+	pay.Scale = unit // stitches are decoded in mm
+
+	// keep everything we do not model so that Write_jef can reproduce the file
+	pay.Ext = map[string]any{
+		Format: &Extension{
+			Hdr:      jef,
+			Stitches: bin[c : c+n],
+			Trailer:  bin[c+n:],
+			cmds:     slices.Clone(pay.Cmds),
+			threads:  pay.Threads(),
+		},
+	}
 	return &pay
 } // Read_jef
 
+// Inspect_jef describes the layout of a jef file - the header field by field, then the stitch region
+func Inspect_jef(file string) *shared.Field {
+	bin, err := os.ReadFile(file)
+	if err != nil {
+		panic(err)
+	}
+
+	var jef Jef_header
+	jef.Parse(bin)
+	in := shared.NewInspector("jef", bin)
+	in.Sub(jef.Inspect())
+	cmds, _, n := read_cmds(bin[jef.SizeOf():], jef.ClrChg, inc(), DefaultReadOptions().Scale/10)
+	in.Add("Stitches", n, fmt.Sprintf("%d commands", len(cmds)))
+	if rest := uint32(len(bin)) - in.Pos(); rest > 0 {
+		in.Add("Trailer", rest, nil)
+	}
+	return in.Field()
+}
+
 /*
 **
 ** Stitch handling
@@ -296,256 +386,3 @@ func jef_decode_cmd(c int) string {
 	}
 	return "unk"
 } // jef_decode_cmd
-
-// defines for the colors of the standard Janome thread palette
-var (
-	UnknownJf      = color.RGBA{0x0, 0x0, 0x0, 255}
-	BlackJf        = color.RGBA{0x0, 0x0, 0x0, 255}
-	WhiteJf        = color.RGBA{0xFF, 0xFF, 0xFF, 255}
-	Sunflower1Jf   = color.RGBA{0xFF, 0xFF, 0x17, 255}
-	Hazel1Jf       = color.RGBA{0xFA, 0xA0, 0x60, 255}
-	OliveGreenJf   = color.RGBA{0x5C, 0x76, 0x49, 255}
-	GreenJf        = color.RGBA{0x40, 0xC0, 0x30, 255}
-	SkyJf          = color.RGBA{0x65, 0xC2, 0xC8, 255}
-	PurpleJf       = color.RGBA{0xAC, 0x80, 0xBE, 255}
-	PinkJf         = color.RGBA{0xF5, 0xBC, 0xCB, 255}
-	RedJf          = color.RGBA{0xFF, 0x0, 0x0, 255}
-	BrownJf        = color.RGBA{0xC0, 0x80, 0x0, 255}
-	BlueJf         = color.RGBA{0x0, 0x0, 0xF0, 255}
-	GoldJf         = color.RGBA{0xE4, 0xC3, 0x5D, 255}
-	DarkBrownJf    = color.RGBA{0xA5, 0x2A, 0x2A, 255}
-	PaleVioletJf   = color.RGBA{0xD5, 0xB0, 0xD4, 255}
-	PaleYellowJf   = color.RGBA{0xFC, 0xF2, 0x94, 255}
-	PalePinkJf     = color.RGBA{0xF0, 0xD0, 0xC0, 255}
-	PeachJf        = color.RGBA{0xFF, 0xC0, 0x0, 255}
-	Beige1Jf       = color.RGBA{0xC9, 0xA4, 0x80, 255}
-	WineRedJf      = color.RGBA{0x9B, 0x3D, 0x4B, 255}
-	PaleSkyJf      = color.RGBA{0xA0, 0xB8, 0xCC, 255}
-	YellowGreenJf  = color.RGBA{0x7F, 0xC2, 0x1C, 255}
-	SilverGreyJf   = color.RGBA{0xB9, 0xB9, 0xB9, 255}
-	GreyJf         = color.RGBA{0xA0, 0xA0, 0xA0, 255}
-	PaleAquaJf     = color.RGBA{0x98, 0xD6, 0xBD, 255}
-	BabyBlueJf     = color.RGBA{0xB8, 0xF0, 0xF0, 255}
-	PowderBlueJf   = color.RGBA{0x36, 0x8B, 0xA0, 255}
-	BrightBlueJf   = color.RGBA{0x4F, 0x83, 0xAB, 255}
-	SlateBlueJf    = color.RGBA{0x38, 0x6A, 0x91, 255}
-	NaveBlueJf     = color.RGBA{0x0, 0x20, 0x6B, 255}
-	SalmonPinkJf   = color.RGBA{0xE5, 0xC5, 0xCA, 255}
-	CoralJf        = color.RGBA{0xF9, 0x67, 0x6B, 255}
-	BurntOrangeJf  = color.RGBA{0xE3, 0x31, 0x1F, 255}
-	CinnamonJf     = color.RGBA{0xE2, 0xA1, 0x88, 255}
-	UmberJf        = color.RGBA{0xB5, 0x94, 0x74, 255}
-	BlondeJf       = color.RGBA{0xE4, 0xCF, 0x99, 255}
-	Sunflower2Jf   = color.RGBA{0xE1, 0xCB, 0x0, 255}
-	OrchidPinkJf   = color.RGBA{0xE1, 0xAD, 0xD4, 255}
-	PeonyPurpleJf  = color.RGBA{0xC3, 0x0, 0x7E, 255}
-	BurgundyJf     = color.RGBA{0x80, 0x0, 0x4B, 255}
-	RoyalPurple1Jf = color.RGBA{0xA0, 0x60, 0xB0, 255}
-	CardinalRedJf  = color.RGBA{0xC0, 0x40, 0x20, 255}
-	OpalGreenJf    = color.RGBA{0xCA, 0xE0, 0xC0, 255}
-	MossGreenJf    = color.RGBA{0x89, 0x98, 0x56, 255}
-	MeadowGreenJf  = color.RGBA{0x0, 0xAA, 0x0, 255}
-	DarkGreenJf    = color.RGBA{0x21, 0x8A, 0x21, 255}
-	AquamarineJf   = color.RGBA{0x5D, 0xAE, 0x94, 255}
-	EmeraldGreenJf = color.RGBA{0x4C, 0xBF, 0x8F, 255}
-	PeacockGreenJf = color.RGBA{0x0, 0x77, 0x72, 255}
-	DarkGreyJf     = color.RGBA{0x70, 0x70, 0x70, 255}
-	IvoryWhiteJf   = color.RGBA{0xF2, 0xFF, 0xFF, 255}
-	Hazel2Jf       = color.RGBA{0xB1, 0x58, 0x18, 255}
-	Toast1Jf       = color.RGBA{0xCB, 0x8A, 0x7, 255}
-	SalmonJf       = color.RGBA{0xF7, 0x92, 0x7B, 255}
-	CocoaBrownJf   = color.RGBA{0x98, 0x69, 0x2D, 255}
-	SiennaJf       = color.RGBA{0xA2, 0x71, 0x48, 255}
-	Sepia1Jf       = color.RGBA{0x7B, 0x55, 0x4A, 255}
-	DarkSepiaJf    = color.RGBA{0x4F, 0x39, 0x46, 255}
-	VioletBlueJf   = color.RGBA{0x52, 0x3A, 0x97, 255}
-	BlueInkJf      = color.RGBA{0x0, 0x0, 0xA0, 255}
-	SolarBlueJf    = color.RGBA{0x0, 0x96, 0xDE, 255}
-	GreenDustJf    = color.RGBA{0xB2, 0xDD, 0x53, 255}
-	CrimsonJf      = color.RGBA{0xFA, 0x8F, 0xBB, 255}
-	FloralPinkJf   = color.RGBA{0xDE, 0x64, 0x9E, 255}
-	WineJf         = color.RGBA{0xB5, 0x50, 0x66, 255}
-	OliveDrabJf    = color.RGBA{0x5E, 0x57, 0x47, 255}
-	MeadowJf       = color.RGBA{0x4C, 0x88, 0x1F, 255}
-	CanaryYellowJf = color.RGBA{0xE4, 0xDC, 0x79, 255}
-	Toast2Jf       = color.RGBA{0xCB, 0x8A, 0x1A, 255}
-	Beige2Jf       = color.RGBA{0xC6, 0xAA, 0x42, 255}
-	HoneyDewJf     = color.RGBA{0xEC, 0xB0, 0x2C, 255}
-	TangerineJf    = color.RGBA{0xF8, 0x80, 0x40, 255}
-	OceanBlueJf    = color.RGBA{0xFF, 0xE5, 0x5, 255}
-	Sepia2Jf       = color.RGBA{0xFA, 0x7A, 0x7A, 255}
-	RoyalPurple2Jf = color.RGBA{0x6B, 0xE0, 0x0, 255}
-	YellowOcherJf  = color.RGBA{0x38, 0x6C, 0xAE, 255}
-	BeigeGreyJf    = color.RGBA{0xD0, 0xBA, 0xB0, 255}
-	BambooJf       = color.RGBA{0xE3, 0xBE, 0x81, 255}
-) // var
-
-// Janome_set returns a map of the Janome thread palette indexed by name to color
-func Janome_set() *map[string]color.Color {
-	return &map[string]color.Color{
-		"Jf_Unknown":      UnknownJf,
-		"Jf_Black":        BlackJf,
-		"Jf_White":        WhiteJf,
-		"Jf_Sunflower1":   Sunflower1Jf,
-		"Jf_Hazel1":       Hazel1Jf,
-		"Jf_OliveGreen":   OliveGreenJf,
-		"Jf_Green":        GreenJf,
-		"Jf_Sky":          SkyJf,
-		"Jf_Purple":       PurpleJf,
-		"Jf_Pink":         PinkJf,
-		"Jf_Red":          RedJf,
-		"Jf_Brown":        BrownJf,
-		"Jf_Blue":         BlueJf,
-		"Jf_Gold":         GoldJf,
-		"Jf_DarkBrown":    DarkBrownJf,
-		"Jf_PaleViolet":   PaleVioletJf,
-		"Jf_PaleYellow":   PaleYellowJf,
-		"Jf_PalePink":     PalePinkJf,
-		"Jf_Peach":        PeachJf,
-		"Jf_Beige1":       Beige1Jf,
-		"Jf_WineRed":      WineRedJf,
-		"Jf_PaleSky":      PaleSkyJf,
-		"Jf_YellowGreen":  YellowGreenJf,
-		"Jf_SilverGrey":   SilverGreyJf,
-		"Jf_Grey":         GreyJf,
-		"Jf_PaleAqua":     PaleAquaJf,
-		"Jf_BabyBlue":     BabyBlueJf,
-		"Jf_PowderBlue":   PowderBlueJf,
-		"Jf_BrightBlue":   BrightBlueJf,
-		"Jf_SlateBlue":    SlateBlueJf,
-		"Jf_NaveBlue":     NaveBlueJf,
-		"Jf_SalmonPink":   SalmonPinkJf,
-		"Jf_Coral":        CoralJf,
-		"Jf_BurntOrange":  BurntOrangeJf,
-		"Jf_Cinnamon":     CinnamonJf,
-		"Jf_Umber":        UmberJf,
-		"Jf_Blonde":       BlondeJf,
-		"Jf_Sunflower2":   Sunflower2Jf,
-		"Jf_OrchidPink":   OrchidPinkJf,
-		"Jf_PeonyPurple":  PeonyPurpleJf,
-		"Jf_Burgundy":     BurgundyJf,
-		"Jf_RoyalPurple1": RoyalPurple1Jf,
-		"Jf_CardinalRed":  CardinalRedJf,
-		"Jf_OpalGreen":    OpalGreenJf,
-		"Jf_MossGreen":    MossGreenJf,
-		"Jf_MeadowGreen":  MeadowGreenJf,
-		"Jf_DarkGreen":    DarkGreenJf,
-		"Jf_Aquamarine":   AquamarineJf,
-		"Jf_EmeraldGreen": EmeraldGreenJf,
-		"Jf_PeacockGreen": PeacockGreenJf,
-		"Jf_DarkGrey":     DarkGreyJf,
-		"Jf_IvoryWhite":   IvoryWhiteJf,
-		"Jf_Hazel2":       Hazel2Jf,
-		"Jf_Toast1":       Toast1Jf,
-		"Jf_Salmon":       SalmonJf,
-		"Jf_CocoaBrown":   CocoaBrownJf,
-		"Jf_Sienna":       SiennaJf,
-		"Jf_Sepia1":       Sepia1Jf,
-		"Jf_DarkSepia":    DarkSepiaJf,
-		"Jf_VioletBlue":   VioletBlueJf,
-		"Jf_BlueInk":      BlueInkJf,
-		"Jf_SolarBlue":    SolarBlueJf,
-		"Jf_GreenDust":    GreenDustJf,
-		"Jf_Crimson":      CrimsonJf,
-		"Jf_FloralPink":   FloralPinkJf,
-		"Jf_Wine":         WineJf,
-		"Jf_OliveDrab":    OliveDrabJf,
-		"Jf_Meadow":       MeadowJf,
-		"Jf_CanaryYellow": CanaryYellowJf,
-		"Jf_Toast2":       Toast2Jf,
-		"Jf_Beige2":       Beige2Jf,
-		"Jf_HoneyDew":     HoneyDewJf,
-		"Jf_Tangerine":    TangerineJf,
-		"Jf_OceanBlue":    OceanBlueJf,
-		"Jf_Sepia2":       Sepia2Jf,
-		"Jf_RoyalPurple2": RoyalPurple2Jf,
-		"Jf_YellowOcher":  YellowOcherJf,
-		"Jf_BeigeGrey":    BeigeGreyJf,
-		"Jf_Bamboo":       BambooJf,
-	}
-} // Janome_set
-
-// Janome_select returns an array in index order of the Janome thread palette
-func Janome_select() []color.Color {
-	return []color.Color{
-		UnknownJf,
-		BlackJf,
-		WhiteJf,
-		Sunflower1Jf,
-		Hazel1Jf,
-		OliveGreenJf,
-		GreenJf,
-		SkyJf,
-		PurpleJf,
-		PinkJf,
-		RedJf,
-		BrownJf,
-		BlueJf,
-		GoldJf,
-		DarkBrownJf,
-		PaleVioletJf,
-		PaleYellowJf,
-		PalePinkJf,
-		PeachJf,
-		Beige1Jf,
-		WineRedJf,
-		PaleSkyJf,
-		YellowGreenJf,
-		SilverGreyJf,
-		GreyJf,
-		PaleAquaJf,
-		BabyBlueJf,
-		PowderBlueJf,
-		BrightBlueJf,
-		SlateBlueJf,
-		NaveBlueJf,
-		SalmonPinkJf,
-		CoralJf,
-		BurntOrangeJf,
-		CinnamonJf,
-		UmberJf,
-		BlondeJf,
-		Sunflower2Jf,
-		OrchidPinkJf,
-		PeonyPurpleJf,
-		BurgundyJf,
-		RoyalPurple1Jf,
-		CardinalRedJf,
-		OpalGreenJf,
-		MossGreenJf,
-		MeadowGreenJf,
-		DarkGreenJf,
-		AquamarineJf,
-		EmeraldGreenJf,
-		PeacockGreenJf,
-		DarkGreyJf,
-		IvoryWhiteJf,
-		Hazel2Jf,
-		Toast1Jf,
-		SalmonJf,
-		CocoaBrownJf,
-		SiennaJf,
-		Sepia1Jf,
-		DarkSepiaJf,
-		VioletBlueJf,
-		BlueInkJf,
-		SolarBlueJf,
-		GreenDustJf,
-		CrimsonJf,
-		FloralPinkJf,
-		WineJf,
-		OliveDrabJf,
-		MeadowJf,
-		CanaryYellowJf,
-		Toast2Jf,
-		Beige2Jf,
-		HoneyDewJf,
-		TangerineJf,
-		OceanBlueJf,
-		Sepia2Jf,
-		RoyalPurple2Jf,
-		YellowOcherJf,
-		BeigeGreyJf,
-		BambooJf,
-	}
-} // Janome_select
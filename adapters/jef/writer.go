@@ -0,0 +1,268 @@
+/*
+** jef writer
+** serialises a payload back to a jef file. The header fields the reader does not use and any
+** bytes after the end of the stitches travel with the payload as an Extension so an unedited
+** payload is written back byte for byte
+ */
+
+package jef
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/threads"
+)
+
+// Format is the key of the jef extension in Payload.Ext
+const Format = "jef"
+
+// Extension keeps the parts of a jef file the payload does not model
+type Extension struct {
+	Hdr      Jef_header // header including unknown fields
+	Stitches []byte     // encoded stitches as read - reused while the commands are unchanged
+	Trailer  []byte     // anything after the end of the stitches
+	cmds     []shared.PCommand
+	threads  []shared.Thread
+}
+
+var le = binary.LittleEndian
+
+// hoop sizes in 0.1mm in the order of the padding blocks of the header
+var pad_hoops = [4][2]int{{1100, 1100}, {500, 500}, {1400, 2000}, {2000, 2000}}
+
+// Jef_header.Bytes serialises the header - the inverse of Parse
+func (s Jef_header) Bytes() []byte {
+	b := le.AppendUint32(nil, s.Offset)
+	b = le.AppendUint32(b, s.unk1)
+	b = append(b, (s.Date + strings.Repeat("0", 14))[:14]...)
+	b = append(b, (s.Ver + "\x00")[:1]...)
+	b = append(b, s.unk2)
+	b = le.AppendUint32(b, s.ClrCnt)
+	b = le.AppendUint32(b, s.PtsLen)
+	b = le.AppendUint32(b, s.Hoop)
+	for _, l := range [][]uint32{s.Extends, s.Pad1, s.Pad2, s.Pad3, s.Pad4, s.ClrChg, s.Types} {
+		for _, v := range l {
+			b = le.AppendUint32(b, v)
+		}
+	}
+	return b
+}
+
+// set_extents records the bounds of the stitches and the padding they leave in each hoop
+func (s *Jef_header) set_extents(minx, miny, maxx, maxy int) {
+	ext := []int{-minx, -miny, maxx, maxy}
+	s.Extends = make([]uint32, 4)
+	for i := range ext {
+		s.Extends[i] = uint32(int32(ext[i]))
+	}
+	pads := make([][]uint32, 4)
+	for h, sz := range pad_hoops {
+		pads[h] = make([]uint32, 4)
+		for i := range ext {
+			pads[h][i] = uint32(int32(sz[i%2]/2 - ext[i]))
+		}
+	}
+	s.Pad1, s.Pad2, s.Pad3, s.Pad4 = pads[0], pads[1], pads[2], pads[3]
+}
+
+/*
+**
+** Stitch encoding - the inverse of read_cmds
+**
+ */
+
+// encode_cmds converts commands to jef stitches. unit is payload units per 0.1mm. Moves are
+// rounded on the absolute needle position so that long designs do not drift
+func encode_cmds(cmds []shared.PCommand, unit float32) []byte {
+	var b []byte
+	var ax, ay float32 // needle position in payload units
+	var ix, iy int     // needle position as written
+	for i, c := range cmds {
+		switch c.Command1 {
+		case shared.End:
+			return append(b, 0x80, 0x10)
+		case shared.ColorChg:
+			// the first block's color is in the header
+			if i > 0 {
+				b = append(b, 0x80, 0x01, 0, 0)
+			}
+			continue
+		}
+		ax += c.Dx
+		ay += c.Dy
+		dx := int(math.Round(float64(ax/unit))) - ix
+		dy := int(math.Round(float64(ay/unit))) - iy
+		ix += dx
+		iy += dy
+
+		// moves are single bytes so long ones are split. A stitch only goes into the fabric at its
+		// end so the pieces before are jumps. y is stored upwards
+		n := max(1, int(math.Ceil(float64(max(abs(dx), abs(dy)))/127)))
+		for k := 1; k <= n; k++ {
+			sx := dx*k/n - dx*(k-1)/n
+			sy := dy*k/n - dy*(k-1)/n
+			switch {
+			case c.Command1 == shared.Jump || c.Command1 == shared.Trim || k < n:
+				if sx != 0 || sy != 0 { // a jump of nothing reads as a trim
+					b = append(b, 0x80, 0x02, byte(sx), byte(-sy))
+				}
+			case sx == -1 && sy == 1:
+				// ff ff marks the end of a file
+				b = append(b, byte(sx), 0, 0, byte(-sy))
+			default:
+				b = append(b, byte(sx), byte(-sy))
+			}
+		}
+		if c.Command1 == shared.Trim {
+			b = append(b, 0x80, 0x02, 0, 0)
+		}
+	}
+	return append(b, 0x80, 0x10)
+}
+
+// abs of an int
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+/*
+**
+** Writing
+**
+ */
+
+// janome_indices maps the thread of each block to the janome palette of chart, the janome chart
+// when nil. A thread from the chart keeps its code, any other thread takes the nearest by color
+// leaving out the unknown thread 0
+func janome_indices(p *shared.Payload, chart *threads.Chart, log io.Writer) []uint32 {
+	if chart == nil {
+		chart = threads.Builtin("Janome")
+	}
+	known := &threads.Chart{
+		Name:  chart.Name,
+		Brand: chart.Brand,
+		Threads: slices.DeleteFunc(slices.Clone(chart.Threads), func(t shared.Thread) bool {
+			return t.Code == "0"
+		}),
+	}
+	var idx []uint32
+	for _, b := range p.Blocks {
+		t, ok := chart.Code(b.Thread.Code)
+		if !ok || !strings.EqualFold(b.Thread.Chart, chart.Name) {
+			t, _ = known.Nearest(b.Thread.Color)
+		}
+		n, err := strconv.Atoi(t.Code)
+		if err != nil || n < 0 {
+			shared.Logf(log, "thread %q of the %s chart is not a janome color - using 0", t.Code, chart.Name)
+			n = 0
+		}
+		idx = append(idx, uint32(n))
+	}
+	return idx
+}
+
+// extents returns the bounds of the stitches in 0.1mm
+func extents(p *shared.Payload, unit float32) (minx, miny, maxx, maxy int) {
+	for _, pt := range p.Positions() {
+		x := int(math.Round(float64(pt.X / unit)))
+		y := int(math.Round(float64(pt.Y / unit)))
+		minx = min(minx, x)
+		miny = min(miny, y)
+		maxx = max(maxx, x)
+		maxy = max(maxy, y)
+	}
+	return
+}
+
+// new_extension describes a jef header for payloads that were not read from one
+func new_extension(p *shared.Payload, unit float32) *Extension {
+	var ext Extension
+	ext.Hdr.unk1 = 0x14
+	ext.Hdr.Date = time.Now().Format("20060102150405")
+	ext.Hdr.Ver = "\x00"
+	minx, miny, maxx, maxy := extents(p, unit)
+	w := max(-minx, maxx) * 2
+	h := max(-miny, maxy) * 2
+	switch {
+	case w <= 500 && h <= 500:
+		ext.Hdr.Hoop = 1
+	case w <= 1100 && h <= 1100:
+		ext.Hdr.Hoop = 0
+	case w <= 1400 && h <= 2000:
+		ext.Hdr.Hoop = 2
+	default:
+		ext.Hdr.Hoop = 4
+	}
+	ext.Hdr.set_extents(minx, miny, maxx, maxy)
+	return &ext
+}
+
+// Encode_jef serialises a payload as a jef file. A payload read by Read_jef keeps the original
+// header and trailer - only the threads, the extents and the stitches are rewritten and only
+// when they were changed
+func Encode_jef(p *shared.Payload, o WriteOptions) []byte {
+	unit := p.Scale / 10
+	if unit <= 0 {
+		unit = scale(o.Scale) / 10
+	}
+	// make sure the blocks follow the color changes
+	ts := p.Threads()
+	p = p.Clone()
+	p.SetBlocks(ts)
+
+	ext, _ := p.Ext[Format].(*Extension)
+	if ext == nil {
+		shared.Logf(o.Log, "not read from a jef file - writing a new header")
+		ext = new_extension(p, unit)
+	}
+	hdr := ext.Hdr
+	edited := !slices.Equal(p.Cmds, ext.cmds)
+	recolored := !slices.Equal(p.Threads(), ext.threads)
+
+	if edited || recolored {
+		hdr.ClrChg = janome_indices(p, o.Chart, o.Log)
+		hdr.ClrCnt = uint32(len(hdr.ClrChg))
+		types := make([]uint32, len(hdr.ClrChg))
+		for i := range types {
+			types[i] = clr_end_mask
+			if i < len(ext.Hdr.Types) {
+				types[i] = ext.Hdr.Types[i]
+			}
+		}
+		hdr.Types = types
+	}
+	st := ext.Stitches
+	if edited {
+		shared.Logf(o.Log, "stitches changed - rewriting %d commands", len(p.Cmds))
+		st = encode_cmds(p.Cmds, unit)
+		hdr.PtsLen = uint32(len(st) / 2)
+		hdr.set_extents(extents(p, unit))
+	}
+
+	// the stitches move when the color list changes size
+	if len(ext.Hdr.raw) == 0 {
+		hdr.Offset = uint32(len(hdr.Bytes()))
+	} else {
+		hdr.Offset = uint32(int(hdr.Offset) + len(hdr.Bytes()) - len(ext.Hdr.raw))
+	}
+
+	out := hdr.Bytes()
+	out = append(out, st...)
+	return append(out, ext.Trailer...)
+}
+
+// Write_jef writes a payload to a jef file
+func Write_jef(file string, p *shared.Payload, o WriteOptions) error {
+	return os.WriteFile(file, Encode_jef(p, o), 0644)
+}
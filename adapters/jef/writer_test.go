@@ -0,0 +1,157 @@
+package jef
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/threads"
+)
+
+// Files read and written back unchanged must be the same bytes. The testdata files are laid out
+// by hand from the published jef layout
+func TestRoundTrip(t *testing.T) {
+	files, _ := filepath.Glob("testdata/*.jef")
+	if len(files) == 0 {
+		t.Fatal("no test files")
+	}
+	for _, file := range files {
+		in, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Read_jef(file, DefaultReadOptions())
+		out := Encode_jef(p, DefaultWriteOptions())
+		if !bytes.Equal(in, out) {
+			t.Errorf("%s: wrote %d bytes that differ from the %d read", file, len(out), len(in))
+		}
+	}
+}
+
+// Thread 13 is also the 0x0d thread type word after the color list so it must not end the list
+func TestColors(t *testing.T) {
+	for file, want := range map[string][]string{
+		"testdata/three.jef": {"2", "10", "12"},
+		"testdata/gold.jef":  {"2", "10", "13"},
+	} {
+		p := Read_jef(file, DefaultReadOptions())
+		var got []string
+		for _, t := range p.Threads() {
+			got = append(got, t.Code)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: threads %v, want %v", file, got, want)
+		}
+	}
+}
+
+// The size is in payload units like the stitches, whatever the scale
+func TestScale(t *testing.T) {
+	files, _ := filepath.Glob("testdata/*.jef")
+	for _, file := range files {
+		p := Read_jef(file, DefaultReadOptions())
+		q := Read_jef(file, ReadOptions{Scale: 10})
+		if p.Scale != 5 || q.Scale != 10 {
+			t.Errorf("%s: scales %v and %v", file, p.Scale, q.Scale)
+		}
+		if p.Width <= 0 || q.Width != 2*p.Width || q.Height != 2*p.Height {
+			t.Errorf("%s: %vx%v at 5 units per mm, %vx%v at 10", file, p.Width, p.Height, q.Width, q.Height)
+		}
+		// the extends are measured from the centre so the design fits inside them
+		minx, miny := float32(math.MaxFloat32), float32(math.MaxFloat32)
+		maxx, maxy := -minx, -miny
+		for _, at := range needles(q) {
+			minx, maxx = min(minx, at.X), max(maxx, at.X)
+			miny, maxy = min(miny, at.Y), max(maxy, at.Y)
+		}
+		if maxx-minx > q.Width+1 || maxy-miny > q.Height+1 {
+			t.Errorf("%s: %vx%v design in a %vx%v size", file, maxx-minx, maxy-miny, q.Width, q.Height)
+		}
+	}
+}
+
+// needles returns the needle position of every stitch that goes into the fabric
+func needles(p *shared.Payload) []shared.Point {
+	var l []shared.Point
+	pos := p.Positions()
+	for i, c := range p.Cmds {
+		if c.Command1 == shared.Stitch {
+			l = append(l, pos[i])
+		}
+	}
+	return l
+}
+
+// An edited file keeps the header fields the payload does not model and the bytes after the
+// stitches. The threads and stitches are rewritten and a stitch longer than a jef move becomes
+// jumps and a stitch at its end. Jef has no title or description to edit
+func TestEditedRoundTrip(t *testing.T) {
+	p := Read_jef("testdata/three.jef", DefaultReadOptions())
+	ext := p.Ext[Format].(*Extension)
+	unit := p.Scale / 10 // payload units per 0.1mm
+
+	janome := threads.Builtin("Janome")
+	th, _ := janome.Code("20")
+	p.Blocks[1].Thread = th
+	p.Cmds = slices.Clone(p.Cmds)
+	i := slices.IndexFunc(p.Cmds, func(c shared.PCommand) bool { return c.Command1 == shared.Stitch })
+	p.Cmds[i].Dy -= 15 * unit
+	// 30mm out and back needs three moves each way
+	long := 300 * unit
+	p.Cmds = slices.Insert(p.Cmds, len(p.Cmds)-1,
+		shared.PCommand{Command1: shared.Stitch, Dx: long, Dy: long / 2},
+		shared.PCommand{Command1: shared.Stitch, Dx: -long, Dy: -long / 2})
+
+	file := filepath.Join(t.TempDir(), "edited.jef")
+	if err := Write_jef(file, p, DefaultWriteOptions()); err != nil {
+		t.Fatal(err)
+	}
+	q := Read_jef(file, DefaultReadOptions())
+	qe := q.Ext[Format].(*Extension)
+
+	if got, want := q.Threads(), p.Threads(); !slices.Equal(got, want) {
+		t.Errorf("threads %v, want %v", got, want)
+	}
+	a, b := needles(p), needles(q)
+	if len(a) != len(b) {
+		t.Fatalf("%d stitches read back, want %d", len(b), len(a))
+	}
+	for k := range a {
+		if math.Abs(float64(a[k].X-b[k].X)) > float64(unit) || math.Abs(float64(a[k].Y-b[k].Y)) > float64(unit) {
+			t.Errorf("stitch %d at %v, want %v", k, b[k], a[k])
+		}
+	}
+	jumps := func(p *shared.Payload) int {
+		n := 0
+		for _, c := range p.Cmds {
+			if c.Command1 == shared.Jump {
+				n++
+			}
+		}
+		return n
+	}
+	for _, c := range q.Cmds {
+		if math.Abs(float64(c.Dx)) > 127*float64(unit)+1e-3 || math.Abs(float64(c.Dy)) > 127*float64(unit)+1e-3 {
+			t.Errorf("move %v is longer than a jef move", c)
+		}
+	}
+	if got, want := jumps(q), jumps(p)+4; got != want {
+		t.Errorf("%d jumps read back, want %d - two in front of each long stitch", got, want)
+	}
+
+	h, g := ext.Hdr, qe.Hdr
+	if h.unk1 != g.unk1 || h.unk2 != g.unk2 || h.Date != g.Date || h.Ver != g.Ver || h.Hoop != g.Hoop ||
+		!slices.Equal(h.Types, g.Types) {
+		t.Errorf("unknown header fields changed:\n%+v\n%+v", h, g)
+	}
+	if !bytes.Equal(ext.Trailer, qe.Trailer) {
+		t.Error("bytes after the stitches changed")
+	}
+	if g.ClrChg[1] != 20 || g.ClrCnt != 3 {
+		t.Errorf("colors %v", g.ClrChg)
+	}
+}
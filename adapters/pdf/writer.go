@@ -3,7 +3,9 @@ package pdf
 import (
 	"fmt"
 	"image/color"
+	"strings"
 
+	"github.com/emblib/adapters/shared"
 	"github.com/jung-kurt/gofpdf"
 )
 
@@ -20,11 +22,9 @@ type ImgType struct {
 	File       string
 }
 
-// Palette is a test slice of colors
-var palette []NamedColor
-
-// fillP is a test helper function to populate some colors
-func fillP() {
+// test_palette returns a test slice of colors
+func test_palette() []NamedColor {
+	var palette []NamedColor
 	palette = append(palette, NamedColor{Name: "VermillionBr", Color: color.RGBA{0xFF, 0x68, 0x05, 255}})
 	palette = append(palette, NamedColor{Name: "RedBrownBr", Color: color.RGBA{0xEC, 0, 0, 255}})
 	palette = append(palette, NamedColor{Name: "KhakiBr", Color: color.RGBA{0xFE, 0xCA, 0x15, 255}})
@@ -44,7 +44,20 @@ func fillP() {
 	palette = append(palette, NamedColor{Name: "SkyBlueBr", Color: color.RGBA{0x65, 0xBF, 0xEB, 255}})
 	palette = append(palette, NamedColor{Name: "GrayBr", Color: color.RGBA{0xA6, 0xA6, 0x95, 255}})
 	palette = append(palette, NamedColor{Name: "DarkBrownBr", Color: color.RGBA{0x69, 0x26, 0x0d, 255}})
+	return palette
+}
 
+// PayloadPalette names the thread of each color block of a payload - the palette of a real design
+func PayloadPalette(p *shared.Payload) []NamedColor {
+	var l []NamedColor
+	for _, t := range p.Threads() {
+		name := strings.Join(strings.Fields(t.Brand+" "+t.Code+" "+t.Name), " ")
+		if name == "" {
+			name = shared.Hex(t.Color)
+		}
+		l = append(l, NamedColor{Name: name, Color: color.RGBAModel.Convert(t.Color)})
+	}
+	return l
 }
 
 // EmbPdf collects everything required to make a pdf from an embroidery image
@@ -206,8 +219,7 @@ func convertHex(c color.Color) string {
 
 func main() {
 	p := NewEmbPdf("D1124.jpg")
-	fillP()
 	//var err error
-	p.Palette = palette
+	p.Palette = test_palette()
 	p.Layout()
 }
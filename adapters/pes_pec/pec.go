@@ -13,12 +13,52 @@ import (
 	"image/color"
 	"io"
 	"os"
+	"slices"
+	"strconv"
 
 	"github.com/emblib/adapters/shared"
+	"github.com/emblib/threads"
 )
 
-var expand float32 = 3.0 // Expand: Size of resulting image is dependent on a specific machine
-// this is a fudge factor to ensure the image fits
+// ReadOptions controls Read_pes
+type ReadOptions struct {
+	Scale float32        // payload units per mm, 0 for 3
+	Chart *threads.Chart // chart for pec colors the pes thread list does not cover, nil for Brother
+	Log   io.Writer      // notes about anything odd in the file, nil for none
+}
+
+// DefaultReadOptions returns 3 units per mm, the Brother chart and no notes
+func DefaultReadOptions() ReadOptions {
+	return ReadOptions{
+		Scale: 3.0,
+		Chart: nil,
+		Log:   nil,
+	}
+}
+
+// WriteOptions controls Encode_pes and Write_pes
+type WriteOptions struct {
+	Scale float32        // payload units per mm of payloads that do not say, 0 for 3
+	Chart *threads.Chart // chart the threads are matched to, nil for Brother
+	Log   io.Writer      // notes about what was rewritten, nil for none
+}
+
+// DefaultWriteOptions returns 3 units per mm, the Brother chart and no notes
+func DefaultWriteOptions() WriteOptions {
+	return WriteOptions{
+		Scale: 3.0,
+		Chart: nil,
+		Log:   nil,
+	}
+}
+
+// scale returns the units per mm to use - s or the default when s is not set
+func scale(s float32) float32 {
+	if s <= 0 {
+		return DefaultReadOptions().Scale
+	}
+	return s
+}
 
 /*
 **
@@ -40,43 +80,68 @@ type ColorSub struct {
 	ChartLen uint8
 	Chart    string
 	Count    uint32
+	raw      []byte
+}
+
+// Inspect describes the color structure field by field
+func (p ColorSub) Inspect() *shared.Field {
+	in := shared.NewInspector("ColorSub", p.raw)
+	in.Add("CodeLen", 1, p.CodeLen)
+	in.Add("Code", uint32(p.CodeLen), string(p.Code))
+	in.Add("Color", 3, shared.Hex(p.Color))
+	in.Add("u1", 1, p.U1)
+	in.Add("ColType", 4, p.ColType)
+	in.Add("DescLen", 1, p.DescLen)
+	in.Add("Desc", uint32(p.DescLen), p.Desc)
+	in.Add("BrandLen", 1, p.BrandLen)
+	in.Add("Brand", uint32(p.BrandLen), p.Brand)
+	in.Add("ChartLen", 1, p.ChartLen)
+	in.Add("Chart", uint32(p.ChartLen), p.Chart)
+	return in.Field()
+}
+
+// thread converts the color structure to a payload thread
+func (p ColorSub) thread() shared.Thread {
+	return shared.Thread{
+		Color: p.Color,
+		Brand: p.Brand,
+		Code:  string(p.Code),
+		Name:  p.Desc,
+		Chart: p.Chart,
+	}
 }
 
-// Dump writes out this Struct
-func (p ColorSub) Dump() {
-	fmt.Printf("\t\tColorSub:\n")
-	fmt.Printf("\t\t\tCodeLen: %d 0x%X\n", p.CodeLen, p.CodeLen)
-	fmt.Printf("\t\t\tCode: 0x%X\n", p.Code)
-	rgba := color.RGBAModel.Convert(p.Color).(color.RGBA)
-	fmt.Printf("\t\t\tColor: (%d, %d, %d, %d)\n", rgba.R, rgba.G, rgba.B, rgba.A)
-	fmt.Printf("\t\t\tu1: %d 0x%X\n", p.U1, p.U1)
-	fmt.Printf("\t\t\tDescLen: %d 0x%X\n", p.DescLen, p.DescLen)
-	fmt.Printf("\t\t\tDesc: %s\n", p.Desc)
-	fmt.Printf("\t\t\tBrandLen: %d 0x%X\n", p.BrandLen, p.BrandLen)
-	fmt.Printf("\t\t\tBrand: %s\n", p.Brand)
-	fmt.Printf("\t\t\tChartLen: %d 0x%X\n", p.ChartLen, p.ChartLen)
-	fmt.Printf("\t\t\tChart: %s\n", p.Chart)
-	fmt.Printf("\t\t\tcount: %d 0x%X\n", p.Count, p.Count)
-}
-
-// convert_colors decodes the pes color_subs or uses the brother palette to
-// create a specific palette for this design
-func convert_colors(c []ColorSub, p []byte) (bool, []color.Color) {
-	var cols []color.Color
-	var t bool = true
-	if c != nil {
-		for h := range c {
-			cols = append(cols, c[h].Color)
+// pes_threads works out the thread of each block. The pes thread list is used directly when it
+// has one entry per block, otherwise each distinct pec color takes the next thread of the list in
+// order of appearance. Blocks the list does not cover use chart, the brother chart when nil
+func pes_threads(subs []ColorSub, idx []byte, chart *threads.Chart, log io.Writer) []shared.Thread {
+	if chart == nil {
+		chart = threads.Builtin("Brother")
+	}
+	var l []shared.Thread
+	seen := make(map[byte]int)
+	for i, c := range idx {
+		if len(subs) == len(idx) {
+			l = append(l, subs[i].thread())
+			continue
 		}
-	} else {
-		t = false
-		palette := Brother_select()
-		for i := 0; i < len(p); i++ {
-			cols = append(cols, palette[p[i]-1]) // 1 based index not 0
-			//		fmt.Println(i, p[i])
+		n, ok := seen[c]
+		if !ok {
+			n = len(seen)
+			seen[c] = n
+		}
+		if n < len(subs) {
+			l = append(l, subs[n].thread())
+			continue
+		}
+		t, ok := chart.Code(strconv.Itoa(int(c)))
+		if !ok {
+			shared.Logf(log, "pec color %d is not in the %s chart - using black", c, chart.Name)
+			t = shared.Thread{Color: color.Black}
 		}
+		l = append(l, t)
 	}
-	return t, cols
+	return l
 }
 
 // parse_color_sub parses in a color structure
@@ -112,6 +177,7 @@ func parse_color_sub(bin []byte) (uint32, ColorSub) {
 	col.Chart = string(bin[count : count+uint32(col.ChartLen)])
 	count += uint32(col.ChartLen)
 	col.Count = count
+	col.raw = bin[:count]
 	return count, col
 }
 
@@ -126,6 +192,7 @@ type Preamble struct {
 	Id     string
 	Ver    string
 	Offset uint32
+	raw    []byte // bytes this was parsed from
 	count  uint32
 }
 
@@ -135,6 +202,7 @@ func (s *Preamble) Parse(bin []byte) {
 	s.Ver = string(bin[4:8])
 	s.Offset = binary.LittleEndian.Uint32(bin[8:12])
 	s.count = 12
+	s.raw = bin[:s.count]
 }
 
 // Preamble.SizeOf returns the size in bytes - offset into the file of the byte after the preamble. Always 12 bytes
@@ -142,13 +210,13 @@ func (p Preamble) SizeOf() uint32 {
 	return p.count
 }
 
-// Dump writes out this Struct
-func (p Preamble) Dump() {
-	fmt.Printf("Preamble:\n")
-	fmt.Printf("\tId: %s\n", p.Id)
-	fmt.Printf("\tVer: %s\n", p.Ver)
-	fmt.Printf("\tOffset: %d 0x%X\n", p.Offset, p.Offset)
-	fmt.Printf("\tcount: %d 0x%X\n", p.count, p.count)
+// Inspect describes the preamble field by field
+func (p Preamble) Inspect() *shared.Field {
+	in := shared.NewInspector("Preamble", p.raw)
+	in.Add("Id", 4, p.Id)
+	in.Add("Ver", 4, p.Ver)
+	in.Add("Offset", 4, p.Offset)
+	return in.Field()
 }
 
 // H_1 is version 1 header struct of a pes file
@@ -156,6 +224,7 @@ type H_1 struct {
 	Hoop      uint16
 	EDA       uint16
 	Blk_count uint16
+	raw       []byte // bytes this was parsed from
 	count     uint32
 }
 
@@ -165,6 +234,7 @@ func (h1 *H_1) Parse(bin []byte) {
 	h1.EDA = binary.LittleEndian.Uint16(bin[2:4])
 	h1.Blk_count = binary.LittleEndian.Uint16(bin[4:6])
 	h1.count = 6
+	h1.raw = bin[:h1.count]
 }
 
 // H_1.SizeOf returns the byte offset into the file of the next byte to read - always 6 bytes
@@ -172,13 +242,13 @@ func (h1 H_1) SizeOf() uint32 {
 	return h1.count
 }
 
-// Dump writes out this Struct
-func (p H_1) Dump() {
-	fmt.Printf("Header1:\n")
-	fmt.Printf("\tHoop: %d\n", p.Hoop)
-	fmt.Printf("\tEDA: %d\n", p.EDA)
-	fmt.Printf("\tBlk_count: %d 0x%X\n", p.Blk_count, p.Blk_count)
-	fmt.Printf("\tcount: %d 0x%X\n", p.count, p.count)
+// Inspect describes the version 1 header field by field
+func (p H_1) Inspect() *shared.Field {
+	in := shared.NewInspector("H_1", p.raw)
+	in.Add("Hoop", 2, p.Hoop)
+	in.Add("EDA", 2, p.EDA)
+	in.Add("Blk_count", 2, p.Blk_count)
+	return in.Field()
 }
 
 // H_2 stores the version 2 header
@@ -187,6 +257,7 @@ type H_2 struct {
 	HoopH uint16
 	Rot   uint16
 	unk   []byte
+	raw   []byte // bytes this was parsed from
 	count uint32
 }
 
@@ -197,6 +268,7 @@ func (h2 *H_2) Parse(bin []byte) {
 	h2.Rot = binary.LittleEndian.Uint16(bin[4:6])
 	h2.unk = bin[6:24]
 	h2.count = 24
+	h2.raw = bin[:h2.count]
 }
 
 // H_2.SizeOf returns the offset into the file of the next byte after the header - always 24 bytes
@@ -204,14 +276,14 @@ func (h2 H_2) SizeOf() uint32 {
 	return h2.count
 }
 
-// Dump writes out this Struct
-func (p H_2) Dump() {
-	fmt.Printf("Header2:\n")
-	fmt.Printf("\tHoopW: %d 0x%X\n", p.HoopW, p.HoopW)
-	fmt.Printf("\tHoopH: %d 0x%X\n", p.HoopH, p.HoopH)
-	fmt.Printf("\tRot: %d 0x%X\n", p.Rot, p.Rot)
-	fmt.Printf("\tunk: 0x%X\n", p.unk)
-	fmt.Printf("\tcount: %d 0x%X\n", p.count, p.count)
+// Inspect describes the version 2 header field by field
+func (p H_2) Inspect() *shared.Field {
+	in := shared.NewInspector("H_2", p.raw)
+	in.Add("HoopW", 2, p.HoopW)
+	in.Add("HoopH", 2, p.HoopH)
+	in.Add("Rot", 2, p.Rot)
+	in.Add("unk", 18, p.unk)
+	return in.Field()
 }
 
 // H_3 version three of the header
@@ -222,6 +294,7 @@ type H_3 struct {
 	HoopH uint16
 	Rot   uint16
 	u2    []byte
+	raw   []byte // bytes this was parsed from
 	count uint32
 }
 
@@ -234,6 +307,7 @@ func (h3 *H_3) Parse(bin []byte) {
 	h3.Rot = binary.LittleEndian.Uint16(bin[8:10])
 	h3.u2 = bin[10:28]
 	h3.count = 28
+	h3.raw = bin[:h3.count]
 }
 
 // H_3.SizeOf returns the offset into the file of the next byte - always 28 bytes
@@ -241,16 +315,16 @@ func (h3 H_3) SizeOf() uint32 {
 	return h3.count
 }
 
-// Dump writes out this Struct
-func (p H_3) Dump() {
-	fmt.Printf("Header3:\n")
-	fmt.Printf("\tu1: %d 0x%X\n", p.u1, p.u1)
-	fmt.Printf("\tSubV: %d 0x%X\n", p.SubV, p.SubV)
-	fmt.Printf("\tHoopW: %d 0x%X\n", p.HoopW, p.HoopW)
-	fmt.Printf("\tHoopH: %d 0x%X\n", p.HoopH, p.HoopH)
-	fmt.Printf("\tRot: %d 0x%X\n", p.Rot, p.Rot)
-	fmt.Printf("\tu2: %d 0x%X\n", p.u2, p.u2)
-	fmt.Printf("\tcount: %d 0x%X\n", p.count, p.count)
+// Inspect describes the version 3 header field by field
+func (p H_3) Inspect() *shared.Field {
+	in := shared.NewInspector("H_3", p.raw)
+	in.Add("u1", 2, p.u1)
+	in.Add("SubV", 2, p.SubV)
+	in.Add("HoopW", 2, p.HoopW)
+	in.Add("HoopH", 2, p.HoopH)
+	in.Add("Rot", 2, p.Rot)
+	in.Add("u2", 18, p.u2)
+	return in.Field()
 }
 
 // H_4 is version 4 of the header
@@ -263,6 +337,7 @@ type H_4 struct {
 	HoopH uint16
 	Rot   uint16
 	u3    []byte
+	raw   []byte // bytes this was parsed from
 	count uint32
 }
 
@@ -284,6 +359,7 @@ func (h4 *H_4) Parse(bin []byte) {
 	h4.u3 = bin[count : count+22]
 	count += 22
 	h4.count = count
+	h4.raw = bin[:count]
 }
 
 // H_4 SizeOf returns the offset into the file of the byte after this header
@@ -291,19 +367,18 @@ func (h4 H_4) SizeOf() uint32 {
 	return h4.count
 }
 
-// Dump writes out this Struct
-func (p H_4) Dump() {
-	fmt.Printf("Header4:\n")
-	fmt.Printf("\tu1: %d 0x%X\n", p.u1, p.u1)
-	fmt.Printf("\tSubV: %d 0x%X\n", p.SubV, p.SubV)
-	fmt.Printf("\tDesc: ")
-	fmt.Println(p.Desc)
-	fmt.Printf("\tu2: %d 0x%X\n", p.u2, p.u2)
-	fmt.Printf("\tHoopW: %d 0x%X\n", p.HoopW, p.HoopW)
-	fmt.Printf("\tHoopH: %d 0x%X\n", p.HoopH, p.HoopH)
-	fmt.Printf("\tRot: %d 0x%X\n", p.Rot, p.Rot)
-	fmt.Printf("\tu3: 0x%X\n", p.u3)
-	fmt.Printf("\tcount: %d 0x%X\n", p.count, p.count)
+// Inspect describes the version 4 header field by field
+func (p H_4) Inspect() *shared.Field {
+	in := shared.NewInspector("H_4", p.raw)
+	in.Add("u1", 2, p.u1)
+	in.Add("SubV", 2, p.SubV)
+	in.Sub(inspect_desc(p.raw[in.Pos():]))
+	in.Add("u2", 2, p.u2)
+	in.Add("HoopW", 2, p.HoopW)
+	in.Add("HoopH", 2, p.HoopH)
+	in.Add("Rot", 2, p.Rot)
+	in.Add("u3", 22, p.u3)
+	return in.Field()
 }
 
 //
@@ -316,6 +391,7 @@ type HP_1 struct {
 	SubV    uint16
 	Desc    *map[string]string
 	HoopChg uint16
+	raw     []byte // bytes this was parsed from
 	count   uint32
 }
 
@@ -328,6 +404,7 @@ func (h *HP_1) Parse(bin []byte) {
 	count += 4
 	h.HoopChg = binary.LittleEndian.Uint16(bin[count : count+2])
 	h.count = count + 2
+	h.raw = bin[:h.count]
 }
 
 // HP_1.SizeOf returns the offset into the file of the next byte after this section
@@ -335,13 +412,14 @@ func (h *HP_1) SizeOf() uint32 {
 	return h.count
 }
 
-// Dump writes out this Struct
-func (h HP_1) Dump() {
-	fmt.Printf("\tHoopInd: %d 0x%X\n", h.HoopInd, h.HoopInd)
-	fmt.Printf("\tSubV: %d 0x%X\n", h.SubV, h.SubV)
-	fmt.Printf("\tDesc: ")
-	fmt.Println(h.Desc)
-	fmt.Printf("\tHoopChg: %d 0x%X\n", h.HoopChg, h.HoopChg)
+// Inspect describes the first section of headers 5 and 6
+func (h HP_1) Inspect() *shared.Field {
+	in := shared.NewInspector("HP_1", h.raw)
+	in.Add("HoopInd", 2, h.HoopInd)
+	in.Add("SubV", 2, h.SubV)
+	in.Sub(inspect_desc(h.raw[in.Pos():]))
+	in.Add("HoopChg", 2, h.HoopChg)
+	return in.Field()
 }
 
 // HP_2 is second section of headers 5 and 6
@@ -349,6 +427,7 @@ type HP_2 struct {
 	HoopH uint16
 	HoopW uint16
 	Rot   uint16
+	raw   []byte // bytes this was parsed from
 	count uint32
 }
 
@@ -358,6 +437,7 @@ func (h *HP_2) Parse(bin []byte) {
 	h.HoopH = binary.LittleEndian.Uint16(bin[2:4])
 	h.Rot = binary.LittleEndian.Uint16(bin[4:6])
 	h.count = 6
+	h.raw = bin[:h.count]
 }
 
 // HP_2.SizeOf returns the offset into the file of the next byte after this section
@@ -365,11 +445,13 @@ func (h *HP_2) SizeOf() uint32 {
 	return h.count
 }
 
-// Dump writes out this Struct
-func (h HP_2) Dump() {
-	fmt.Printf("\tHoopW: %d 0x%X\n", h.HoopW, h.HoopW)
-	fmt.Printf("\tHoopH: %d 0x%X\n", h.HoopH, h.HoopH)
-	fmt.Printf("\tRot: %d 0x%X\n", h.Rot, h.Rot)
+// Inspect describes the second section of headers 5 and 6
+func (h HP_2) Inspect() *shared.Field {
+	in := shared.NewInspector("HP_2", h.raw)
+	in.Add("HoopW", 2, h.HoopW)
+	in.Add("HoopH", 2, h.HoopH)
+	in.Add("Rot", 2, h.Rot)
+	return in.Field()
 }
 
 // HP_3 is third section of headers 5 and 6
@@ -385,6 +467,7 @@ type HP_3 struct {
 	Imlen    uint8
 	Impath   string
 	Affline  []byte
+	raw      []byte // bytes this was parsed from
 	count    uint32
 }
 
@@ -403,6 +486,7 @@ func (h *HP_3) Parse(bin []byte) {
 	h.Impath = string(bin[17:o])
 	h.Affline = bin[o : o+24]
 	h.count = uint32(o) + 24
+	h.raw = bin[:h.count]
 }
 
 // HP_3 returns the offset into the file after the third section of headers 5 and 6
@@ -410,19 +494,21 @@ func (h *HP_3) SizeOf() uint32 {
 	return h.count
 }
 
-// Dump writes out this Struct
-func (h HP_3) Dump() {
-	fmt.Printf("\tBackground: %d 0x%X\n", h.BG, h.BG)
-	fmt.Printf("\tForeground: %d 0x%X\n", h.FG, h.FG)
-	fmt.Printf("\tGrid: %d 0x%X\n", h.Grid, h.Grid)
-	fmt.Printf("\tAxes: %d 0x%X\n", h.Axes, h.Axes)
-	fmt.Printf("\tSnap: %d 0x%X\n", h.Snap, h.Snap)
-	fmt.Printf("\tInterval: %d 0x%X\n", h.Interv, h.Interv)
-	fmt.Printf("\tu1: %d 0x%X\n", h.u1, h.u1)
-	fmt.Printf("\tOptEntEx: %d 0x%X\n", h.OptEntEx, h.OptEntEx)
-	fmt.Printf("\tImg Path Len: %d 0x%X\n", h.Imlen, h.Imlen)
-	fmt.Printf("\tImg Path: %s\n", h.Impath)
-	fmt.Printf("\tAffline: %X\n", h.Affline)
+// Inspect describes the third section of headers 5 and 6
+func (h HP_3) Inspect() *shared.Field {
+	in := shared.NewInspector("HP_3", h.raw)
+	in.Add("Background", 2, h.BG)
+	in.Add("Foreground", 2, h.FG)
+	in.Add("Grid", 2, h.Grid)
+	in.Add("Axes", 2, h.Axes)
+	in.Add("Snap", 2, h.Snap)
+	in.Add("Interval", 2, h.Interv)
+	in.Add("u1", 2, h.u1)
+	in.Add("OptEntEx", 2, h.OptEntEx)
+	in.Add("Imlen", 1, h.Imlen)
+	in.Add("Impath", uint32(h.Imlen), h.Impath)
+	in.Add("Affline", 24, h.Affline)
+	return in.Field()
 }
 
 // HP_4 is fourth section of headers 5 and 6
@@ -436,20 +522,24 @@ type HP_4 struct {
 	ColSects   uint16
 	Colors     []ColorSub
 	Obj        uint16
+	raw        []byte // bytes this was parsed from
 	count      uint32
 }
 
 // HP_4.Parse reads the fourth section of headers 5 and 6
 func (h *HP_4) Parse(bin []byte) {
 	end := binary.LittleEndian.Uint16(bin[0:2])
+	h.FillCount = end
 	h.Fill = bin[2 : end+2]
 	start := end + 2
 	end = binary.LittleEndian.Uint16(bin[start : start+2])
+	h.MotCount = end
 	start += 2
 	end += start
 	h.Motif = bin[start:end]
 	start = end
 	end = binary.LittleEndian.Uint16(bin[start : start+2])
+	h.FeathCount = end
 	start += 2
 	end += start
 	h.Feather = bin[start:end]
@@ -465,6 +555,7 @@ func (h *HP_4) Parse(bin []byte) {
 	}
 	h.Obj = binary.LittleEndian.Uint16(bin[start : start+2])
 	h.count = uint32(start + 2)
+	h.raw = bin[:h.count]
 }
 
 // HP_4.SizeOf returns the offset into the file of the byte after the fourth section of headers 5 and 6
@@ -472,19 +563,21 @@ func (h *HP_4) SizeOf() uint32 {
 	return h.count
 }
 
-// Dump writes out this Struct
-func (h HP_4) Dump() {
-	fmt.Printf("\tFillCount: %d 0x%X\n", h.FillCount, h.FillCount)
-	fmt.Printf("\tFill: %X", h.Fill)
-	fmt.Printf("\tMotCount: %d 0x%X\n", h.MotCount, h.MotCount)
-	fmt.Printf("\tMotif: %X", h.Motif)
-	fmt.Printf("\tFeatherCount: %d 0x%X\n", h.FeathCount, h.FeathCount)
-	fmt.Printf("\tFeather: %X\n", h.Feather)
-	fmt.Printf("\tColorSects: %d 0x%X\n", h.ColSects, h.ColSects)
-	for i := 0; i < int(h.ColSects); i++ {
-		h.Colors[i].Dump()
+// Inspect describes the fourth section of headers 5 and 6
+func (h HP_4) Inspect() *shared.Field {
+	in := shared.NewInspector("HP_4", h.raw)
+	in.Add("FillCount", 2, h.FillCount)
+	in.Add("Fill", uint32(len(h.Fill)), h.Fill)
+	in.Add("MotCount", 2, h.MotCount)
+	in.Add("Motif", uint32(len(h.Motif)), h.Motif)
+	in.Add("FeatherCount", 2, h.FeathCount)
+	in.Add("Feather", uint32(len(h.Feather)), h.Feather)
+	in.Add("ColorSects", 2, h.ColSects)
+	for i := range h.Colors {
+		in.Sub(h.Colors[i].Inspect())
 	}
-	fmt.Printf("\tObjects: %d 0x%X\n", h.Obj, h.Obj)
+	in.Add("Objects", 2, h.Obj)
+	return in.Field()
 }
 
 // H_5 version 5 of the header
@@ -493,6 +586,7 @@ type H_5 struct {
 	HP_2
 	HP_3
 	HP_4
+	raw   []byte // bytes this was parsed from
 	count uint32
 }
 
@@ -513,6 +607,7 @@ func (h *H_5) Parse(bin []byte) {
 	count += h.HP_4.SizeOf()
 
 	h.count = count
+	h.raw = bin[:count]
 }
 
 // H_5.SizeOf returns the offset into the file of the next byte after this header
@@ -520,14 +615,14 @@ func (h H_5) SizeOf() uint32 {
 	return h.count
 }
 
-// Dump displays this struct
-func (h H_5) Dump() {
-	fmt.Println("Header5:")
-	h.HP_1.Dump()
-	h.HP_2.Dump()
-	h.HP_3.Dump()
-	h.HP_4.Dump()
-	fmt.Printf("\tcount: %d 0x%X\n", h.count, h.count)
+// Inspect describes the version 5 header section by section
+func (h H_5) Inspect() *shared.Field {
+	in := shared.NewInspector("H_5", h.raw)
+	in.Sub(h.HP_1.Inspect())
+	in.Sub(h.HP_2.Inspect())
+	in.Sub(h.HP_3.Inspect())
+	in.Sub(h.HP_4.Inspect())
+	return in.Field()
 }
 
 // H_6 version header
@@ -542,6 +637,7 @@ type H_6 struct {
 	u1       uint16
 	HP_3
 	HP_4
+	raw   []byte // bytes this was parsed from
 	count uint32
 }
 
@@ -576,6 +672,7 @@ func (h *H_6) Parse(bin []byte) {
 	count += h.HP_4.SizeOf()
 
 	h.count = count
+	h.raw = bin[:count]
 }
 
 // H_6.SizeOf returns the next byte in the file after this header
@@ -583,19 +680,20 @@ func (h6 H_6) SizeOf() uint32 {
 	return h6.count
 }
 
-// Dump displays this struct
-func (h H_6) Dump() {
-	fmt.Println("Header6:")
-	h.HP_1.Dump()
-	fmt.Printf("\tCust: %d 0x%X\n", h.Cust, h.Cust)
-	h.HP_2.Dump()
-	fmt.Printf("\tDWidth: %d 0x%X\n", h.DWidth, h.DWidth)
-	fmt.Printf("\tDHeight: %d 0x%X\n", h.DHeight, h.DHeight)
-	fmt.Printf("\tDPWidth: %d 0x%X\n", h.DPWidth, h.DPWidth)
-	fmt.Printf("\tDPHeight: %d 0x%X\n", h.DPHeight, h.DPHeight)
-	fmt.Printf("\tu1: %d 0x%X\n", h.u1, h.u1)
-	h.HP_3.Dump()
-	h.HP_4.Dump()
+// Inspect describes the version 6 header section by section
+func (h H_6) Inspect() *shared.Field {
+	in := shared.NewInspector("H_6", h.raw)
+	in.Sub(h.HP_1.Inspect())
+	in.Add("Cust", 2, h.Cust)
+	in.Sub(h.HP_2.Inspect())
+	in.Add("DWidth", 2, h.DWidth)
+	in.Add("DHeight", 2, h.DHeight)
+	in.Add("DPWidth", 2, h.DPWidth)
+	in.Add("DPHeight", 2, h.DPHeight)
+	in.Add("u1", 2, h.u1)
+	in.Sub(h.HP_3.Inspect())
+	in.Sub(h.HP_4.Inspect())
+	return in.Field()
 }
 
 // Header stores the pes header in all forms
@@ -609,6 +707,7 @@ type Header struct {
 	H5      H_5
 	H6      H_6
 	ColList []ColorSub
+	raw     []byte // bytes this was parsed from
 	count   uint32
 	tail    uint32
 }
@@ -663,6 +762,7 @@ func (Hdr *Header) Parse(bin []byte) {
 		count_p += h.SizeOf()
 		Hdr.P = h_p
 		Hdr.H5 = h
+		Hdr.ColList = h.Colors
 		Hdr.count = h.SizeOf() + h_p.SizeOf()
 	case "0060":
 		var h_p Preamble
@@ -673,10 +773,12 @@ func (Hdr *Header) Parse(bin []byte) {
 		count_p += h.SizeOf()
 		Hdr.P = h_p
 		Hdr.H6 = h
+		Hdr.ColList = h.Colors
 		Hdr.count = h.SizeOf() + h_p.SizeOf()
 	}
 	Hdr.tail = binary.LittleEndian.Uint32(bin[Hdr.count : Hdr.count+4])
 	Hdr.count += 4
+	Hdr.raw = bin[:Hdr.count]
 }
 
 // Header.SizeOf returns the offset of the next byte after the header
@@ -684,25 +786,26 @@ func (h *Header) SizeOf() uint32 {
 	return h.count
 }
 
-// Dump writes out this Struct
-func (h Header) Dump() {
-	h.P.Dump()
+// Inspect describes the whole pes header - the preamble, the versioned header and the tail
+func (h Header) Inspect() *shared.Field {
+	in := shared.NewInspector("Header", h.raw)
+	in.Sub(h.P.Inspect())
 	switch h.Ver {
 	case "0001":
-		h.H1.Dump()
+		in.Sub(h.H1.Inspect())
 	case "0020":
-		h.H2.Dump()
+		in.Sub(h.H2.Inspect())
 	case "0030":
-		h.H3.Dump()
+		in.Sub(h.H3.Inspect())
 	case "0040":
-		h.H4.Dump()
+		in.Sub(h.H4.Inspect())
 	case "0050":
-		h.H5.Dump()
+		in.Sub(h.H5.Inspect())
 	case "0060":
-		h.H6.Dump()
+		in.Sub(h.H6.Inspect())
 	}
-	fmt.Printf("\ttail: %x\n", h.tail)
-	fmt.Printf("\tcount: %d 0x%X\n", h.count, h.count)
+	in.Add("tail", 4, h.tail)
+	return in.Field()
 }
 
 //
@@ -744,6 +847,17 @@ func parse_desc(bin []byte) (uint32, *map[string]string) {
 	return count, &meta
 }
 
+// inspect_desc describes a description block field by field
+func inspect_desc(bin []byte) *shared.Field {
+	in := shared.NewInspector("Desc", bin)
+	for _, name := range []string{"Design", "Category", "Author", "Keywords", "Comments"} {
+		l := uint32(bin[in.Pos()])
+		in.Add(name+"Len", 1, uint8(l))
+		in.Add(name, l, string(bin[in.Pos():in.Pos()+l]))
+	}
+	return in.Field()
+}
+
 /*
 **
 ** Pec reading code
@@ -761,6 +875,7 @@ type H1 struct {
 	NoCol   uint8
 	ColIdx  []byte
 	Pad     []byte
+	raw     []byte // bytes this was parsed from
 	count   uint32
 }
 
@@ -787,6 +902,7 @@ func (h *H1) Parse(bin []byte) {
 	h.Pad = bin[count : count+sz]
 	count += sz
 	h.count = count
+	h.raw = bin[:count]
 }
 
 // H1.SizeOf returns the size of the first pec header
@@ -794,19 +910,19 @@ func (h H1) SizeOf() uint32 {
 	return h.count
 }
 
-// H1.Dump dumps out the first pec header
-func (h *H1) Dump() {
-	fmt.Printf("Header1:\n")
-	fmt.Printf("\tLabel: %s\n", h.Label)
-	fmt.Printf("\tRet: %d 0x%X\n", h.Ret, h.Ret)
-	fmt.Printf("\tu1: %X\n", h.u1)
-	fmt.Printf("\tTWidth: %d 0x%X\n", h.TWidth, h.TWidth)
-	fmt.Printf("\tTHeight: %d 0x%X\n", h.THeight, h.THeight)
-	fmt.Printf("\tu2: %X\n", h.u2)
-	fmt.Printf("\tNumCols: %d 0x%X\n", h.NoCol, h.NoCol)
-	fmt.Printf("\tColIdx: %X\n", h.ColIdx)
-	fmt.Printf("\tPad: %X\n", h.Pad)
-	fmt.Printf("\tcount: %d 0x%X\n", h.count, h.count)
+// H1.Inspect describes the first pec header field by field
+func (h H1) Inspect() *shared.Field {
+	in := shared.NewInspector("PecH1", h.raw)
+	in.Add("Label", 19, h.Label)
+	in.Add("Ret", 1, h.Ret)
+	in.Add("u1", 14, h.u1)
+	in.Add("TWidth", 1, h.TWidth)
+	in.Add("THeight", 1, h.THeight)
+	in.Add("u2", 12, h.u2)
+	in.Add("NumCols", 1, h.NoCol)
+	in.Add("ColIdx", uint32(len(h.ColIdx)), h.ColIdx)
+	in.Add("Pad", uint32(len(h.Pad)), h.Pad)
+	return in.Field()
 }
 
 // H2 stores the second pec header
@@ -817,6 +933,7 @@ type H2 struct {
 	Width  int16
 	Height int16
 	u3     []byte
+	raw    []byte // bytes this was parsed from
 	count  uint32
 }
 
@@ -836,6 +953,7 @@ func (h *H2) Parse(bin []byte) {
 	h.u3 = bin[count : count+8]
 	count += 8
 	h.count = count
+	h.raw = bin[:count]
 }
 
 // H2.SizeOf returns the size of the second pec header
@@ -843,16 +961,16 @@ func (h H2) SizeOf() uint32 {
 	return h.count
 }
 
-// H2.Dump dumps out the second pec header
-func (h *H2) Dump() {
-	fmt.Printf("Header2:\n")
-	fmt.Printf("\tu1: %d 0x%x\n", h.u1, h.u1)
-	fmt.Printf("\tTOffs: %d 0x%x\n", h.TOffs, h.TOffs)
-	fmt.Printf("\tu2: %d 0x%X\n", h.u2, h.u2)
-	fmt.Printf("\tWidth: %d 0x%X\n", h.Width, h.Width)
-	fmt.Printf("\tHeight: %d 0x%X\n", h.Height, h.Height)
-	fmt.Printf("\tu3: %X\n", h.u3)
-	fmt.Printf("\tcount: %d 0x%X\n", h.count, h.count)
+// H2.Inspect describes the second pec header field by field
+func (h H2) Inspect() *shared.Field {
+	in := shared.NewInspector("PecH2", h.raw)
+	in.Add("u1", 2, h.u1)
+	in.Add("TOffs", 2, h.TOffs)
+	in.Add("u2", 4, h.u2)
+	in.Add("Width", 2, h.Width)
+	in.Add("Height", 2, h.Height)
+	in.Add("u3", 8, h.u3)
+	return in.Field()
 }
 
 /*
@@ -922,16 +1040,10 @@ func inc() func() int {
 	}
 }
 
-// decode_color if set in pes header we index into its table otherwise we use pec changes
-func decode_color(c []byte, t bool, f func() int) int {
-	if t {
-		// index into pes header color table
-		return int(c[2]) - 1
-	} else {
-		// index into the pec header color table
-		rv := f()
-		return rv - 1
-	}
+// decode_color numbers the color changes - the first block is entry 0 of the pec header
+// color table so the nth change selects entry n. The byte in the change itself only alternates
+func decode_color(f func() int) int {
+	return f()
 }
 
 // decode byte extract a byte to a command
@@ -972,8 +1084,8 @@ func decode_long(c []byte) (int, float32) {
 	return cmd, f
 }
 
-// next_command decodes the next command
-func next_command(bin []byte, t bool, f func() int) (int, *shared.PCommand) {
+// next_command decodes the next command. Moves are scaled from mm by unit
+func next_command(bin []byte, f func() int, unit float32) (int, *shared.PCommand) {
 
 	var p shared.PCommand
 
@@ -992,7 +1104,7 @@ func next_command(bin []byte, t bool, f func() int) (int, *shared.PCommand) {
 			// short and long or color
 			if c[0] == color_flag {
 				p.Command1 = shared.ColorChg
-				p.Color = decode_color(c, t, f)
+				p.Color = decode_color(f)
 			} else if c[0]&is_cmd_mask > 0 {
 				p.Command1, p.Dx = decode_long(c[0:2])
 				p.Dy = decode_byte(c[2:])
@@ -1006,11 +1118,30 @@ func next_command(bin []byte, t bool, f func() int) (int, *shared.PCommand) {
 			p.Command2, p.Dy = decode_long(c[2:4])
 		}
 	}
-	p.Dx *= expand
-	p.Dy *= expand
+	p.Dx *= unit
+	p.Dy *= unit
 	return count, &p
 }
 
+// read_cmds decodes the pec stitches up to and including the end command with unit payload units
+// per mm. Returns the commands, the offset of each in bin and the bytes used
+func read_cmds(bin []byte, unit float32) ([]shared.PCommand, []int, uint32) {
+	var cmds []shared.PCommand
+	var offs []int
+	count := uint32(0)
+	f := inc()
+	for {
+		b, p := next_command(bin[count:], f, unit)
+		cmds = append(cmds, *p)
+		offs = append(offs, int(count))
+		count += uint32(b)
+		if p.Command1 == shared.End {
+			break
+		}
+	}
+	return cmds, offs, count
+}
+
 // decode_pes decodes a header
 func decode_pes(h Header) shared.Payload {
 	var p shared.Payload
@@ -1044,23 +1175,28 @@ func decode_pes(h Header) shared.Payload {
 		p.Rot = h.H5.Rot
 		p.Desc = *h.H5.Desc
 		p.Path = h.H5.Impath
-		h.ColList = h.H5.Colors
 	case "0060":
 		p.Height = float32(h.H6.HoopH)
 		p.Width = float32(h.H6.HoopW)
 		p.Rot = h.H6.Rot
 		p.Desc = *h.H6.Desc
 		p.Path = h.H6.Impath
-		h.ColList = h.H6.Colors
+	}
+	if p.Width > 0 && p.Height > 0 {
+		p.Hoop = shared.Hoop{
+			Name:   fmt.Sprintf("Brother %g x %g", p.Width, p.Height),
+			Width:  p.Width,
+			Height: p.Height,
+			Frame:  15,
+		}
 	}
 	return p
 }
 
 // read_pes reads in a file and converts it to a payload that can be run
-func Read_pes(file string) *shared.Payload {
+func Read_pes(file string, o ReadOptions) *shared.Payload {
 	var pay shared.Payload
-
-	pay.Title = file
+	unit := scale(o.Scale)
 
 	// get the actual file contents
 	reader, err := os.Open(file)
@@ -1079,6 +1215,10 @@ func Read_pes(file string) *shared.Payload {
 
 	// get what we want from pes header into our payload
 	pay = decode_pes(pes_hdr)
+	pay.Title = file
+	if !pay.Hoop.Known() {
+		shared.Logf(o.Log, "%s: pes version %q does not give a hoop", file, pes_hdr.Ver)
+	}
 
 	// parse the pec section for a little metadata and the stitches
 	PecBin := bin[pes_hdr.P.Offset:]
@@ -1090,235 +1230,65 @@ func Read_pes(file string) *shared.Payload {
 	H2.Parse(PecBin[count:])
 
 	pay.Head = H1.Label[2:]
-	pay.Palette_type, pay.Palette = convert_colors(pes_hdr.ColList, H1.ColIdx)
-
-	var cmds []shared.PCommand
 
-	niggle := 0
-	count = 0
 	l := H1.SizeOf() + H2.SizeOf()
-	StBin := PecBin[l:]
-	f := inc()
-	for {
-		niggle++
-		b, p := next_command(StBin[count:], pay.Palette_type, f)
-		cmds = append(cmds, *p)
-		count += uint32(b)
-		if p.Command1 == shared.End {
-			break
-		}
+	var n uint32
+	var offs []int
+	pay.Cmds, offs, n = read_cmds(PecBin[l:], unit)
+	for _, off := range offs {
+		pay.Offsets = append(pay.Offsets, int(pes_hdr.P.Offset+l)+off)
+	}
+	if len(pes_hdr.ColList) != len(H1.ColIdx) {
+		shared.Logf(o.Log, "%s: %d threads listed for %d blocks", file, len(pes_hdr.ColList), len(H1.ColIdx))
+	}
+	pay.SetBlocks(pes_threads(pes_hdr.ColList, H1.ColIdx, o.Chart, o.Log))
+	pay.Width *= unit
+	pay.Height *= unit
+	pay.Scale = unit // stitches are decoded in mm
+
+	// keep everything we do not model so that Write_pes can reproduce the file
+	pay.Ext = map[string]any{
+		Format: &Extension{
+			Hdr:      pes_hdr,
+			Sections: bin[pes_hdr.SizeOf():max(pes_hdr.SizeOf(), pes_hdr.P.Offset)],
+			Pec1:     H1,
+			Pec2:     H2,
+			Stitches: PecBin[l : l+n],
+			Trailer:  PecBin[l+n:],
+			cmds:     slices.Clone(pay.Cmds),
+			threads:  pay.Threads(),
+		},
 	}
-	pay.Cmds = cmds
-	pay.Width *= expand
-	pay.Height *= expand
 	return &pay
 }
 
-// defines of the Brother palette thread colors
-var (
-	PrussianBlueBr   = color.RGBA{0x1a, 0x0a, 0x94, 255}
-	BlueBr           = color.RGBA{0x0f, 0x75, 0xff, 255}
-	TealGreenBr      = color.RGBA{0x00, 0x93, 0x4c, 255}
-	CFBlueBr         = color.RGBA{0xba, 0xbd, 0xfe, 255}
-	RedBr            = color.RGBA{0xec, 0x00, 0x00, 255}
-	RedBrownBr       = color.RGBA{0xe4, 0x99, 0x5a, 255}
-	MagentaBr        = color.RGBA{0xcc, 0x48, 0xab, 255}
-	LightLilacBr     = color.RGBA{0xfd, 0xc4, 0xfa, 255}
-	LilacBr          = color.RGBA{0xdd, 0x84, 0xab, 255}
-	MintGreenBr      = color.RGBA{0x6b, 0xd3, 0x8a, 255}
-	DeepGoldBr       = color.RGBA{0xe4, 0xa9, 0x45, 255}
-	OrangeBr         = color.RGBA{0xff, 0xbd, 0x42, 255}
-	YellowBr         = color.RGBA{0xff, 0xe6, 0x00, 255}
-	LimeGreenBr      = color.RGBA{0x6c, 0xd9, 0x00, 255}
-	BrassBr          = color.RGBA{0xc1, 0xa9, 0x41, 255}
-	SilverBr         = color.RGBA{0xb5, 0xad, 0x97, 255}
-	RussetBrownBr    = color.RGBA{0xba, 0x9c, 0x5f, 255}
-	CreamBrownBr     = color.RGBA{0xfa, 0xf5, 0x9e, 255}
-	PewterBr         = color.RGBA{0x80, 0x80, 0x80, 255}
-	BlackBr          = color.RGBA{0x0, 0x0, 0x0, 255}
-	UltraMarineBr    = color.RGBA{0x00, 0x1c, 0xdf, 255}
-	RoyaPurpleBr     = color.RGBA{0xdf, 0x00, 0xb8, 255}
-	DarkGrayBr       = color.RGBA{0x62, 0x62, 0x62, 255}
-	DarkBrownBr      = color.RGBA{0x69, 0x26, 0x0d, 255}
-	DeepRoseBr       = color.RGBA{0xff, 0x00, 0x60, 255}
-	LightBrownBr     = color.RGBA{0xbf, 0x82, 0x00, 255}
-	SalmonPinkBr     = color.RGBA{0xf3, 0x91, 0x78, 255}
-	VermilionBr      = color.RGBA{0xff, 0x68, 0x05, 255}
-	WhiteBr          = color.RGBA{0xf0, 0xf0, 0xf0, 255}
-	VioletBr         = color.RGBA{0xc8, 0x32, 0xcd, 255}
-	SeaCrestBr       = color.RGBA{0xb0, 0xbf, 0x9b, 255}
-	SkyBlueBr        = color.RGBA{0x65, 0xbf, 0xeb, 255}
-	PumpkinBr        = color.RGBA{0xff, 0xba, 0x04, 255}
-	CreamYellowBr    = color.RGBA{0xff, 0xf0, 0x6c, 255}
-	KhakiBr          = color.RGBA{0xfe, 0xca, 0x15, 255}
-	ClayBrownBr      = color.RGBA{0xf3, 0x81, 0x01, 255}
-	LeafGreenBr      = color.RGBA{0x37, 0xa9, 0x23, 255}
-	PeacockBlueBr    = color.RGBA{0x23, 0x46, 0x5f, 255}
-	GrayBr           = color.RGBA{0xa6, 0xa6, 0x95, 255}
-	WarmGrayBr       = color.RGBA{0xce, 0xbf, 0xa6, 255}
-	DarkOliveBr      = color.RGBA{0x96, 0xaa, 0x02, 255}
-	LinenBr          = color.RGBA{0xff, 0xe3, 0xc6, 255}
-	PinkBr           = color.RGBA{0xff, 0x99, 0xd7, 255}
-	DeepGreenBr      = color.RGBA{0x00, 0x70, 0x04, 255}
-	LavenderBr       = color.RGBA{0xed, 0xcc, 0xfb, 255}
-	WisteriaVioletBr = color.RGBA{0xc0, 0x89, 0xd8, 255}
-	BeigeBr          = color.RGBA{0xe7, 0xd9, 0xb4, 255}
-	CarmineBr        = color.RGBA{0xe9, 0x0e, 0x86, 255}
-	AmberRedBr       = color.RGBA{0xcf, 0x68, 0x29, 255}
-	OliveGreenBr     = color.RGBA{0x40, 0x86, 0x15, 255}
-	DarkFuchsiaBr    = color.RGBA{0xdb, 0x17, 0x97, 255}
-	TangerineBr      = color.RGBA{0xff, 0xa7, 0x04, 255}
-	LightBlueBr      = color.RGBA{0xb9, 0xff, 0xff, 255}
-	EmeraldGreenBr   = color.RGBA{0x22, 0x89, 0x27, 255}
-	PurpleBr         = color.RGBA{0xb6, 0x12, 0xcd, 255}
-	MossGreenBr      = color.RGBA{0x00, 0xaa, 0x00, 255}
-	FleshPinkBr      = color.RGBA{0xfe, 0xa9, 0xdc, 255}
-	HarvestGoldBr    = color.RGBA{0xfe, 0xd5, 0x10, 255}
-	ElectricBlueBr   = color.RGBA{0x00, 0x97, 0xdf, 255}
-	LemonYellowBr    = color.RGBA{0xff, 0xff, 0x84, 255}
-	FreshGreenBr     = color.RGBA{0xcf, 0xe7, 0x74, 255}
-	AppliqueMBr      = color.RGBA{0xff, 0xc8, 0x64, 255}
-	AppliquePBr      = color.RGBA{0xff, 0xc8, 0xc8, 255}
-	AppliqueBr       = color.RGBA{0xff, 0xc8, 0xc8, 255}
-)
+// Inspect_pes describes the layout of a pes file - headers field by field, then the stitch and thumbnail regions
+func Inspect_pes(file string) *shared.Field {
+	bin, err := os.ReadFile(file)
+	if err != nil {
+		panic(err)
+	}
 
-// Brother_set returns a map of name to color
-func Brother_set() *map[string]color.Color {
-	return &map[string]color.Color{
-		"Br_PrussianBlue":   PrussianBlueBr,
-		"Br_Blue":           BlueBr,
-		"Br_TealGreen":      TealGreenBr,
-		"Br_CornFlowerBlue": CFBlueBr,
-		"Br_Red":            RedBr,
-		"Br_RedBrown":       RedBrownBr,
-		"Br_Magenta":        MagentaBr,
-		"Br_LightLilac":     LightLilacBr,
-		"Br_Lilac":          LilacBr,
-		"Br_MintGreen":      MintGreenBr,
-		"Br_DeepGold":       DeepGoldBr,
-		"Br_Orange":         OrangeBr,
-		"Br_Yellow":         YellowBr,
-		"Br_LimeGreen":      LimeGreenBr,
-		"Br_Brass":          BrassBr,
-		"Br_Silver":         SilverBr,
-		"Br_RussetBrown":    RussetBrownBr,
-		"Br_CreamBrown":     CreamBrownBr,
-		"Br_Pewter":         PewterBr,
-		"Br_Black":          BlackBr,
-		"Br_UltraMarine":    UltraMarineBr,
-		"Br_RoyalPurple":    RoyaPurpleBr,
-		"Br_DarkGray":       DarkGrayBr,
-		"Br_DarkBrown":      DarkBrownBr,
-		"Br_DeepRose":       DeepRoseBr,
-		"Br_LightBrown":     LightBrownBr,
-		"Br_SalmonPink":     SalmonPinkBr,
-		"Br_Vermilion":      VermilionBr,
-		"Br_White":          WhiteBr,
-		"Br_Violet":         VioletBr,
-		"Br_SeaCrest":       SeaCrestBr,
-		"Br_SkyBlue":        SkyBlueBr,
-		"Br_Pumpkin":        PumpkinBr,
-		"Br_CreamYellow":    CreamYellowBr,
-		"Br_Khaki":          KhakiBr,
-		"Br_ClayBrown":      ClayBrownBr,
-		"Br_LeafGreen":      LeafGreenBr,
-		"Br_PeacockBlue":    PeacockBlueBr,
-		"Br_Gray":           GrayBr,
-		"Br_WarmGray":       WarmGrayBr,
-		"Br_DarkOlive":      DarkOliveBr,
-		"Br_Linen":          LinenBr,
-		"Br_Pink":           PinkBr,
-		"Br_DeepGreen":      DeepGreenBr,
-		"Br_Lavender":       LavenderBr,
-		"Br_Wisteria":       WisteriaVioletBr,
-		"Br_Beige":          BeigeBr,
-		"Br_Carmine":        CarmineBr,
-		"Br_AmberRed":       AmberRedBr,
-		"Br_OliveGreen":     OliveGreenBr,
-		"Br_DarkFuchsia":    DarkFuchsiaBr,
-		"Br_Tangerine":      TangerineBr,
-		"Br_LightBlue":      LightBlueBr,
-		"Br_EmeraldGreen":   EmeraldGreenBr,
-		"Br_Purple":         PurpleBr,
-		"Br_MossGreen":      MossGreenBr,
-		"Br_FleshPink":      FleshPinkBr,
-		"Br_HarvestGold":    HarvestGoldBr,
-		"Br_ElectricBlue":   ElectricBlueBr,
-		"Br_LemonYellow":    LemonYellowBr,
-		"Br_FreshGreen":     FreshGreenBr,
-		"Br_AppliqueM":      AppliqueMBr,
-		"Br_AppliqueP":      AppliquePBr,
-		"Br_Applique":       AppliqueBr,
+	var pes_hdr Header
+	pes_hdr.Parse(bin)
+	in := shared.NewInspector("pes", bin)
+	in.Sub(pes_hdr.Inspect())
+	if off := pes_hdr.P.Offset; off > in.Pos() {
+		in.Add("Sections", off-in.Pos(), nil) // CEmbOne, CSewSeg and friends - not decoded
 	}
-} //brother_set()
-
-// Brother_select returns an array/lookup table of the Brother palette
-// order is important
-func Brother_select() []color.Color {
-	return []color.Color{
-		PrussianBlueBr,
-		BlueBr,
-		TealGreenBr,
-		CFBlueBr,
-		RedBr,
-		RedBrownBr,
-		MagentaBr,
-		LightLilacBr,
-		LilacBr,
-		MintGreenBr,
-		DeepGoldBr,
-		OrangeBr,
-		YellowBr,
-		LimeGreenBr,
-		BrassBr,
-		SilverBr,
-		RussetBrownBr,
-		CreamBrownBr,
-		PewterBr,
-		BlackBr,
-		UltraMarineBr,
-		RoyaPurpleBr,
-		DarkGrayBr,
-		DarkBrownBr,
-		DeepRoseBr,
-		LightBrownBr,
-		SalmonPinkBr,
-		VermilionBr,
-		WhiteBr,
-		VioletBr,
-		SeaCrestBr,
-		SkyBlueBr,
-		PumpkinBr,
-		CreamYellowBr,
-		KhakiBr,
-		ClayBrownBr,
-		LeafGreenBr,
-		PeacockBlueBr,
-		GrayBr,
-		WarmGrayBr,
-		DarkOliveBr,
-		LinenBr,
-		PinkBr,
-		DeepGreenBr,
-		LavenderBr,
-		WisteriaVioletBr,
-		BeigeBr,
-		CarmineBr,
-		AmberRedBr,
-		OliveGreenBr,
-		DarkFuchsiaBr,
-		TangerineBr,
-		LightBlueBr,
-		EmeraldGreenBr,
-		PurpleBr,
-		MossGreenBr,
-		FleshPinkBr,
-		HarvestGoldBr,
-		ElectricBlueBr,
-		LemonYellowBr,
-		FreshGreenBr,
-		AppliqueMBr,
-		AppliquePBr,
-		AppliqueBr,
+
+	PecBin := bin[pes_hdr.P.Offset:]
+	var H1 H1
+	H1.Parse(PecBin)
+	in.Sub(H1.Inspect())
+	var H2 H2
+	H2.Parse(PecBin[H1.SizeOf():])
+	in.Sub(H2.Inspect())
+
+	cmds, _, n := read_cmds(PecBin[H1.SizeOf()+H2.SizeOf():], DefaultReadOptions().Scale)
+	in.Add("Stitches", n, fmt.Sprintf("%d commands", len(cmds)))
+	if rest := uint32(len(bin)) - in.Pos(); rest > 0 {
+		in.Add("Thumbnails", rest, nil)
 	}
-} //Brother_Select()
+	return in.Field()
+}
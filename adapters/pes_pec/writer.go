@@ -0,0 +1,522 @@
+/*
+** pes writer
+** serialises a payload back to a pes file. Everything the reader does not model - unknown header
+** fields, the object sections between the header and the pec block and the thumbnails - travels
+** with the payload as an Extension so an unedited payload is written back byte for byte
+ */
+
+package pes_pec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/threads"
+)
+
+// Format is the key of the pes extension in Payload.Ext
+const Format = "pes"
+
+// Extension keeps the parts of a pes file the payload does not model
+type Extension struct {
+	Hdr      Header // pes header including unknown fields
+	Sections []byte // undecoded pes object sections between the header and the pec block
+	Pec1     H1     // first pec header
+	Pec2     H2     // second pec header
+	Stitches []byte // encoded stitches as read - reused while the commands are unchanged
+	Trailer  []byte // thumbnails after the stitches
+	cmds     []shared.PCommand
+	threads  []shared.Thread
+}
+
+/*
+**
+** Header serialisation - the inverse of the Parse methods
+**
+ */
+
+var le = binary.LittleEndian
+
+// put_str appends a length prefixed string
+func put_str(b []byte, s string) []byte {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b = append(b, uint8(len(s)))
+	return append(b, s...)
+}
+
+// put_fixed appends s padded with spaces or cut to n bytes
+func put_fixed(b []byte, s string, n int) []byte {
+	if len(s) > n {
+		s = s[:n]
+	}
+	b = append(b, s...)
+	return append(b, bytes.Repeat([]byte{' '}, n-len(s))...)
+}
+
+// desc_bytes writes a description block
+func desc_bytes(b []byte, d *map[string]string) []byte {
+	var m map[string]string
+	if d != nil {
+		m = *d
+	}
+	for _, name := range []string{"Design", "Category", "Author", "Keywords", "Comments"} {
+		b = put_str(b, m[name])
+	}
+	return b
+}
+
+// ColorSub.Bytes serialises the color structure
+func (p ColorSub) Bytes() []byte {
+	var b []byte
+	b = put_str(b, string(p.Code))
+	r, g, bl, _ := p.Color.RGBA()
+	b = append(b, uint8(r>>8), uint8(g>>8), uint8(bl>>8), p.U1)
+	b = le.AppendUint32(b, p.ColType)
+	b = put_str(b, p.Desc)
+	b = put_str(b, p.Brand)
+	return put_str(b, p.Chart)
+}
+
+// Preamble.Bytes serialises the first 12 bytes of a pes file
+func (p Preamble) Bytes() []byte {
+	b := put_fixed(nil, p.Id, 4)
+	b = put_fixed(b, p.Ver, 4)
+	return le.AppendUint32(b, p.Offset)
+}
+
+// H_1.Bytes serialises the version 1 header
+func (h1 H_1) Bytes() []byte {
+	b := le.AppendUint16(nil, h1.Hoop)
+	b = le.AppendUint16(b, h1.EDA)
+	return le.AppendUint16(b, h1.Blk_count)
+}
+
+// H_2.Bytes serialises the version 2 header
+func (h2 H_2) Bytes() []byte {
+	b := le.AppendUint16(nil, h2.HoopW)
+	b = le.AppendUint16(b, h2.HoopH)
+	b = le.AppendUint16(b, h2.Rot)
+	return append(b, h2.unk...)
+}
+
+// H_3.Bytes serialises the version 3 header
+func (h3 H_3) Bytes() []byte {
+	b := le.AppendUint16(nil, h3.u1)
+	b = le.AppendUint16(b, h3.SubV)
+	b = le.AppendUint16(b, h3.HoopW)
+	b = le.AppendUint16(b, h3.HoopH)
+	b = le.AppendUint16(b, h3.Rot)
+	return append(b, h3.u2...)
+}
+
+// H_4.Bytes serialises the version 4 header
+func (h4 H_4) Bytes() []byte {
+	b := le.AppendUint16(nil, h4.u1)
+	b = le.AppendUint16(b, h4.SubV)
+	b = desc_bytes(b, h4.Desc)
+	b = le.AppendUint16(b, h4.u2)
+	b = le.AppendUint16(b, h4.HoopW)
+	b = le.AppendUint16(b, h4.HoopH)
+	b = le.AppendUint16(b, h4.Rot)
+	return append(b, h4.u3...)
+}
+
+// HP_1.Bytes serialises the first section of headers 5 and 6
+func (h HP_1) Bytes() []byte {
+	b := le.AppendUint16(nil, h.HoopInd)
+	b = le.AppendUint16(b, h.SubV)
+	b = desc_bytes(b, h.Desc)
+	return le.AppendUint16(b, h.HoopChg)
+}
+
+// HP_2.Bytes serialises the second section of headers 5 and 6
+func (h HP_2) Bytes() []byte {
+	b := le.AppendUint16(nil, h.HoopW)
+	b = le.AppendUint16(b, h.HoopH)
+	return le.AppendUint16(b, h.Rot)
+}
+
+// HP_3.Bytes serialises the third section of headers 5 and 6
+func (h HP_3) Bytes() []byte {
+	var b []byte
+	for _, v := range []uint16{h.BG, h.FG, h.Grid, h.Axes, h.Snap, h.Interv, h.u1, h.OptEntEx} {
+		b = le.AppendUint16(b, v)
+	}
+	b = put_str(b, h.Impath)
+	return append(b, h.Affline...)
+}
+
+// HP_4.Bytes serialises the fourth section of headers 5 and 6
+func (h HP_4) Bytes() []byte {
+	var b []byte
+	for _, blk := range [][]byte{h.Fill, h.Motif, h.Feather} {
+		b = le.AppendUint16(b, uint16(len(blk)))
+		b = append(b, blk...)
+	}
+	b = le.AppendUint16(b, uint16(len(h.Colors)))
+	for _, c := range h.Colors {
+		b = append(b, c.Bytes()...)
+	}
+	return le.AppendUint16(b, h.Obj)
+}
+
+// H_5.Bytes serialises the version 5 header
+func (h H_5) Bytes() []byte {
+	b := h.HP_1.Bytes()
+	b = append(b, h.HP_2.Bytes()...)
+	b = append(b, h.HP_3.Bytes()...)
+	return append(b, h.HP_4.Bytes()...)
+}
+
+// H_6.Bytes serialises the version 6 header
+func (h H_6) Bytes() []byte {
+	b := h.HP_1.Bytes()
+	b = le.AppendUint16(b, h.Cust)
+	b = append(b, h.HP_2.Bytes()...)
+	for _, v := range []uint16{h.DWidth, h.DHeight, h.DPWidth, h.DPHeight, h.u1} {
+		b = le.AppendUint16(b, v)
+	}
+	b = append(b, h.HP_3.Bytes()...)
+	return append(b, h.HP_4.Bytes()...)
+}
+
+// Header.Bytes serialises the whole pes header
+func (h Header) Bytes() []byte {
+	b := h.P.Bytes()
+	switch h.Ver {
+	case "0001":
+		b = append(b, h.H1.Bytes()...)
+	case "0020":
+		b = append(b, h.H2.Bytes()...)
+	case "0030":
+		b = append(b, h.H3.Bytes()...)
+	case "0040":
+		b = append(b, h.H4.Bytes()...)
+	case "0050":
+		b = append(b, h.H5.Bytes()...)
+	case "0060":
+		b = append(b, h.H6.Bytes()...)
+	}
+	return le.AppendUint32(b, h.tail)
+}
+
+// set_desc replaces the description block of the versions that have one
+func (h *Header) set_desc(d map[string]string) {
+	m := maps.Clone(d)
+	switch h.Ver {
+	case "0040":
+		h.H4.Desc = &m
+	case "0050":
+		h.H5.Desc = &m
+	case "0060":
+		h.H6.Desc = &m
+	}
+}
+
+// H1.Bytes serialises the first pec header. The padding follows the number of colors
+func (h H1) Bytes() []byte {
+	b := put_fixed(nil, h.Label, 19)
+	b = append(b, h.Ret)
+	b = append(b, h.u1...)
+	b = append(b, h.TWidth, h.THeight)
+	b = append(b, h.u2...)
+	b = append(b, uint8(len(h.ColIdx)-1))
+	b = append(b, h.ColIdx...)
+	pad := h.Pad
+	if n := 463 - len(h.ColIdx); len(pad) != n {
+		pad = bytes.Repeat([]byte{' '}, n)
+		copy(pad, h.Pad)
+	}
+	return append(b, pad...)
+}
+
+// H2.Bytes serialises the second pec header
+func (h H2) Bytes() []byte {
+	b := le.AppendUint16(nil, h.u1)
+	b = le.AppendUint16(b, h.TOffs)
+	b = le.AppendUint32(b, h.u2)
+	b = le.AppendUint16(b, uint16(h.Width))
+	b = le.AppendUint16(b, uint16(h.Height))
+	return append(b, h.u3...)
+}
+
+// set_stitch_len points the thumbnail offset past n bytes of stitches. The offset is 24 bits,
+// the top byte lives in u2
+func (h *H2) set_stitch_len(n int) {
+	offs := uint32(n + 20)
+	h.TOffs = uint16(offs)
+	h.u2 = h.u2&^0xff | offs>>16&0xff
+}
+
+/*
+**
+** Stitch encoding - the inverse of next_command
+**
+ */
+
+// pec_flag converts a command to the flag bits of the long format
+func pec_flag(c int) byte {
+	switch c {
+	case shared.Jump:
+		return 1
+	case shared.Trim:
+		return 2
+	}
+	return 0
+}
+
+// is_short tests if a move fits the 7 bit short format
+func is_short(v int) bool {
+	return v >= -64 && v <= 63
+}
+
+// encode_long appends a 12 bit move in the long format
+func encode_long(b []byte, flag byte, v int) []byte {
+	u := uint16(v) & 0x0fff
+	return append(b, is_cmd_mask|flag<<4|byte(u>>8), byte(u))
+}
+
+// encode_cmds converts commands to pec stitches. unit is payload units per 0.1mm. Moves are
+// rounded on the absolute needle position so that long designs do not drift
+func encode_cmds(cmds []shared.PCommand, unit float32) []byte {
+	var b []byte
+	var ax, ay float32 // needle position in payload units
+	var ix, iy int     // needle position as written
+	alt := byte(2)
+	for i, c := range cmds {
+		switch c.Command1 {
+		case shared.End:
+			return append(b, end_flag)
+		case shared.ColorChg:
+			// the first block's color is in the pec header
+			if i > 0 {
+				b = append(b, color_flag, 0xb0, alt)
+				alt = 3 - alt
+			}
+			continue
+		}
+		ax += c.Dx
+		ay += c.Dy
+		dx := int(math.Round(float64(ax/unit))) - ix
+		dy := int(math.Round(float64(ay/unit))) - iy
+		ix += dx
+		iy += dy
+		fx := pec_flag(c.Command1)
+		fy := pec_flag(c.Command2)
+
+		// the long format holds 12 bits so very long moves are split. A stitch only goes into the
+		// fabric at its end so the pieces before are jumps
+		n := max(1, int(math.Ceil(float64(max(abs(dx), abs(dy)))/2047)))
+		for k := 1; k <= n; k++ {
+			sx := dx*k/n - dx*(k-1)/n
+			sy := dy*k/n - dy*(k-1)/n
+			px := fx
+			if k < n && fx == 0 && fy == 0 {
+				px = pec_flag(shared.Jump)
+			}
+			if px == 0 && fy == 0 && is_short(sx) && is_short(sy) {
+				b = append(b, byte(sx)&0x7f, byte(sy)&0x7f)
+				continue
+			}
+			b = encode_long(b, px, sx)
+			b = encode_long(b, fy, sy)
+		}
+	}
+	return append(b, end_flag)
+}
+
+// abs of an int
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+/*
+**
+** Writing
+**
+ */
+
+// brother_indices maps the thread of each block to the pec palette of chart, the brother chart
+// when nil. A thread from the chart keeps its code, any other thread takes the nearest by color
+func brother_indices(p *shared.Payload, chart *threads.Chart, log io.Writer) []byte {
+	if chart == nil {
+		chart = threads.Builtin("Brother")
+	}
+	var idx []byte
+	for _, b := range p.Blocks {
+		t, ok := chart.Code(b.Thread.Code)
+		if !ok || !strings.EqualFold(b.Thread.Chart, chart.Name) {
+			t, _ = chart.Nearest(b.Thread.Color)
+		}
+		n, err := strconv.Atoi(t.Code)
+		if err != nil || n < 1 || n > 255 {
+			shared.Logf(log, "thread %q of the %s chart is not a pec color - using 1", t.Code, chart.Name)
+			n = 1
+		}
+		idx = append(idx, byte(n))
+	}
+	return idx
+}
+
+// set_colors replaces the thread list of the versions that have one with a thread per block.
+// Unknown fields of threads that were already there are kept
+func (h *Header) set_colors(ts []shared.Thread) {
+	var list *[]ColorSub
+	switch h.Ver {
+	case "0050":
+		list = &h.H5.Colors
+	case "0060":
+		list = &h.H6.Colors
+	default:
+		return
+	}
+	subs := make([]ColorSub, len(ts))
+	for i, t := range ts {
+		subs[i].ColType = 0xa
+		if i < len(*list) {
+			subs[i] = (*list)[i]
+		}
+		subs[i].Code = []byte(t.Code)
+		subs[i].Color = t.Color
+		subs[i].Desc = t.Name
+		subs[i].Brand = t.Brand
+		subs[i].Chart = t.Chart
+	}
+	*list = subs
+}
+
+// extents returns the bounds of the stitches in 0.1mm
+func extents(p *shared.Payload, unit float32) (minx, miny, maxx, maxy int) {
+	for _, pt := range p.Positions() {
+		x := int(math.Round(float64(pt.X / unit)))
+		y := int(math.Round(float64(pt.Y / unit)))
+		minx = min(minx, x)
+		miny = min(miny, y)
+		maxx = max(maxx, x)
+		maxy = max(maxy, y)
+	}
+	return
+}
+
+// new_extension describes a version 6 pes file with no objects for payloads that were not read
+// from one. Version 6 carries a thread list so thread names survive
+func new_extension(p *shared.Payload, unit float32) *Extension {
+	var ext Extension
+	minx, miny, maxx, maxy := extents(p, unit)
+	ext.Hdr.Ver = "0060"
+	ext.Hdr.P = Preamble{Id: "#PES", Ver: "0060"}
+	h := &ext.Hdr.H6
+	h.HoopInd = 1
+	h.SubV = '0'
+	h.HP_2.HoopW = 100
+	h.HP_2.HoopH = 100
+	if maxx-minx > 1000 || maxy-miny > 1000 {
+		h.HP_2.HoopW = 130
+		h.HP_2.HoopH = 180
+	}
+	h.DWidth = uint16(maxx - minx)
+	h.DHeight = uint16(maxy - miny)
+	h.BG = 7
+	h.FG = 19
+	h.Interv = 100
+	for _, v := range []float32{1, 0, 0, 1, 0, 0} { // identity transform
+		h.Affline = le.AppendUint32(h.Affline, math.Float32bits(v))
+	}
+	ext.Pec1.Ret = '\r'
+	ext.Pec1.u1 = append(bytes.Repeat([]byte{' '}, 12), 0xff, 0x00)
+	ext.Pec1.TWidth = 6
+	ext.Pec1.THeight = 38
+	ext.Pec1.u2 = bytes.Repeat([]byte{' '}, 12)
+	ext.Pec2.u2 = 0xf0ff3100
+	ext.Pec2.u3 = []byte{0xe0, 0x01, 0xb0, 0x01, 0x90, 0x00, 0x90, 0x00}
+	return &ext
+}
+
+// Encode_pes serialises a payload as a pes file. A payload read by Read_pes keeps the original
+// header, object sections and thumbnails - only the label, the description, the threads and the
+// stitches are rewritten and only when they were changed. The pes object sections are not
+// regenerated so software that reads them will still show the original stitches. Other payloads
+// are written as version 6 with no objects
+func Encode_pes(p *shared.Payload, o WriteOptions) []byte {
+	unit := p.Scale / 10
+	if unit <= 0 {
+		unit = scale(o.Scale) / 10
+	}
+	// make sure the blocks follow the color changes
+	ts := p.Threads()
+	p = p.Clone()
+	p.SetBlocks(ts)
+
+	ext, _ := p.Ext[Format].(*Extension)
+	head := p.Head
+	if ext == nil {
+		shared.Logf(o.Log, "not read from a pes file - writing a version 6 header")
+		ext = new_extension(p, unit)
+		if !strings.HasPrefix(head, ":") {
+			head = ":" + head
+		}
+	}
+	hdr := ext.Hdr
+	h1 := ext.Pec1
+	h2 := ext.Pec2
+	edited := !slices.Equal(p.Cmds, ext.cmds)
+	recolored := !slices.Equal(p.Threads(), ext.threads)
+
+	if p.Desc != nil {
+		hdr.set_desc(p.Desc)
+	}
+	h1.Label = "LA" + head
+	if edited || recolored {
+		h1.ColIdx = brother_indices(p, o.Chart, o.Log)
+	}
+	if recolored || len(p.Blocks) != len(ext.threads) {
+		hdr.set_colors(p.Threads())
+	}
+	st := ext.Stitches
+	trailer := ext.Trailer
+	if edited {
+		shared.Logf(o.Log, "stitches changed - rewriting %d commands", len(p.Cmds))
+		st = encode_cmds(p.Cmds, unit)
+		h2.set_stitch_len(len(st))
+		minx, miny, maxx, maxy := extents(p, unit)
+		h2.Width = int16(maxx - minx)
+		h2.Height = int16(maxy - miny)
+	}
+	if len(h1.ColIdx) != len(ext.Pec1.ColIdx) {
+		// blank thumbnails - one for the design and one per color
+		trailer = make([]byte, int(h1.TWidth)*int(h1.THeight)*(len(h1.ColIdx)+1))
+	}
+
+	// the pec block moves when the header changes size
+	hb := hdr.Bytes()
+	if len(ext.Hdr.raw) == 0 {
+		hdr.P.Offset = uint32(len(hb) + len(ext.Sections))
+	} else {
+		hdr.P.Offset = uint32(int(hdr.P.Offset) + len(hb) - len(ext.Hdr.raw))
+	}
+	hb = hdr.Bytes()
+
+	var out []byte
+	for _, b := range [][]byte{hb, ext.Sections, h1.Bytes(), h2.Bytes(), st, trailer} {
+		out = append(out, b...)
+	}
+	return out
+}
+
+// Write_pes writes a payload to a pes file
+func Write_pes(file string, p *shared.Payload, o WriteOptions) error {
+	return os.WriteFile(file, Encode_pes(p, o), 0644)
+}
@@ -0,0 +1,141 @@
+package pes_pec
+
+import (
+	"bytes"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/threads"
+)
+
+// Files read and written back unchanged must be the same bytes. The testdata files are laid out
+// by hand from the published pes and pec layouts - a version 1 file and a version 6 file with
+// object sections and thread metadata
+func TestRoundTrip(t *testing.T) {
+	files, _ := filepath.Glob("testdata/*.pes")
+	if len(files) == 0 {
+		t.Fatal("no test files")
+	}
+	for _, file := range files {
+		in, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Read_pes(file, DefaultReadOptions())
+		out := Encode_pes(p, DefaultWriteOptions())
+		if !bytes.Equal(in, out) {
+			t.Errorf("%s: wrote %d bytes that differ from the %d read", file, len(out), len(in))
+		}
+	}
+}
+
+// needles returns the needle position of every stitch that goes into the fabric
+func needles(p *shared.Payload) []shared.Point {
+	var l []shared.Point
+	pos := p.Positions()
+	for i, c := range p.Cmds {
+		if (c.Command1 == shared.Stitch || c.Command1 == 0) && c.Command2 != shared.Jump && c.Command2 != shared.Trim {
+			l = append(l, pos[i])
+		}
+	}
+	return l
+}
+
+// An edited file keeps the header bytes the payload does not model. The label, description,
+// threads and stitches are rewritten and a stitch too long for one pec move becomes jumps and a
+// stitch at its end. Pes has no title of its own - the pec label is the design name
+func TestEditedRoundTrip(t *testing.T) {
+	p := Read_pes("testdata/v6.pes", DefaultReadOptions())
+	ext := p.Ext[Format].(*Extension)
+	unit := p.Scale / 10 // payload units per 0.1mm
+
+	p.Head = ":edited"
+	p.Desc = maps.Clone(p.Desc)
+	p.Desc["Design"] = "edited"
+	p.Desc["Author"] = "tester"
+	brother := threads.Builtin("Brother")
+	red, _ := brother.Code("5")
+	p.Blocks[0].Thread = red
+	p.Cmds = slices.Clone(p.Cmds)
+	i := slices.IndexFunc(p.Cmds, func(c shared.PCommand) bool { return c.Command1 == shared.Stitch })
+	p.Cmds[i].Dx += 20 * unit
+	// 250mm out and back is more than the 204.7mm a long move holds
+	end := len(p.Cmds) - 1
+	long := 2500 * unit
+	p.Cmds = slices.Insert(p.Cmds, end,
+		shared.PCommand{Command1: shared.Stitch, Dx: long},
+		shared.PCommand{Command1: shared.Stitch, Dx: -long})
+
+	file := filepath.Join(t.TempDir(), "edited.pes")
+	if err := Write_pes(file, p, DefaultWriteOptions()); err != nil {
+		t.Fatal(err)
+	}
+	q := Read_pes(file, DefaultReadOptions())
+	qe := q.Ext[Format].(*Extension)
+
+	if strings.TrimSpace(q.Head) != ":edited" || q.Desc["Design"] != "edited" || q.Desc["Author"] != "tester" {
+		t.Errorf("label %q and description %v", q.Head, q.Desc)
+	}
+	if th := q.Threads()[0]; th.Code != red.Code || shared.Hex(th.Color) != shared.Hex(red.Color) {
+		t.Errorf("first thread %+v, want %+v", th, red)
+	}
+	if qe.Pec1.ColIdx[0] != 5 {
+		t.Errorf("pec color %d, want 5", qe.Pec1.ColIdx[0])
+	}
+	if got, want := q.Threads()[1:], p.Threads()[1:]; !slices.Equal(got, want) {
+		t.Errorf("other threads %v, want %v", got, want)
+	}
+
+	a, b := needles(p), needles(q)
+	if len(a) != len(b) {
+		t.Fatalf("%d stitches read back, want %d", len(b), len(a))
+	}
+	for k := range a {
+		if math.Abs(float64(a[k].X-b[k].X)) > float64(unit) || math.Abs(float64(a[k].Y-b[k].Y)) > float64(unit) {
+			t.Errorf("stitch %d at %v, want %v", k, b[k], a[k])
+		}
+	}
+	jumps := func(p *shared.Payload) int {
+		n := 0
+		for _, c := range p.Cmds {
+			if c.Command1 == shared.Jump {
+				n++
+			}
+		}
+		return n
+	}
+	for _, c := range q.Cmds {
+		if math.Abs(float64(c.Dx)) > 2047*float64(unit)+1e-3 {
+			t.Errorf("move %v is longer than a pec move", c)
+		}
+	}
+	if got, want := jumps(q), jumps(p)+2; got != want {
+		t.Errorf("%d jumps read back, want %d - one in front of each long stitch", got, want)
+	}
+
+	if !bytes.Equal(qe.Sections, ext.Sections) || !bytes.Equal(qe.Trailer, ext.Trailer) {
+		t.Error("object sections or thumbnails changed")
+	}
+	h, g := ext.Hdr.H6, qe.Hdr.H6
+	if h.Cust != g.Cust || h.u1 != g.u1 || h.HP_3.u1 != g.HP_3.u1 || !bytes.Equal(h.Affline, g.Affline) ||
+		!bytes.Equal(h.Fill, g.Fill) || !bytes.Equal(h.Motif, g.Motif) || !bytes.Equal(h.Feather, g.Feather) ||
+		h.Obj != g.Obj || h.HoopW != g.HoopW || h.HoopH != g.HoopH {
+		t.Errorf("unknown pes header fields changed:\n%+v\n%+v", h, g)
+	}
+	for k := range h.Colors {
+		if h.Colors[k].U1 != g.Colors[k].U1 || h.Colors[k].ColType != g.Colors[k].ColType {
+			t.Errorf("unknown fields of thread %d changed", k)
+		}
+	}
+	if !bytes.Equal(ext.Pec1.u1, qe.Pec1.u1) || !bytes.Equal(ext.Pec1.u2, qe.Pec1.u2) ||
+		ext.Pec2.u1 != qe.Pec2.u1 || ext.Pec2.u2&^0xff != qe.Pec2.u2&^0xff || !bytes.Equal(ext.Pec2.u3, qe.Pec2.u3) {
+		// the low byte of u2 holds the top of the thumbnail offset
+		t.Error("unknown pec header fields changed")
+	}
+}
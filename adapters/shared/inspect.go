@@ -0,0 +1,205 @@
+package shared
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Field describes a region of a file: a header, a struct inside it or a single value.
+// Offsets are from the start of whatever was inspected until Shift moves them
+type Field struct {
+	Name     string
+	Offset   uint32
+	Size     uint32
+	Raw      []byte
+	Value    any
+	Children []*Field
+}
+
+// Inspector builds a Field tree by walking the raw bytes of a struct in order
+type Inspector struct {
+	f   *Field
+	raw []byte
+	pos uint32
+}
+
+// NewInspector starts a tree for a struct whose bytes are raw
+func NewInspector(name string, raw []byte) *Inspector {
+	return &Inspector{
+		f:   &Field{Name: name},
+		raw: raw,
+		pos: 0,
+	}
+}
+
+// Add records a value that takes the next size bytes
+func (in *Inspector) Add(name string, size uint32, value any) {
+	in.f.Children = append(in.f.Children, &Field{
+		Name:   name,
+		Offset: in.pos,
+		Size:   size,
+		Raw:    in.slice(size),
+		Value:  value,
+	})
+	in.pos += size
+}
+
+// Sub records a nested struct at the current position
+func (in *Inspector) Sub(f *Field) {
+	f.Shift(in.pos)
+	in.f.Children = append(in.f.Children, f)
+	in.pos += f.Size
+}
+
+// Pos returns the offset of the next byte to be recorded
+func (in *Inspector) Pos() uint32 {
+	return in.pos
+}
+
+// Field finishes the tree
+func (in *Inspector) Field() *Field {
+	in.f.Size = in.pos
+	in.f.Raw = in.slice(in.pos)
+	in.f.Offset = 0
+	return in.f
+}
+
+// slice returns the next size bytes, clipped to what is available
+func (in *Inspector) slice(size uint32) []byte {
+	start := min(in.pos, uint32(len(in.raw)))
+	end := min(in.pos+size, uint32(len(in.raw)))
+	return in.raw[start:end]
+}
+
+// Shift moves a field and all its children by off bytes
+func (f *Field) Shift(off uint32) {
+	f.Offset += off
+	for _, c := range f.Children {
+		c.Shift(off)
+	}
+}
+
+// Find returns the first field with the given name, searching depth first
+func (f *Field) Find(name string) *Field {
+	if f.Name == name {
+		return f
+	}
+	for _, c := range f.Children {
+		if r := c.Find(name); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// Format returns the decoded value as text
+func (f *Field) Format() string {
+	switch v := f.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		return fmt.Sprintf("%X", v)
+	case uint8, uint16, uint32, uint64, int8, int16, int32, int64, int:
+		return fmt.Sprintf("%d 0x%X", v, v)
+	}
+	return fmt.Sprintf("%v", f.Value)
+}
+
+// Text writes the tree as an indented list
+func (f *Field) Text(w io.Writer) {
+	f.text(w, 0)
+}
+
+func (f *Field) text(w io.Writer, depth int) {
+	pad := strings.Repeat("\t", depth)
+	if len(f.Children) > 0 {
+		fmt.Fprintf(w, "%s%s: @0x%X size %d\n", pad, f.Name, f.Offset, f.Size)
+		for _, c := range f.Children {
+			c.text(w, depth+1)
+		}
+		return
+	}
+	if f.Value == nil {
+		fmt.Fprintf(w, "%s%s: @0x%X %d bytes\n", pad, f.Name, f.Offset, f.Size)
+		return
+	}
+	fmt.Fprintf(w, "%s%s: %s\n", pad, f.Name, f.Format())
+}
+
+// json_field is how a field is written as json - raw bytes are hex rather than base64
+type json_field struct {
+	Name     string        `json:"name"`
+	Offset   uint32        `json:"offset"`
+	Size     uint32        `json:"size"`
+	Raw      string        `json:"raw,omitempty"`
+	Value    any           `json:"value,omitempty"`
+	Children []*json_field `json:"children,omitempty"`
+}
+
+func (f *Field) to_json() *json_field {
+	j := &json_field{
+		Name:   f.Name,
+		Offset: f.Offset,
+		Size:   f.Size,
+	}
+	if len(f.Children) == 0 {
+		j.Raw = hex.EncodeToString(f.Raw)
+		j.Value = f.Value
+		if b, ok := f.Value.([]byte); ok {
+			j.Value = hex.EncodeToString(b)
+		}
+	}
+	for _, c := range f.Children {
+		j.Children = append(j.Children, c.to_json())
+	}
+	return j
+}
+
+// JSON writes the tree as an indented json document
+func (f *Field) JSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f.to_json())
+}
+
+// HexDump writes every leaf field as hex bytes annotated with its name and decoded value
+func (f *Field) HexDump(w io.Writer) {
+	f.hexdump(w, "")
+}
+
+func (f *Field) hexdump(w io.Writer, path string) {
+	name := f.Name
+	if path != "" {
+		name = path + "." + f.Name
+	}
+	if len(f.Children) > 0 {
+		for _, c := range f.Children {
+			c.hexdump(w, name)
+		}
+		return
+	}
+	if len(f.Raw) == 0 {
+		fmt.Fprintf(w, "%08X  %-47s  %s %s\n", f.Offset, fmt.Sprintf("(%d bytes)", f.Size), name, f.Format())
+		return
+	}
+	for i := 0; i < len(f.Raw); i += 16 {
+		end := min(i+16, len(f.Raw))
+		var hx []string
+		for _, b := range f.Raw[i:end] {
+			hx = append(hx, fmt.Sprintf("%02X", b))
+		}
+		note := ""
+		if i == 0 {
+			note = name
+			if _, ok := f.Value.([]byte); !ok {
+				note += " " + f.Format() // byte values are already on the left
+			}
+		}
+		fmt.Fprintf(w, "%08X  %-47s  %s\n", f.Offset+uint32(i), strings.Join(hx, " "), note)
+	}
+}
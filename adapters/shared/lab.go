@@ -0,0 +1,111 @@
+package shared
+
+import (
+	"image/color"
+	"math"
+)
+
+// Lab is a color in the CIE L*a*b* space under a D65 white point
+type Lab struct {
+	L float64
+	A float64
+	B float64
+}
+
+// linear undoes the sRGB gamma curve
+func linear(v uint32) float64 {
+	c := float64(v) / 0xffff
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+// lab_f is the cube root compression of the Lab transform
+func lab_f(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+// ToLab converts an sRGB color to Lab
+func ToLab(c color.Color) Lab {
+	r, g, b, _ := c.RGBA()
+	rl, gl, bl := linear(r), linear(g), linear(b)
+	x := (0.4124564*rl + 0.3575761*gl + 0.1804375*bl) / 0.95047
+	y := 0.2126729*rl + 0.7151522*gl + 0.0721750*bl
+	z := (0.0193339*rl + 0.1191920*gl + 0.9503041*bl) / 1.08883
+	fx, fy, fz := lab_f(x), lab_f(y), lab_f(z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// DeltaE2000 is the CIEDE2000 color difference. Around 1 is just noticeable, above 5 is a different color
+func DeltaE2000(p, q Lab) float64 {
+	rad := math.Pi / 180
+	c1 := math.Hypot(p.A, p.B)
+	c2 := math.Hypot(q.A, q.B)
+	cm := math.Pow((c1+c2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cm/(cm+math.Pow(25, 7))))
+	a1 := p.A * (1 + g)
+	a2 := q.A * (1 + g)
+	c1 = math.Hypot(a1, p.B)
+	c2 = math.Hypot(a2, q.B)
+	h1 := hue(p.B, a1)
+	h2 := hue(q.B, a2)
+
+	dl := q.L - p.L
+	dc := c2 - c1
+	dh := 0.0
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(dh/2*rad)
+
+	lm := (p.L + q.L) / 2
+	cm = (c1 + c2) / 2
+	hm := h1 + h2
+	if c1*c2 != 0 {
+		if math.Abs(h1-h2) <= 180 {
+			hm /= 2
+		} else if h1+h2 < 360 {
+			hm = (hm + 360) / 2
+		} else {
+			hm = (hm - 360) / 2
+		}
+	}
+	t := 1 - 0.17*math.Cos((hm-30)*rad) + 0.24*math.Cos(2*hm*rad) +
+		0.32*math.Cos((3*hm+6)*rad) - 0.20*math.Cos((4*hm-63)*rad)
+	sl := 1 + 0.015*(lm-50)*(lm-50)/math.Sqrt(20+(lm-50)*(lm-50))
+	sc := 1 + 0.045*cm
+	sh := 1 + 0.015*cm*t
+	c7 := math.Pow(cm, 7)
+	rt := -2 * math.Sqrt(c7/(c7+math.Pow(25, 7))) * math.Sin(60*math.Exp(-math.Pow((hm-275)/25, 2))*rad)
+
+	l := dl / sl
+	c := dc / sc
+	h := dH / sh
+	return math.Sqrt(l*l + c*c + h*h + rt*c*h)
+}
+
+// hue returns the angle of a Lab color in degrees from 0 to 360
+func hue(b, a float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// DeltaE is the perceptual difference between two colors
+func DeltaE(a, b color.Color) float64 {
+	return DeltaE2000(ToLab(a), ToLab(b))
+}
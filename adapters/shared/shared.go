@@ -6,11 +6,16 @@
 package shared
 
 import (
+	"fmt"
 	"image/color"
+	"io"
+	"maps"
+	"slices"
 	// "os"
 )
 
-// PCommand is a struct to hold a command - jump, trim, stitch etc
+// PCommand is a struct to hold a command - jump, trim, stitch etc. Color is only used by
+// color changes and is the index of the block the change starts
 type PCommand struct {
 	Command1 int
 	Command2 int
@@ -19,35 +24,52 @@ type PCommand struct {
 	Color    int
 }
 
+// Thread describes a thread - its color and where it comes from
+type Thread struct {
+	Color color.Color
+	Brand string
+	Code  string // catalogue code
+	Name  string
+	Chart string // catalogue the code belongs to
+}
+
+// Block is a run of commands sewn with one thread
+type Block struct {
+	Thread Thread
+	Start  int // index of the first command - the color change for all but the first block
+	End    int // index after the last command
+	Needle int // needle on multi needle machines, 0 when unassigned
+}
+
+// Hoop is the frame a design is sewn in. Sizes are in mm
+type Hoop struct {
+	Name   string
+	Width  float32 // sewing field
+	Height float32
+	Frame  float32 // width of the frame around the sewing field
+}
+
+// Known tests if the hoop has a size
+func (h Hoop) Known() bool {
+	return h.Width > 0 && h.Height > 0
+}
+
 // Payload captures metadata from file headers and also the stitch commands
 type Payload struct {
-	Width        float32
-	Height       float32
-	Rot          uint16
-	Desc         map[string]string
-	Title        string
-	BG           color.Color
-	Path         string
-	Palette      []color.Color
-	Palette_type bool
-	Head         string
-	Cmds         []PCommand
-}
-
-// ColorSub stores the color structure
-type ColorSub struct {
-	CodeLen  uint8
-	Code     []byte
-	Color    color.Color
-	U1       uint8
-	ColType  uint32
-	DescLen  uint8
-	Desc     string
-	BrandLen uint8
-	Brand    string
-	ChartLen uint8
-	Chart    string
-	Count    uint32
+	Width   float32
+	Height  float32
+	Scale   float32 // payload units per millimetre
+	Rot     uint16
+	Desc    map[string]string
+	Title   string
+	BG      color.Color
+	Path    string
+	Head    string
+	Hoop    Hoop // zero when the file does not say
+	Cmds    []PCommand
+	Blocks  []Block
+	Offsets []int          // byte offset in the source file of each command, -1 when not from the file. nil once edited
+	Ext     map[string]any // opaque data a reader keeps so the writer of the same format can reproduce it
 }
 
 // command constants
@@ -58,3 +80,120 @@ const (
 	ColorChg
 	End
 )
+
+// Logf writes a line of diagnostics to w. A nil w discards it
+func Logf(w io.Writer, format string, a ...any) {
+	if w != nil {
+		fmt.Fprintf(w, format+"\n", a...)
+	}
+}
+
+// Hex translates an image/color into a web style hex string
+func Hex(c color.Color) string {
+	R, G, B, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", R>>8, G>>8, B>>8)
+}
+
+// CommandName converts a command constant to a string
+func CommandName(c int) string {
+	switch c {
+	case 0:
+		return "None"
+	case Stitch:
+		return "Stitch"
+	case Jump:
+		return "Jump"
+	case Trim:
+		return "Trim"
+	case ColorChg:
+		return "ColorChg"
+	case End:
+		return "End"
+	}
+	return "unk"
+}
+
+// Point is an absolute position in payload units
+type Point struct {
+	X float32
+	Y float32
+}
+
+// Positions returns the absolute needle position after each command. Color changes do not move the needle
+func (p *Payload) Positions() []Point {
+	pts := make([]Point, len(p.Cmds))
+	var x, y float32
+	for i, c := range p.Cmds {
+		if c.Command1 != ColorChg {
+			x += c.Dx
+			y += c.Dy
+		}
+		pts[i] = Point{X: x, Y: y}
+	}
+	return pts
+}
+
+// SetBlocks splits the commands into blocks at each color change, numbers the changes by block
+// and assigns the threads in order. A color change as the very first command starts the first
+// block rather than a new one. Blocks without a thread repeat the last one and needles are kept
+// for blocks that already existed
+func (p *Payload) SetBlocks(threads []Thread) {
+	old := p.Blocks
+	p.Blocks = nil
+	start := 0
+	for i := range p.Cmds {
+		if p.Cmds[i].Command1 != ColorChg {
+			continue
+		}
+		if i > 0 {
+			p.Blocks = append(p.Blocks, Block{Start: start, End: i})
+			start = i
+		}
+		p.Cmds[i].Color = len(p.Blocks)
+	}
+	p.Blocks = append(p.Blocks, Block{Start: start, End: len(p.Cmds)})
+	for i := range p.Blocks {
+		switch {
+		case i < len(threads):
+			p.Blocks[i].Thread = threads[i]
+		case len(threads) > 0:
+			p.Blocks[i].Thread = threads[len(threads)-1]
+		}
+		if p.Blocks[i].Thread.Color == nil {
+			p.Blocks[i].Thread.Color = color.Black
+		}
+		if i < len(old) {
+			p.Blocks[i].Needle = old[i].Needle
+		}
+	}
+}
+
+// Clone returns a copy of the payload that can be edited without touching the original.
+// Extension data is shared as it is never modified
+func (p *Payload) Clone() *Payload {
+	q := *p
+	q.Cmds = slices.Clone(p.Cmds)
+	q.Blocks = slices.Clone(p.Blocks)
+	q.Offsets = slices.Clone(p.Offsets)
+	q.Desc = maps.Clone(p.Desc)
+	q.Ext = maps.Clone(p.Ext)
+	return &q
+}
+
+// Threads returns the thread of each block
+func (p *Payload) Threads() []Thread {
+	t := make([]Thread, len(p.Blocks))
+	for i, b := range p.Blocks {
+		t[i] = b.Thread
+	}
+	return t
+}
+
+// Colors returns the thread color of each block - index it with the Color of a color change
+func (p *Payload) Colors() []color.Color {
+	c := make([]color.Color, len(p.Blocks))
+	for i, b := range p.Blocks {
+		c[i] = b.Thread.Color
+	}
+	return c
+}
@@ -0,0 +1,188 @@
+package svg
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Options controls how strokes are turned into stitches. Lengths are in mm
+type Options struct {
+	StitchLen  float64 // running stitch length
+	SatinWidth float64 // strokes at least this wide are sewn as satin columns
+	SatinGap   float64 // distance between satin zig-zags along the stroke
+	Tolerance  float64 // maximum deviation when flattening curves
+	Scale      float32 // payload units per mm
+}
+
+// DefaultOptions returns sensible settings for small lettering and outlines
+func DefaultOptions() Options {
+	return Options{
+		StitchLen:  2.5,
+		SatinWidth: 1.5,
+		SatinGap:   0.4,
+		Tolerance:  0.1,
+		Scale:      3.0, // same units as the pes adapter
+	}
+}
+
+// valid returns the options with any setting that is not positive taken from DefaultOptions. A
+// zero stitch length or gap would never finish stitching
+func (o Options) valid() Options {
+	d := DefaultOptions()
+	if o.StitchLen <= 0 {
+		o.StitchLen = d.StitchLen
+	}
+	if o.SatinWidth <= 0 {
+		o.SatinWidth = d.SatinWidth
+	}
+	if o.SatinGap <= 0 {
+		o.SatinGap = d.SatinGap
+	}
+	if o.Tolerance <= 0 {
+		o.Tolerance = d.Tolerance
+	}
+	if o.Scale <= 0 {
+		o.Scale = d.Scale
+	}
+	return o
+}
+
+// running places stitches along a polyline no further than l apart. Corners are always stitched
+func running(poly []pt, l float64) []pt {
+	st := []pt{poly[0]}
+	for i := 1; i < len(poly); i++ {
+		a := poly[i-1]
+		b := poly[i]
+		n := int(math.Ceil(dist(a, b) / l))
+		for j := 1; j <= n; j++ {
+			t := float64(j) / float64(n)
+			st = append(st, pt{a.x + (b.x-a.x)*t, a.y + (b.y-a.y)*t})
+		}
+	}
+	return st
+}
+
+// satin zig-zags across a polyline, w wide with a swing every gap mm along the centre line
+func satin(poly []pt, w, gap float64) []pt {
+	var st []pt
+	half := w / 2
+	side := 1.0
+	carry := 0.0 // distance along the current segment to the next swing
+	for i := 1; i < len(poly); i++ {
+		a := poly[i-1]
+		b := poly[i]
+		l := dist(a, b)
+		if l == 0 {
+			continue
+		}
+		nx := -(b.y - a.y) / l
+		ny := (b.x - a.x) / l
+		d := carry
+		for ; d <= l; d += gap {
+			t := d / l
+			c := pt{a.x + (b.x-a.x)*t, a.y + (b.y-a.y)*t}
+			st = append(st, pt{c.x + nx*half*side, c.y + ny*half*side})
+			side = -side
+		}
+		carry = d - l
+	}
+	if len(st) == 0 {
+		return running(poly, w)
+	}
+	return st
+}
+
+// digitize converts strokes into a payload, one color block per stroke color
+func digitize(strokes []stroke, o Options) *shared.Payload {
+	var pay shared.Payload
+	pay.Scale = o.Scale
+
+	// gather the stitched runs of each color in order of first appearance
+	var cols []color.Color
+	var runs [][][]pt
+	for _, s := range strokes {
+		idx := -1
+		for i := range cols {
+			if shared.Hex(cols[i]) == shared.Hex(s.col) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			cols = append(cols, s.col)
+			runs = append(runs, nil)
+			idx = len(cols) - 1
+		}
+		for _, sub := range s.subs {
+			if s.width >= o.SatinWidth {
+				runs[idx] = append(runs[idx], satin(sub, s.width, o.SatinGap))
+			} else {
+				runs[idx] = append(runs[idx], running(sub, o.StitchLen))
+			}
+		}
+	}
+
+	// stitches are relative to the centre of the design
+	minx, miny := math.Inf(1), math.Inf(1)
+	maxx, maxy := math.Inf(-1), math.Inf(-1)
+	for _, blk := range runs {
+		for _, run := range blk {
+			for _, p := range run {
+				minx = math.Min(minx, p.x)
+				miny = math.Min(miny, p.y)
+				maxx = math.Max(maxx, p.x)
+				maxy = math.Max(maxy, p.y)
+			}
+		}
+	}
+	if len(cols) == 0 {
+		pay.Cmds = []shared.PCommand{{Command1: shared.End}}
+		return &pay
+	}
+	cx := (minx + maxx) / 2
+	cy := (miny + maxy) / 2
+	pay.Width = float32(maxx-minx) * o.Scale
+	pay.Height = float32(maxy-miny) * o.Scale
+
+	var cmds []shared.PCommand
+	var px, py float32 // needle position in payload units
+	emit := func(c int, p pt) {
+		x := float32(p.x-cx) * o.Scale
+		y := float32(p.y-cy) * o.Scale
+		cmds = append(cmds, shared.PCommand{Command1: c, Dx: x - px, Dy: y - py})
+		px = x
+		py = y
+	}
+	for i, blk := range runs {
+		cmds = append(cmds, shared.PCommand{Command1: shared.ColorChg, Color: i})
+		for _, run := range blk {
+			emit(shared.Jump, run[0])
+			for _, p := range run[1:] {
+				emit(shared.Stitch, p)
+			}
+		}
+	}
+	cmds = append(cmds, shared.PCommand{Command1: shared.End})
+	pay.Cmds = cmds
+	var threads []shared.Thread
+	for _, c := range cols {
+		threads = append(threads, shared.Thread{Color: c, Name: shared.Hex(c)})
+	}
+	pay.SetBlocks(threads)
+	return &pay
+}
+
+// Read_svg reads an svg file and digitizes its strokes into a payload. Options that are not
+// positive are taken from DefaultOptions
+func Read_svg(file string, o Options) *shared.Payload {
+	o = o.valid()
+	title, strokes, err := read_file(file, o.Tolerance)
+	if err != nil {
+		panic(err)
+	}
+	pay := digitize(strokes, o)
+	pay.Title = title
+	pay.Path = file
+	return pay
+}
@@ -0,0 +1,85 @@
+package svg
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+const doc = `<svg xmlns="http://www.w3.org/2000/svg" width="100mm" height="50mm" viewBox="0 0 100 50">
+  <title>Test</title>
+  <path d="M10 10 H60" stroke="#ff0000" stroke-width="0.5"/>
+  <g stroke="#0000ff" stroke-width="3">
+    <line x1="10" y1="30" x2="90" y2="30"/>
+  </g>
+  <path d="M0 0 L5 5" stroke="none"/>
+</svg>`
+
+func TestParseSvg(t *testing.T) {
+	title, strokes, err := parse_svg(strings.NewReader(doc), 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Test" || len(strokes) != 2 {
+		t.Fatalf("title %q and %d strokes, want Test and 2", title, len(strokes))
+	}
+	if shared.Hex(strokes[0].col) != "#ff0000" || strokes[0].width != 0.5 {
+		t.Errorf("first stroke %s %gmm, want #ff0000 0.5mm", shared.Hex(strokes[0].col), strokes[0].width)
+	}
+	if shared.Hex(strokes[1].col) != "#0000ff" || strokes[1].width != 3 {
+		t.Errorf("second stroke %s %gmm, want #0000ff 3mm", shared.Hex(strokes[1].col), strokes[1].width)
+	}
+	if _, _, err := parse_svg(strings.NewReader("<svg><path"), 0.1); err == nil {
+		t.Error("broken xml: no error")
+	}
+}
+
+func TestDigitize(t *testing.T) {
+	_, strokes, err := parse_svg(strings.NewReader(doc), 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := DefaultOptions()
+	p := digitize(strokes, o)
+	if len(p.Blocks) != 2 {
+		t.Fatalf("%d blocks, want 2", len(p.Blocks))
+	}
+	// the lines are 80mm long and 20mm apart, the satin reaching at most half its width past its line
+	if w, h := p.Width/o.Scale, p.Height/o.Scale; w < 79 || w > 81 || h < 20 || h > 21.5+0.01 {
+		t.Errorf("design is %gx%gmm, want about 80x20 to 80x21.5", w, h)
+	}
+
+	// the thin red stroke is running stitches no longer than StitchLen, the wide blue one satin
+	// swinging across its width
+	pos := p.Positions()
+	for b, blk := range p.Blocks {
+		n := 0
+		for i := blk.Start; i < blk.End; i++ {
+			c := p.Cmds[i]
+			if c.Command1 != shared.Stitch {
+				continue
+			}
+			n++
+			l := math.Hypot(float64(c.Dx), float64(c.Dy)) / float64(o.Scale)
+			if b == 0 && (l > o.StitchLen+1e-3 || math.Abs(float64(pos[i].Y-pos[i-1].Y)) > 1e-3) {
+				t.Errorf("running stitch %d is %.2fmm from %v to %v", i, l, pos[i-1], pos[i])
+			}
+			if b == 1 && math.Abs(float64(c.Dy)/float64(o.Scale)) < 2.9 {
+				t.Errorf("satin stitch %d only crosses %.2fmm", i, math.Abs(float64(c.Dy))/float64(o.Scale))
+			}
+		}
+		if n == 0 {
+			t.Errorf("block %d has no stitches", b)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	o := Options{StitchLen: -1, SatinGap: 0, SatinWidth: 2, Tolerance: 0.2, Scale: 10}.valid()
+	d := DefaultOptions()
+	if o.StitchLen != d.StitchLen || o.SatinGap != d.SatinGap || o.SatinWidth != 2 || o.Tolerance != 0.2 || o.Scale != 10 {
+		t.Errorf("valid gave %+v", o)
+	}
+}
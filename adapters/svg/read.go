@@ -0,0 +1,702 @@
+/*
+** svg adapter
+** routines to read simple vector artwork - paths, lines and polylines - from an svg file
+** The strokes are flattened into polylines in mm and then digitized into stitches
+ */
+
+package svg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pt is a point in mm
+type pt struct {
+	x float64
+	y float64
+}
+
+// stroke is a single flattened svg element
+type stroke struct {
+	col   color.Color
+	width float64 // mm
+	subs  [][]pt  // one polyline per subpath
+}
+
+// style holds the inherited presentation attributes
+type style struct {
+	stroke string
+	width  string
+	mat    matrix
+}
+
+/*
+**
+** Affine transforms
+**
+ */
+
+// matrix is an svg affine transform: a c e / b d f
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m * n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+// apply transforms a point
+func (m matrix) apply(p pt) pt {
+	return pt{m[0]*p.x + m[2]*p.y + m[4], m[1]*p.x + m[3]*p.y + m[5]}
+}
+
+// scale returns the mean scale factor of the transform - used for stroke widths
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// parse_transform reads an svg transform attribute
+func parse_transform(s string) matrix {
+	m := identity
+	for {
+		s = strings.TrimLeft(s, " ,\t\n")
+		open := strings.IndexByte(s, '(')
+		end := strings.IndexByte(s, ')')
+		if open < 0 || end < open {
+			return m
+		}
+		name := strings.TrimSpace(s[:open])
+		v := parse_numbers(s[open+1 : end])
+		n := len(v)
+		s = s[end+1:]
+		for len(v) < 6 {
+			v = append(v, 0)
+		}
+		var t matrix
+		switch name {
+		case "matrix":
+			t = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+		case "translate":
+			t = matrix{1, 0, 0, 1, v[0], v[1]}
+		case "scale":
+			if n == 1 {
+				v[1] = v[0]
+			}
+			t = matrix{v[0], 0, 0, v[1], 0, 0}
+		case "rotate":
+			a := v[0] * math.Pi / 180
+			r := matrix{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0}
+			t = matrix{1, 0, 0, 1, v[1], v[2]}.mul(r).mul(matrix{1, 0, 0, 1, -v[1], -v[2]})
+		case "skewX":
+			t = matrix{1, 0, math.Tan(v[0] * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = matrix{1, math.Tan(v[0] * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			t = identity
+		}
+		m = m.mul(t)
+	}
+}
+
+/*
+**
+** Attribute helpers
+**
+ */
+
+// parse_numbers splits a list of svg numbers - commas, spaces and sign changes are all separators
+func parse_numbers(s string) []float64 {
+	var nums []float64
+	sc := scanner{s: s}
+	for {
+		f, ok := sc.number()
+		if !ok {
+			return nums
+		}
+		nums = append(nums, f)
+	}
+}
+
+// parse_length converts an svg length to mm. Unitless lengths are css pixels
+func parse_length(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	units := map[string]float64{
+		"mm": 1,
+		"cm": 10,
+		"in": 25.4,
+		"pt": 25.4 / 72,
+		"pc": 25.4 / 6,
+		"px": 25.4 / 96,
+	}
+	mult := 25.4 / 96
+	for u, m := range units {
+		if strings.HasSuffix(s, u) {
+			s = strings.TrimSuffix(s, u)
+			mult = m
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f * mult, true
+}
+
+// parse_color converts an svg paint into a color. ok is false for none or an unusable paint
+func parse_color(s string) (color.Color, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	named := map[string]color.RGBA{
+		"black":   {0, 0, 0, 255},
+		"white":   {255, 255, 255, 255},
+		"red":     {255, 0, 0, 255},
+		"green":   {0, 128, 0, 255},
+		"lime":    {0, 255, 0, 255},
+		"blue":    {0, 0, 255, 255},
+		"yellow":  {255, 255, 0, 255},
+		"cyan":    {0, 255, 255, 255},
+		"magenta": {255, 0, 255, 255},
+		"orange":  {255, 165, 0, 255},
+		"purple":  {128, 0, 128, 255},
+		"gray":    {128, 128, 128, 255},
+		"grey":    {128, 128, 128, 255},
+		"navy":    {0, 0, 128, 255},
+		"maroon":  {128, 0, 0, 255},
+		"silver":  {192, 192, 192, 255},
+	}
+	if c, ok := named[s]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(s, "#") {
+		h := s[1:]
+		if len(h) == 3 {
+			h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+		}
+		v, err := strconv.ParseUint(h, 16, 32)
+		if err != nil || len(h) != 6 {
+			return nil, false
+		}
+		return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, true
+	}
+	if strings.HasPrefix(s, "rgb(") {
+		v := parse_numbers(strings.NewReplacer("rgb(", "", ")", "", "%", "").Replace(s))
+		if len(v) != 3 {
+			return nil, false
+		}
+		if strings.Contains(s, "%") {
+			for i := range v {
+				v[i] *= 2.55
+			}
+		}
+		return color.RGBA{uint8(v[0]), uint8(v[1]), uint8(v[2]), 255}, true
+	}
+	return nil, false
+}
+
+// inherit applies the presentation attributes and style of an element on top of its parent's
+func inherit(parent style, attrs []xml.Attr) style {
+	s := parent
+	for _, a := range attrs {
+		switch a.Name.Local {
+		case "stroke":
+			s.stroke = a.Value
+		case "stroke-width":
+			s.width = a.Value
+		case "transform":
+			s.mat = s.mat.mul(parse_transform(a.Value))
+		}
+	}
+	// style declarations override attributes
+	for _, a := range attrs {
+		if a.Name.Local != "style" {
+			continue
+		}
+		for _, decl := range strings.Split(a.Value, ";") {
+			k, v, ok := strings.Cut(decl, ":")
+			if !ok {
+				continue
+			}
+			switch strings.TrimSpace(k) {
+			case "stroke":
+				s.stroke = strings.TrimSpace(v)
+			case "stroke-width":
+				s.width = strings.TrimSpace(v)
+			}
+		}
+	}
+	return s
+}
+
+// attr returns the value of a named attribute
+func attr(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// attr_num returns a numeric attribute, 0 if missing
+func attr_num(attrs []xml.Attr, name string) float64 {
+	v := parse_numbers(attr(attrs, name))
+	if len(v) == 0 {
+		return 0
+	}
+	return v[0]
+}
+
+/*
+**
+** Path data
+**
+ */
+
+// scanner tokenises svg path data
+type scanner struct {
+	s   string
+	pos int
+}
+
+// skip moves past whitespace and commas
+func (sc *scanner) skip() {
+	for sc.pos < len(sc.s) && strings.IndexByte(" ,\t\r\n", sc.s[sc.pos]) >= 0 {
+		sc.pos++
+	}
+}
+
+// command returns the next path command letter if there is one
+func (sc *scanner) command() (byte, bool) {
+	sc.skip()
+	if sc.pos < len(sc.s) && strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", sc.s[sc.pos]) >= 0 {
+		c := sc.s[sc.pos]
+		sc.pos++
+		return c, true
+	}
+	return 0, false
+}
+
+// more reports whether the next token is a number
+func (sc *scanner) more() bool {
+	sc.skip()
+	return sc.pos < len(sc.s) && strings.IndexByte("+-.0123456789", sc.s[sc.pos]) >= 0
+}
+
+// number reads the next number
+func (sc *scanner) number() (float64, bool) {
+	sc.skip()
+	start := sc.pos
+	if sc.pos < len(sc.s) && (sc.s[sc.pos] == '+' || sc.s[sc.pos] == '-') {
+		sc.pos++
+	}
+	dot := false
+	for sc.pos < len(sc.s) {
+		c := sc.s[sc.pos]
+		if c >= '0' && c <= '9' {
+			sc.pos++
+		} else if c == '.' && !dot {
+			dot = true
+			sc.pos++
+		} else if (c == 'e' || c == 'E') && sc.pos > start {
+			sc.pos++
+			if sc.pos < len(sc.s) && (sc.s[sc.pos] == '+' || sc.s[sc.pos] == '-') {
+				sc.pos++
+			}
+		} else {
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(sc.s[start:sc.pos], 64)
+	if err != nil {
+		sc.pos = len(sc.s)
+		return 0, false
+	}
+	return f, true
+}
+
+// flag reads an arc flag - these may be packed without separators
+func (sc *scanner) flag() bool {
+	sc.skip()
+	if sc.pos < len(sc.s) {
+		c := sc.s[sc.pos]
+		sc.pos++
+		return c == '1'
+	}
+	return false
+}
+
+// flattener turns path segments into polylines in user units
+type flattener struct {
+	tol  float64 // max deviation in user units
+	subs [][]pt
+	cur  []pt
+}
+
+// move starts a new subpath
+func (f *flattener) move(p pt) {
+	f.close_sub()
+	f.cur = []pt{p}
+}
+
+// line adds a straight segment
+func (f *flattener) line(p pt) {
+	f.cur = append(f.cur, p)
+}
+
+// close_sub finishes the current subpath
+func (f *flattener) close_sub() {
+	if len(f.cur) > 1 {
+		f.subs = append(f.subs, f.cur)
+	}
+	f.cur = nil
+}
+
+// cubic flattens a cubic bezier by recursive subdivision
+func (f *flattener) cubic(p0, p1, p2, p3 pt, depth int) {
+	// flatness: distance of the control points from the chord
+	d1 := dist_line(p1, p0, p3)
+	d2 := dist_line(p2, p0, p3)
+	if depth > 16 || math.Max(d1, d2) <= f.tol {
+		f.line(p3)
+		return
+	}
+	p01 := mid(p0, p1)
+	p12 := mid(p1, p2)
+	p23 := mid(p2, p3)
+	p012 := mid(p01, p12)
+	p123 := mid(p12, p23)
+	m := mid(p012, p123)
+	f.cubic(p0, p01, p012, m, depth+1)
+	f.cubic(m, p123, p23, p3, depth+1)
+}
+
+// quad flattens a quadratic bezier by raising it to a cubic
+func (f *flattener) quad(p0, p1, p2 pt) {
+	c1 := pt{p0.x + 2.0/3.0*(p1.x-p0.x), p0.y + 2.0/3.0*(p1.y-p0.y)}
+	c2 := pt{p2.x + 2.0/3.0*(p1.x-p2.x), p2.y + 2.0/3.0*(p1.y-p2.y)}
+	f.cubic(p0, c1, c2, p2, 0)
+}
+
+// arc flattens an elliptical arc given in svg endpoint form
+func (f *flattener) arc(p0 pt, rx, ry, phi float64, large, sweep bool, p1 pt) {
+	if rx == 0 || ry == 0 {
+		f.line(p1)
+		return
+	}
+	rx = math.Abs(rx)
+	ry = math.Abs(ry)
+	phi = phi * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+
+	// endpoint to centre parameterisation - svg spec F.6.5
+	dx := (p0.x - p1.x) / 2
+	dy := (p0.y - p1.y) / 2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+	lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry)
+	if lambda > 1 {
+		rx *= math.Sqrt(lambda)
+		ry *= math.Sqrt(lambda)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	co := 0.0
+	if den != 0 {
+		co = math.Sqrt(math.Max(0, num/den))
+	}
+	if large == sweep {
+		co = -co
+	}
+	cx1 := co * rx * y1 / ry
+	cy1 := -co * ry * x1 / rx
+	cx := cos*cx1 - sin*cy1 + (p0.x+p1.x)/2
+	cy := sin*cx1 + cos*cy1 + (p0.y+p1.y)/2
+
+	theta := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	delta := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx) - theta
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	// enough segments to stay within tolerance of the larger radius
+	r := math.Max(rx, ry)
+	step := 2 * math.Acos(math.Max(-1, 1-f.tol/r))
+	n := 1
+	if step > 0 {
+		n = int(math.Ceil(math.Abs(delta) / step))
+	}
+	n = max(n, 1)
+	for i := 1; i <= n; i++ {
+		t := theta + delta*float64(i)/float64(n)
+		x := rx * math.Cos(t)
+		y := ry * math.Sin(t)
+		f.line(pt{cos*x - sin*y + cx, sin*x + cos*y + cy})
+	}
+}
+
+// parse_path flattens svg path data into polylines
+func parse_path(d string, tol float64) [][]pt {
+	f := flattener{tol: tol}
+	sc := scanner{s: d}
+	var cur, start, ctrl pt
+	var last byte
+
+	for {
+		cmd, ok := sc.command()
+		if !ok {
+			if !sc.more() || last == 0 {
+				break
+			}
+			// implicit repeat of the previous command. Numbers after a move or a close carry on
+			// as lines - from the start of the subpath after a close
+			cmd = last
+			switch cmd {
+			case 'M', 'Z':
+				cmd = 'L'
+			case 'm', 'z':
+				cmd = 'l'
+			}
+		}
+		rel := cmd >= 'a'
+		off := pt{}
+		if rel {
+			off = cur
+		}
+		num := func() float64 {
+			v, _ := sc.number()
+			return v
+		}
+		switch cmd {
+		case 'M', 'm':
+			cur = pt{off.x + num(), off.y + num()}
+			start = cur
+			f.move(cur)
+		case 'L', 'l':
+			cur = pt{off.x + num(), off.y + num()}
+			f.line(cur)
+		case 'H', 'h':
+			x := num()
+			if rel {
+				x += cur.x
+			}
+			cur = pt{x, cur.y}
+			f.line(cur)
+		case 'V', 'v':
+			y := num()
+			if rel {
+				y += cur.y
+			}
+			cur = pt{cur.x, y}
+			f.line(cur)
+		case 'C', 'c':
+			c1 := pt{off.x + num(), off.y + num()}
+			c2 := pt{off.x + num(), off.y + num()}
+			p := pt{off.x + num(), off.y + num()}
+			f.cubic(cur, c1, c2, p, 0)
+			ctrl = c2
+			cur = p
+		case 'S', 's':
+			c1 := cur
+			if strings.IndexByte("CcSs", last) >= 0 {
+				c1 = pt{2*cur.x - ctrl.x, 2*cur.y - ctrl.y}
+			}
+			c2 := pt{off.x + num(), off.y + num()}
+			p := pt{off.x + num(), off.y + num()}
+			f.cubic(cur, c1, c2, p, 0)
+			ctrl = c2
+			cur = p
+		case 'Q', 'q':
+			c := pt{off.x + num(), off.y + num()}
+			p := pt{off.x + num(), off.y + num()}
+			f.quad(cur, c, p)
+			ctrl = c
+			cur = p
+		case 'T', 't':
+			c := cur
+			if strings.IndexByte("QqTt", last) >= 0 {
+				c = pt{2*cur.x - ctrl.x, 2*cur.y - ctrl.y}
+			}
+			p := pt{off.x + num(), off.y + num()}
+			f.quad(cur, c, p)
+			ctrl = c
+			cur = p
+		case 'A', 'a':
+			rx, ry, phi := num(), num(), num()
+			large := sc.flag()
+			sweep := sc.flag()
+			p := pt{off.x + num(), off.y + num()}
+			f.arc(cur, rx, ry, phi, large, sweep, p)
+			cur = p
+		case 'Z', 'z':
+			f.line(start)
+			cur = start
+			f.close_sub()
+			f.cur = []pt{cur}
+		}
+		last = cmd
+	}
+	f.close_sub()
+	return f.subs
+}
+
+// mid returns the midpoint of two points
+func mid(a, b pt) pt {
+	return pt{(a.x + b.x) / 2, (a.y + b.y) / 2}
+}
+
+// dist returns the distance between two points
+func dist(a, b pt) float64 {
+	return math.Hypot(b.x-a.x, b.y-a.y)
+}
+
+// dist_line returns the distance of p from the line through a and b
+func dist_line(p, a, b pt) float64 {
+	l := dist(a, b)
+	if l == 0 {
+		return dist(p, a)
+	}
+	return math.Abs((b.x-a.x)*(a.y-p.y)-(a.x-p.x)*(b.y-a.y)) / l
+}
+
+/*
+**
+** Document reading
+**
+ */
+
+// parse_svg reads the stroked elements of an svg document. All coordinates are returned in mm
+func parse_svg(r io.Reader, tol float64) (string, []stroke, error) {
+	dec := xml.NewDecoder(r)
+	var strokes []stroke
+	var stack []style
+	var title string
+	in_title := false
+	cur := style{stroke: "none", width: "1", mat: identity}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, cur)
+			if t.Name.Local == "svg" && len(stack) == 1 {
+				cur.mat = root_matrix(t.Attr)
+			}
+			cur = inherit(cur, t.Attr)
+			in_title = t.Name.Local == "title"
+
+			var subs [][]pt
+			switch t.Name.Local {
+			case "path":
+				subs = parse_path(attr(t.Attr, "d"), tol/math.Max(cur.mat.scale(), 1e-9))
+			case "line":
+				subs = [][]pt{{
+					{attr_num(t.Attr, "x1"), attr_num(t.Attr, "y1")},
+					{attr_num(t.Attr, "x2"), attr_num(t.Attr, "y2")},
+				}}
+			case "polyline", "polygon":
+				v := parse_numbers(attr(t.Attr, "points"))
+				var poly []pt
+				for i := 0; i+1 < len(v); i += 2 {
+					poly = append(poly, pt{v[i], v[i+1]})
+				}
+				if t.Name.Local == "polygon" && len(poly) > 0 {
+					poly = append(poly, poly[0])
+				}
+				if len(poly) > 1 {
+					subs = [][]pt{poly}
+				}
+			}
+			if len(subs) == 0 {
+				continue
+			}
+			col, ok := parse_color(cur.stroke)
+			if !ok {
+				continue // not stroked so nothing to sew
+			}
+			w := 0.0
+			if v := parse_numbers(cur.width); len(v) > 0 {
+				w = v[0] * cur.mat.scale()
+			}
+			for i := range subs {
+				for j := range subs[i] {
+					subs[i][j] = cur.mat.apply(subs[i][j])
+				}
+			}
+			strokes = append(strokes, stroke{col: col, width: w, subs: subs})
+		case xml.CharData:
+			if in_title && title == "" {
+				title = strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			in_title = false
+			if len(stack) > 0 {
+				cur = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return title, strokes, nil
+}
+
+// root_matrix maps the user units of the root svg element onto mm using width, height and viewBox
+func root_matrix(attrs []xml.Attr) matrix {
+	px := 25.4 / 96
+	vb := parse_numbers(attr(attrs, "viewBox"))
+	w, wok := parse_length(attr(attrs, "width"))
+	h, hok := parse_length(attr(attrs, "height"))
+	if len(vb) != 4 || vb[2] == 0 || vb[3] == 0 {
+		return matrix{px, 0, 0, px, 0, 0}
+	}
+	sx := px
+	sy := px
+	if wok {
+		sx = w / vb[2]
+	}
+	if hok {
+		sy = h / vb[3]
+	}
+	if !wok && hok {
+		sx = sy
+	}
+	if wok && !hok {
+		sy = sx
+	}
+	return matrix{sx, 0, 0, sy, -vb[0] * sx, -vb[1] * sy}
+}
+
+// read_file parses an svg file from disk
+func read_file(file string, tol float64) (string, []stroke, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+	title, strokes, err := parse_svg(reader, tol)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return title, strokes, nil
+}
@@ -0,0 +1,151 @@
+package svg
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parse runs parse_path and fails if it does not finish
+func parse(t *testing.T, d string) [][]pt {
+	t.Helper()
+	done := make(chan [][]pt, 1)
+	go func() { done <- parse_path(d, 0.01) }()
+	select {
+	case subs := <-done:
+		return subs
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%q: parse_path did not finish", d)
+	}
+	return nil
+}
+
+// near tests if two points are within 1e-6
+func near(a, b pt) bool {
+	return math.Abs(a.x-b.x) < 1e-6 && math.Abs(a.y-b.y) < 1e-6
+}
+
+// same_subs fails unless the subpaths are the same points
+func same_subs(t *testing.T, d string, got, want [][]pt) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%q: %d subpaths %v, want %d %v", d, len(got), got, len(want), want)
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Fatalf("%q: subpath %d is %v, want %v", d, i, got[i], want[i])
+		}
+		for j := range want[i] {
+			if !near(got[i][j], want[i][j]) {
+				t.Errorf("%q: subpath %d point %d is %v, want %v", d, i, j, got[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+func TestParsePathLines(t *testing.T) {
+	square := [][]pt{{{10, 10}, {15, 10}, {15, 15}, {10, 15}, {10, 10}}}
+	for _, tc := range []struct {
+		d    string
+		want [][]pt
+	}{
+		{"M10 10 L15 10 L15 15 L10 15 Z", square},
+		{"m10 10 l5 0 l0 5 l-5 0 z", square},
+		{"M10,10 H15 V15 H10 Z", square},
+		{"M10 10 h5 v5 h-5 z", square},
+		{"M10 10 15 10 15 15 10 15 Z", square}, // lines follow a move implicitly
+		{"m10 10 5 0 0 5-5 0z", square},
+		{"M0 0 L10 0 Z 5 5", [][]pt{{{0, 0}, {10, 0}, {0, 0}}, {{0, 0}, {5, 5}}}},
+		{"M0 0 l10 0 z 5 5", [][]pt{{{0, 0}, {10, 0}, {0, 0}}, {{0, 0}, {5, 5}}}},
+		{"M0 0 L1e1 0 M0 5 L10 5", [][]pt{{{0, 0}, {10, 0}}, {{0, 5}, {10, 5}}}},
+	} {
+		same_subs(t, tc.d, parse(t, tc.d), tc.want)
+	}
+}
+
+// ends checks a single flattened subpath starts and ends where expected
+func ends(t *testing.T, d string, subs [][]pt, a, b pt) []pt {
+	t.Helper()
+	if len(subs) != 1 || len(subs[0]) < 3 {
+		t.Fatalf("%q: want one flattened subpath, got %v", d, subs)
+	}
+	s := subs[0]
+	if !near(s[0], a) || !near(s[len(s)-1], b) {
+		t.Errorf("%q: runs %v to %v, want %v to %v", d, s[0], s[len(s)-1], a, b)
+	}
+	return s
+}
+
+func TestParsePathCurves(t *testing.T) {
+	// a cubic with both controls at height 10 peaks at 7.5
+	for _, d := range []string{"M0 0 C0 10 10 10 10 0", "M0 0 c0 10 10 10 10 0"} {
+		s := ends(t, d, parse(t, d), pt{0, 0}, pt{10, 0})
+		top := 0.0
+		for _, p := range s {
+			top = max(top, p.y)
+		}
+		if math.Abs(top-7.5) > 0.02 {
+			t.Errorf("%q: peaks at %.3f, want 7.5", d, top)
+		}
+	}
+	// a quadratic with its control at 10 peaks at 5, and the smooth form mirrors it
+	for _, d := range []string{"M0 0 Q5 10 10 0", "M0 0 q5 10 10 0"} {
+		s := ends(t, d, parse(t, d), pt{0, 0}, pt{10, 0})
+		top := 0.0
+		for _, p := range s {
+			top = max(top, p.y)
+		}
+		if math.Abs(top-5) > 0.02 {
+			t.Errorf("%q: peaks at %.3f, want 5", d, top)
+		}
+	}
+	d := "M0 0 Q5 10 10 0 T20 0"
+	s := ends(t, d, parse(t, d), pt{0, 0}, pt{20, 0})
+	low := 0.0
+	for _, p := range s {
+		low = min(low, p.y)
+	}
+	if math.Abs(low+5) > 0.02 {
+		t.Errorf("%q: dips to %.3f, want -5", d, low)
+	}
+}
+
+func TestParsePathArcs(t *testing.T) {
+	// half circles of radius 10 about (10, 0) - y runs down, so a positive sweep bends up
+	for _, tc := range []struct {
+		d    string
+		side float64
+	}{
+		{"M0 0 A10 10 0 0 1 20 0", -1},
+		{"M0 0 a10 10 0 0 1 20 0", -1},
+		{"M0 0 A10 10 0 0 0 20 0", 1},
+		{"M0 0 A10 10 0 0120 0", -1}, // flags packed against the numbers
+	} {
+		s := ends(t, tc.d, parse(t, tc.d), pt{0, 0}, pt{20, 0})
+		for _, p := range s {
+			if r := dist(p, pt{10, 0}); math.Abs(r-10) > 0.02 {
+				t.Errorf("%q: %v is %.3f from the centre, want 10", tc.d, p, r)
+			}
+			if p.y*tc.side < -1e-9 {
+				t.Errorf("%q: %v is on the wrong side", tc.d, p)
+			}
+		}
+	}
+}
+
+func TestParsePathGarbage(t *testing.T) {
+	for _, d := range []string{
+		"", "hello", "M", "M0", "L10 10", "Z", "Z 5 5", "z1", "M0 0 L10 xyz 20",
+		"M0 0 A", "M0 0 C1 2", "M0 0 L . . .", "M0 0 L+-1 2", "M0 0 Z Z Z 1 2 3",
+		"M1e 2 L3e+ 4", strings.Repeat("M0 0 L1 1 z 2 ", 100),
+	} {
+		for _, sub := range parse(t, d) {
+			for _, p := range sub {
+				if math.IsNaN(p.x) || math.IsNaN(p.y) {
+					t.Errorf("%q: NaN point in %v", d, sub)
+				}
+			}
+		}
+	}
+}
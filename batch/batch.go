@@ -0,0 +1,392 @@
+/*
+** batch
+** renders thumbnails and previews of many designs and converts them to other formats on a pool
+** of workers. Every file gets a result in a report that can be saved as json
+ */
+
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/convert"
+	"github.com/emblib/render"
+)
+
+// Options controls a batch run
+type Options struct {
+	Workers int                  // files worked on at once, 0 for one per cpu
+	OutDir  string               // where outputs go, "" to put them beside each input
+	Thumb   int                  // thumbnail size in pixels, 0 for none
+	Preview int                  // preview size in pixels, 0 for none
+	Formats []string             // names of the formats to convert to
+	Convert convert.Options      // how inputs are read and outputs written
+	Render  render.RenderOptions // Width and Height are set for thumbnails and previews
+	// OnResult is called with each result as it finishes, one at a time
+	OnResult func(Result)
+}
+
+// DefaultOptions returns 128 pixel thumbnails and 800 pixel previews with no conversion
+func DefaultOptions() Options {
+	return Options{
+		Workers:  0,
+		OutDir:   "",
+		Thumb:    128,
+		Preview:  800,
+		Formats:  nil,
+		Convert:  convert.DefaultOptions(),
+		Render:   render.DefaultRenderOptions(),
+		OnResult: nil,
+	}
+}
+
+// Output is one file made from an input
+type Output struct {
+	Kind string `json:"kind"` // thumbnail, preview or the name of a format
+	File string `json:"file"`
+	Err  string `json:"error,omitempty"`
+}
+
+// Result is what happened to one input
+type Result struct {
+	In      string        `json:"in"`
+	Format  string        `json:"format,omitempty"`
+	Stats   *render.Stats `json:"stats,omitempty"`
+	Outputs []Output      `json:"outputs,omitempty"`
+	Err     string        `json:"error,omitempty"` // the file could not be read or was not worked on
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+// Failed tests if the input or any of its outputs failed
+func (r Result) Failed() bool {
+	if r.Err != "" {
+		return true
+	}
+	for _, o := range r.Outputs {
+		if o.Err != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Report is the result of every input in the order they were given
+type Report struct {
+	Started time.Time     `json:"started"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Files   int           `json:"files"`
+	Failed  int           `json:"failed"`
+	Results []Result      `json:"results"`
+}
+
+// WriteJSON writes the report as indented json
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+/*
+**
+** Inputs
+**
+ */
+
+// Inputs expands directories and glob patterns into a list of files. Directories are searched
+// for files in any readable format, patterns that match nothing are kept so they report an error
+func Inputs(patterns ...string) ([]string, error) {
+	var l []string
+	seen := map[string]bool{}
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			l = append(l, f)
+		}
+	}
+	for _, pat := range patterns {
+		if fi, err := os.Stat(pat); err == nil && fi.IsDir() {
+			err = filepath.WalkDir(pat, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if f := convert.Lookup(path); !d.IsDir() && f != nil && f.Read != nil {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m, err := filepath.Glob(pat)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pat, err)
+		}
+		if len(m) == 0 {
+			add(pat)
+		}
+		for _, f := range m {
+			add(f)
+		}
+	}
+	return l, nil
+}
+
+/*
+**
+** Running
+**
+ */
+
+// Run works on every input with a pool of workers until they are done or ctx is cancelled.
+// Inputs not started when ctx is cancelled get its error as their result and the error is
+// returned with the report
+func Run(ctx context.Context, inputs []string, o Options) (Report, error) {
+	r := Report{Started: time.Now(), Files: len(inputs), Results: make([]Result, len(inputs))}
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if o.OutDir != "" {
+		if err := os.MkdirAll(o.OutDir, 0755); err != nil {
+			return r, err
+		}
+	}
+	plans := outputs(inputs, o)
+
+	type done struct {
+		k   int
+		res Result
+	}
+	jobs := make(chan int)
+	results := make(chan done)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range jobs {
+				results <- done{k, job(ctx, inputs[k], plans[k], o)}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for k := range inputs {
+			select {
+			case jobs <- k:
+			case <-ctx.Done():
+				for ; k < len(inputs); k++ {
+					results <- done{k, Result{In: inputs[k], Err: ctx.Err().Error()}}
+				}
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// results arrive until the workers are done - cancelled inputs are sent before jobs closes
+	for d := range results {
+		r.Results[d.k] = d.res
+		if d.res.Failed() {
+			r.Failed++
+		}
+		if o.OnResult != nil {
+			o.OnResult(d.res)
+		}
+	}
+	r.Elapsed = time.Since(r.Started)
+	return r, ctx.Err()
+}
+
+// abs makes a file name absolute so names can be compared
+func abs(file string) string {
+	a, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Clean(file)
+	}
+	return a
+}
+
+// within tests if file is dir or inside it
+func within(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// common_dir returns the deepest directory holding every input
+func common_dir(inputs []string) string {
+	if len(inputs) == 0 {
+		return ""
+	}
+	root := filepath.Dir(abs(inputs[0]))
+	for _, in := range inputs[1:] {
+		for d := filepath.Dir(abs(in)); !within(root, d); {
+			up := filepath.Dir(root)
+			if up == root {
+				break
+			}
+			root = up
+		}
+	}
+	return root
+}
+
+// format finds a registered format by name
+func format(name string) *convert.Format {
+	for _, f := range convert.Formats() {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// outputs names the files made from each input. Names keep the extension of the input and, with
+// OutDir, its path below the directory the inputs share so x.pes and x.jef, or x.pes in two
+// directories, do not write the same file. An output that would replace an input or a file
+// already claimed by an earlier input is refused
+func outputs(inputs []string, o Options) [][]Output {
+	root := common_dir(inputs)
+	ins := map[string]bool{}
+	for _, in := range inputs {
+		ins[abs(in)] = true
+	}
+	claimed := map[string]string{} // output file to the input making it
+	plans := make([][]Output, len(inputs))
+	for k, in := range inputs {
+		base := in
+		if o.OutDir != "" {
+			rel, err := filepath.Rel(root, abs(in))
+			if err != nil {
+				rel = filepath.Base(in)
+			}
+			base = filepath.Join(o.OutDir, rel)
+		}
+		var l []Output
+		for _, im := range []struct {
+			kind string
+			size int
+		}{{"thumbnail", o.Thumb}, {"preview", o.Preview}} {
+			if im.size > 0 {
+				l = append(l, Output{Kind: im.kind, File: base + "." + im.kind + ".png"})
+			}
+		}
+		for _, name := range o.Formats {
+			to := format(name)
+			if to == nil || to.Write == nil || len(to.Exts) == 0 {
+				l = append(l, Output{Kind: name, Err: fmt.Sprintf("%s: cannot write this format", name)})
+				continue
+			}
+			l = append(l, Output{Kind: name, File: base + to.Exts[0]})
+		}
+		for i := range l {
+			if l[i].Err != "" {
+				continue
+			}
+			f := abs(l[i].File)
+			switch by, ok := claimed[f]; {
+			case ins[f]:
+				l[i].Err = fmt.Sprintf("%s: would replace an input", l[i].File)
+			case ok:
+				l[i].Err = fmt.Sprintf("%s: already made from %s", l[i].File, by)
+			default:
+				claimed[f] = in
+			}
+		}
+		plans[k] = l
+	}
+	return plans
+}
+
+// job reads one input and makes the outputs planned for it
+func job(ctx context.Context, in string, plan []Output, o Options) (res Result) {
+	start := time.Now()
+	res.In = in
+	defer func() { res.Elapsed = time.Since(start) }()
+	if err := ctx.Err(); err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	from := convert.Lookup(in)
+	if from == nil || from.Read == nil {
+		res.Err = fmt.Sprintf("%s: cannot read this format", in)
+		return res
+	}
+	res.Format = from.Name
+	p, err := from.Read(in, o.Convert)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	s := render.Statistics(p)
+	res.Stats = &s
+
+	for _, out := range plan {
+		if ctx.Err() != nil {
+			break
+		}
+		if out.Err == "" {
+			out.Err = make_output(p, out, o)
+		}
+		res.Outputs = append(res.Outputs, out)
+	}
+	if err := ctx.Err(); err != nil && res.Err == "" {
+		res.Err = err.Error()
+	}
+	return res
+}
+
+// make_output writes one planned output of p and returns any error as text
+func make_output(p *shared.Payload, out Output, o Options) string {
+	err := os.MkdirAll(filepath.Dir(out.File), 0755)
+	if err == nil {
+		switch out.Kind {
+		case "thumbnail":
+			err = picture(p, out.File, o.Thumb, o.Render)
+		case "preview":
+			err = picture(p, out.File, o.Preview, o.Render)
+		default:
+			_, err = convert.Save(p, out.File, o.Convert)
+		}
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// picture renders p to fit a square of size pixels and writes it as a png
+func picture(p *shared.Payload, file string, size int, ro render.RenderOptions) error {
+	ro.Width = size
+	ro.Height = size
+	img, err := render.Render(p, ro)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
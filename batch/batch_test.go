@@ -0,0 +1,212 @@
+package batch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fixtures copies test designs into a fresh directory. Names ending in .pes or .jef take the
+// pes or jef fixture and may include a subdirectory
+func fixtures(t *testing.T, names ...string) (string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	var l []string
+	for _, name := range names {
+		src := "../adapters/pes_pec/testdata/v1.pes"
+		if strings.HasSuffix(name, ".jef") {
+			src = "../adapters/jef/testdata/three.jef"
+		}
+		b, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(f, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		l = append(l, f)
+	}
+	return dir, l
+}
+
+// outputs_of returns every output file of a result by kind
+func outputs_of(t *testing.T, res Result) map[string]string {
+	t.Helper()
+	m := map[string]string{}
+	for _, o := range res.Outputs {
+		m[o.Kind] = o.File
+	}
+	return m
+}
+
+func TestRun(t *testing.T) {
+	dir, ins := fixtures(t, "a.pes", "b.jef", "c.pes", "d.jef", "sub/e.pes")
+	out := filepath.Join(dir, "out")
+	o := DefaultOptions()
+	o.Workers = 3
+	o.OutDir = out
+	o.Thumb = 32
+	o.Preview = 64
+	o.Formats = []string{"pes", "jef"}
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	o.OnResult = func(res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[res.In] = true
+	}
+	r, err := Run(context.Background(), ins, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Files != len(ins) || r.Failed != 0 || len(seen) != len(ins) {
+		t.Fatalf("%d files, %d failed, %d seen: %+v", r.Files, r.Failed, len(seen), r.Results)
+	}
+	for k, res := range r.Results {
+		if res.In != ins[k] || res.Stats == nil || res.Stats.Stitches == 0 {
+			t.Errorf("result %d: %+v", k, res)
+		}
+		files := outputs_of(t, res)
+		if len(files) != 4 {
+			t.Errorf("%s: outputs %v", res.In, res.Outputs)
+		}
+		for kind, f := range files {
+			fi, err := os.Stat(f)
+			if err != nil || fi.Size() == 0 {
+				t.Errorf("%s: %s %s missing: %v", res.In, kind, f, err)
+			}
+			if !strings.HasPrefix(f, out+string(filepath.Separator)) {
+				t.Errorf("%s: %s written outside %s", res.In, f, out)
+			}
+		}
+	}
+	if f := outputs_of(t, r.Results[4])["jef"]; f != filepath.Join(out, "sub", "e.pes.jef") {
+		t.Errorf("sub/e.pes converted to %s", f)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	_, ins := fixtures(t, "a.pes", "b.pes", "c.pes", "d.pes")
+	o := DefaultOptions()
+	o.Workers = 1
+	o.Thumb = 64
+	o.Preview = 0
+
+	// cancelled before it starts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, err := Run(ctx, ins, o)
+	if err != context.Canceled {
+		t.Errorf("Run returned %v, want %v", err, context.Canceled)
+	}
+	for _, res := range r.Results {
+		if res.Err != context.Canceled.Error() || len(res.Outputs) != 0 {
+			t.Errorf("%s: %+v", res.In, res)
+		}
+	}
+	if r.Failed != len(ins) {
+		t.Errorf("%d failed, want %d", r.Failed, len(ins))
+	}
+
+	// cancelled once the first input is done. The one worker may already have the second input,
+	// which finishes or stops as it may, but the rest are never worked on
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	o.OnResult = func(Result) { cancel() }
+	r, err = Run(ctx, ins, o)
+	if err != context.Canceled {
+		t.Errorf("Run returned %v, want %v", err, context.Canceled)
+	}
+	if r.Results[0].Failed() {
+		t.Errorf("first input failed: %+v", r.Results[0])
+	}
+	if res := r.Results[1]; res.In != ins[1] || res.Failed() && res.Err != context.Canceled.Error() {
+		t.Errorf("second input: %+v", res)
+	}
+	for _, res := range r.Results[2:] {
+		if res.In == "" || res.Err != context.Canceled.Error() || len(res.Outputs) != 0 {
+			t.Errorf("%s: %+v", res.In, res)
+		}
+		if _, err := os.Stat(res.In + ".thumbnail.png"); err == nil {
+			t.Errorf("%s: thumbnail made after the cancel", res.In)
+		}
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	dir, ins := fixtures(t, "x.pes", "x.jef", "one/y.pes", "two/y.pes")
+	o := DefaultOptions()
+	o.OutDir = filepath.Join(dir, "out")
+	o.Formats = []string{"jef", "pes", "nope"}
+	plans := outputs(ins, o)
+	claimed := map[string]bool{}
+	for k, plan := range plans {
+		if len(plan) != 5 {
+			t.Fatalf("%s: plan %v", ins[k], plan)
+		}
+		for _, out := range plan {
+			if out.Kind == "nope" {
+				if out.Err == "" {
+					t.Errorf("%s: nope has no error", ins[k])
+				}
+				continue
+			}
+			if out.Err != "" {
+				t.Errorf("%s: %s", ins[k], out.Err)
+			}
+			if claimed[out.File] {
+				t.Errorf("%s: %s made twice", ins[k], out.File)
+			}
+			claimed[out.File] = true
+		}
+	}
+	for _, want := range []string{"x.pes.jef", "x.jef.pes", "x.pes.thumbnail.png", "x.jef.thumbnail.png",
+		"one/y.pes.jef", "two/y.pes.jef"} {
+		if !claimed[filepath.Join(o.OutDir, filepath.FromSlash(want))] {
+			t.Errorf("no %s planned", want)
+		}
+	}
+
+	// the same input twice claims its outputs once
+	plans = outputs([]string{ins[0], ins[0]}, o)
+	for _, out := range plans[1] {
+		if out.Kind != "nope" && !strings.Contains(out.Err, "already made from") {
+			t.Errorf("second %s: %+v", out.Kind, out)
+		}
+	}
+}
+
+func TestOutputReplacesInput(t *testing.T) {
+	// x.pes converted to jef beside itself is x.pes.jef, which is another input
+	_, ins := fixtures(t, "x.pes", "x.pes.jef")
+	o := DefaultOptions()
+	o.Thumb = 0
+	o.Preview = 0
+	o.Formats = []string{"jef"}
+	before, err := os.ReadFile(ins[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := Run(context.Background(), ins, o)
+	out := r.Results[0].Outputs
+	if len(out) != 1 || !strings.Contains(out[0].Err, "would replace an input") {
+		t.Fatalf("x.pes outputs %+v", out)
+	}
+	if !r.Results[0].Failed() || r.Failed != 1 {
+		t.Errorf("%d failed, want x.pes", r.Failed)
+	}
+	after, err := os.ReadFile(ins[1])
+	if err != nil || string(after) != string(before) {
+		t.Errorf("x.pes.jef was changed: %v", err)
+	}
+	if r.Results[1].Failed() {
+		t.Errorf("x.pes.jef: %+v", r.Results[1])
+	}
+}
@@ -0,0 +1,181 @@
+/*
+** convert
+** a registry of the formats the adapters handle, looked up by file extension, and conversion
+** between them. Conversion normalises trims to a policy on the way through, turning trim commands
+** into jump runs and back when the two sides mark trims differently
+ */
+
+package convert
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emblib/adapters/interchange"
+	"github.com/emblib/adapters/jef"
+	"github.com/emblib/adapters/pes_pec"
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/adapters/svg"
+	"github.com/emblib/process"
+)
+
+// Format describes a file format. Read or Write is nil when the format cannot be read or written
+type Format struct {
+	Name  string
+	Exts  []string // lower case with the dot
+	Read  func(file string, o Options) (*shared.Payload, error)
+	Write func(file string, p *shared.Payload, o Options) error
+}
+
+// Options controls a conversion and is handed to the adapter of each format. Zero adapter
+// options take the adapter defaults
+type Options struct {
+	Trims    process.TrimPolicy // In and Out set how the input and output mark trims
+	PesRead  pes_pec.ReadOptions
+	PesWrite pes_pec.WriteOptions
+	JefRead  jef.ReadOptions
+	JefWrite jef.WriteOptions
+	Svg      svg.Options
+}
+
+// DefaultOptions returns the defaults of every adapter and leaves trims as they are
+func DefaultOptions() Options {
+	return Options{
+		Trims:    process.TrimPolicy{},
+		PesRead:  pes_pec.DefaultReadOptions(),
+		PesWrite: pes_pec.DefaultWriteOptions(),
+		JefRead:  jef.DefaultReadOptions(),
+		JefWrite: jef.DefaultWriteOptions(),
+		Svg:      svg.DefaultOptions(),
+	}
+}
+
+var formats []*Format
+
+func init() {
+	Register(&Format{Name: "pes", Exts: []string{".pes"},
+		Read: reader(func(file string, o Options) *shared.Payload {
+			return pes_pec.Read_pes(file, o.PesRead)
+		}),
+		Write: func(file string, p *shared.Payload, o Options) error {
+			return pes_pec.Write_pes(file, p, o.PesWrite)
+		}})
+	Register(&Format{Name: "jef", Exts: []string{".jef"},
+		Read: reader(func(file string, o Options) *shared.Payload {
+			return jef.Read_jef(file, o.JefRead)
+		}),
+		Write: func(file string, p *shared.Payload, o Options) error {
+			return jef.Write_jef(file, p, o.JefWrite)
+		}})
+	Register(&Format{Name: "svg", Exts: []string{".svg"}, Read: reader(func(file string, o Options) *shared.Payload {
+		return svg.Read_svg(file, o.Svg)
+	})})
+	Register(&Format{Name: "json", Exts: []string{".json"}, Read: read_json, Write: writer(interchange.Write_json)})
+	Register(&Format{Name: "csv", Exts: []string{".csv"}, Write: writer(interchange.Write_csv)})
+}
+
+// Register adds a format, replacing any format with the same name
+func Register(f *Format) {
+	for i := range formats {
+		if formats[i].Name == f.Name {
+			formats[i] = f
+			return
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Formats returns the registered formats
+func Formats() []*Format {
+	return formats
+}
+
+// Lookup finds the format of a file by its extension
+func Lookup(file string) *Format {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, f := range formats {
+		for _, e := range f.Exts {
+			if e == ext {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// reader turns an adapter reader that panics into one that returns an error
+func reader(read func(string, Options) *shared.Payload) func(string, Options) (*shared.Payload, error) {
+	return func(file string, o Options) (p *shared.Payload, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s: %v", file, r)
+			}
+		}()
+		return read(file, o), nil
+	}
+}
+
+// writer turns a stream writer into a file writer. Stream writers take no options
+func writer(write func(io.Writer, *shared.Payload) error) func(string, *shared.Payload, Options) error {
+	return func(file string, p *shared.Payload, _ Options) error {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		err = write(f, p)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// read_json reads an interchange document
+func read_json(file string, _ Options) (*shared.Payload, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return interchange.Read_json(f)
+}
+
+// Read reads a file in any registered format
+func Read(file string, o Options) (*shared.Payload, error) {
+	f := Lookup(file)
+	if f == nil || f.Read == nil {
+		return nil, fmt.Errorf("%s: cannot read this format", file)
+	}
+	return f.Read(file, o)
+}
+
+// Save normalises the trims of p and writes it in the format of out. The payload written is
+// returned
+func Save(p *shared.Payload, out string, o Options) (*shared.Payload, error) {
+	to := Lookup(out)
+	if to == nil || to.Write == nil {
+		return nil, fmt.Errorf("%s: cannot write this format", out)
+	}
+	p, _ = process.NormalizeTrims(p, o.Trims)
+	err := to.Write(out, p, o)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Convert reads in, normalises its trims and writes it in the format of out. The payload
+// written is returned
+func Convert(in, out string, o Options) (*shared.Payload, error) {
+	if to := Lookup(out); to == nil || to.Write == nil {
+		return nil, fmt.Errorf("%s: cannot write this format", out)
+	}
+	p, err := Read(in, o)
+	if err != nil {
+		return nil, err
+	}
+	return Save(p, out, o)
+}
@@ -1,30 +1,17 @@
+/*
+** engine
+** runs a composer over a payload and shows the result. The fyne composers and the viewer live
+** here, drawing without a display lives in render
+ */
+
 package engine
 
 import (
-	"image/color"
-
 	"github.com/emblib/adapters/shared"
+	"github.com/emblib/process"
+	"github.com/emblib/render"
 )
 
-/*
-** Interface composer
- */
-
-/*
-** Setup: does whatever is needed to setup this dingle
-** Line: draws a line between two points, takes x1,y1,x2,y2 and a color.Color
-** Get: returns the object we are working with - image, container etc
-** Display: displays the image on a screen - jpg, fyne img etc
- */
-
-type Composer interface {
-	Setup(ox, oy float32, name string)
-	SetPos(ox, oy float32)
-	Line(ex, ey float32, c color.Color)
-	Get() any
-	Display()
-}
-
 /*
 ** Engine code
  */
@@ -35,21 +22,31 @@ const (
 	Fyne RenderType = iota + 1
 	Jpg
 	Png
+	Svg
+	Real
 )
 
 type Engine struct {
-	RType RenderType
-	Pay   *shared.Payload
-	Comp  Composer
-	file  string
+	RType    RenderType
+	Mode     render.ColorMode
+	Overlays render.Overlays
+	Filter   render.Filter // the parts of the design to draw
+	Pay      *shared.Payload
+	Comp     render.Composer   // nil for Fyne - the viewer draws the design itself
+	Hook     func(render.Step) // called with every step as it is drawn
+	file     string
 }
 
 func NewEngine(file string) *Engine {
 	return &Engine{
-		RType: 0,
-		Pay:   nil,
-		Comp:  nil,
-		file:  file,
+		RType:    0,
+		Mode:     render.ThreadColors,
+		Overlays: render.Overlays{},
+		Filter:   render.Filter{},
+		Pay:      nil,
+		Comp:     nil,
+		Hook:     nil,
+		file:     file,
 	}
 }
 
@@ -58,64 +55,71 @@ func (e *Engine) Setup(t RenderType, p *shared.Payload) {
 	e.Pay = p
 	switch t {
 	case Fyne:
-		e.Comp = NewFyneComposer()
+		e.Comp = nil
 	case Jpg:
 		e.Comp = NewJpgComposer()
 	case Png:
 		e.Comp = NewPngComposer()
+	case Svg:
+		e.Comp = render.NewSvgComposer(p.Scale)
+	case Real:
+		e.Comp = render.NewRealComposer(p.Scale, p.BG)
 	}
 }
 
+// Run draws the design with the composer. Fyne renders are drawn by the viewer when displayed
 func (e *Engine) Run() {
-
-	c_prev := shared.PCommand{
-		Command1: shared.Stitch,
-		Command2: shared.Stitch,
-		Dx:       0,
-		Dy:       0,
-		Color:    0,
+	if e.Comp == nil {
+		return
+	}
+	var kinds []process.Kind
+	if e.Mode == render.KindColors {
+		kinds = process.Kinds(e.Pay)
 	}
-
-	cols := e.Pay.Palette
-	cmds := e.Pay.Cmds
-	col_idx := 0
-	i := 0
 	comp := e.Comp
-	comp.Setup(e.Pay.Width/2, e.Pay.Height/2, e.file) // all stitches are offset from centre
+	ox, oy := render.Centre(e.Pay, e.Overlays)
+	comp.Setup(ox, oy, e.file) // all stitches are offset from centre
+	render.DrawOverlays(comp, e.Pay, e.Overlays)
 
-	for p := range cmds {
-		if p == 0 && cmds[p].Dx == 0 && cmds[p].Dy == 0 {
-			continue
-		}
-		if p == 1 {
-			c_prev = cmds[p]
-			comp.SetPos(cmds[p].Dx, cmds[p].Dy)
-			continue
-		}
-		x := cmds[p].Dx + c_prev.Dx
-		y := cmds[p].Dy + c_prev.Dy
-		switch cmds[p].Command1 {
-		case shared.ColorChg:
-			col_idx = cmds[p].Color
+	render.Walk(e.Pay, func(s render.Step) bool {
+		switch s.Op {
 		case shared.Trim, shared.Jump: // jump without line/thread
-			comp.SetPos(x, y)
-			c_prev = cmds[p]
-			c_prev.Dx = x
-			c_prev.Dy = y
-		default:
-			c_prev = cmds[p]
-			c_prev.Dx = x
-			c_prev.Dy = y
-			comp.Line(x, y, cols[col_idx])
+			comp.SetPos(s.To.X, s.To.Y)
+		case shared.Stitch:
+			col := s.Color
+			if kinds != nil {
+				col = render.TypeColors[kinds[s.Index]]
+			}
+			if c, ok := e.Filter.Color(s, col); ok {
+				comp.Line(s.To.X, s.To.Y, c)
+			} else {
+				comp.SetPos(s.To.X, s.To.Y) // left out
+			}
 		}
-		i++
-	}
+		if e.Hook != nil {
+			e.Hook(s)
+		}
+		return true
+	})
 }
 
 func (e *Engine) Get() any {
+	if e.Comp == nil {
+		return nil
+	}
 	return e.Comp.Get()
 }
 
+// Display shows the result - fyne renders open the interactive viewer with the colors, filter
+// and hook of the engine
 func (e *Engine) Display() {
+	if e.RType == Fyne {
+		v, content := ViewerContent(e.Pay, e.Overlays)
+		v.Mode = e.Mode
+		v.Filter = e.Filter
+		v.Hook = e.Hook
+		show(e.file, content)
+		return
+	}
 	e.Comp.Display()
 }
@@ -7,6 +7,8 @@ import (
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+
+	"github.com/emblib/render"
 )
 
 type FyneComposer struct {
@@ -36,6 +38,7 @@ func (c *FyneComposer) Setup(ox, oy float32, name string) {
 	c.oy = oy
 	c.prev = fyne.NewPos(c.ox, c.oy)
 	c.img = container.NewWithoutLayout()
+	c.img.Resize(fyne.NewSize(2*ox, 2*oy))
 	c.name = name
 }
 
@@ -52,6 +55,25 @@ func (c *FyneComposer) Line(ex, ey float32, col color.Color) {
 	c.img.Add(l)
 }
 
+// Guide adds an overlay line
+func (c *FyneComposer) Guide(x1, y1, x2, y2 float32, k render.GuideKind) {
+	l := canvas.NewLine(render.GuideColors[k])
+	l.Position1 = fyne.NewPos(x1+c.ox, y1+c.oy)
+	l.Position2 = fyne.NewPos(x2+c.ox, y2+c.oy)
+	l.StrokeWidth = 1
+	c.img.Add(l)
+}
+
+// Label adds a ruler number
+func (c *FyneComposer) Label(x, y float32, text string, ax, ay float32) {
+	t := canvas.NewText(text, render.GuideColors[render.RulerTick])
+	t.TextSize = 10
+	s := t.MinSize()
+	t.Move(fyne.NewPos(x+c.ox-s.Width*ax, y+c.oy-s.Height*ay))
+	t.Resize(s)
+	c.img.Add(t)
+}
+
 func (c *FyneComposer) Get() any {
 	return c.img
 }
@@ -11,6 +11,8 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
+
+	"github.com/emblib/render"
 )
 
 type ImgComposer struct {
@@ -55,7 +57,7 @@ func (c *ImgComposer) Setup(ox, oy float32, name string) {
 	c.oy = oy
 	c.px = ox
 	c.py = oy
-	c.img = gg.NewContext(int(3.0*ox), int(3.0*oy))
+	c.img = gg.NewContext(max(1, int(2.0*ox)), max(1, int(2.0*oy)))
 	c.img.SetColor(color.White)
 	c.img.Clear()
 	c.name = filepath.Base(name)
@@ -80,6 +82,20 @@ func (c *ImgComposer) Line(ex, ey float32, col color.Color) {
 
 }
 
+// Guide draws an overlay line a pixel wide
+func (c *ImgComposer) Guide(x1, y1, x2, y2 float32, k render.GuideKind) {
+	c.img.SetColor(render.GuideColors[k])
+	c.img.SetLineWidth(1.0)
+	c.img.DrawLine(float64(c.ox+x1), float64(c.oy+y1), float64(c.ox+x2), float64(c.oy+y2))
+	c.img.Stroke()
+}
+
+// Label writes a ruler number
+func (c *ImgComposer) Label(x, y float32, text string, ax, ay float32) {
+	c.img.SetColor(render.GuideColors[render.RulerTick])
+	c.img.DrawStringAnchored(text, float64(c.ox+x), float64(c.oy+y), float64(ax), float64(1-ay))
+}
+
 func (c *ImgComposer) Get() any {
 	return c.img.Image()
 }
@@ -0,0 +1,414 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/process"
+	"github.com/emblib/render"
+	"github.com/fogleman/gg"
+)
+
+/*
+**
+** Viewer widget
+**
+ */
+
+// Viewer is a widget that shows a design. The mouse wheel zooms about the cursor, dragging pans
+// and blocks can be hidden. It can also draw the design up to one command and mark it
+type Viewer struct {
+	widget.BaseWidget
+	pay      *shared.Payload
+	hidden   []bool
+	step     int           // last command drawn and marked, -1 for the whole design
+	zoom     float32       // fyne units per payload unit
+	off      fyne.Position // where the payload origin is drawn
+	moved    bool          // zoomed or panned by the user
+	raster   *canvas.Raster
+	kinds    []process.Kind     // kinds of stitching once KindColors is drawn
+	Width    float32            // line width in fyne units
+	OnMove   func(x, y float32) // cursor position in mm
+	Overlays render.Overlays
+	Mode     render.ColorMode
+	Filter   render.Filter     // the parts of the design to draw
+	Hook     func(render.Step) // called with every step as it is drawn
+}
+
+// NewViewer is a constructor for a viewer of p
+func NewViewer(p *shared.Payload) *Viewer {
+	v := &Viewer{
+		pay:      p,
+		hidden:   make([]bool, len(p.Blocks)),
+		step:     -1,
+		zoom:     1.0,
+		off:      fyne.NewPos(0.0, 0.0),
+		moved:    false,
+		kinds:    nil,
+		Width:    1.5,
+		OnMove:   nil,
+		Overlays: render.Overlays{},
+		Mode:     render.ThreadColors,
+		Filter:   render.Filter{},
+		Hook:     nil,
+	}
+	v.raster = canvas.NewRaster(v.draw)
+	v.ExtendBaseWidget(v)
+	return v
+}
+
+func (v *Viewer) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(v.raster)
+}
+
+func (v *Viewer) MinSize() fyne.Size {
+	return fyne.NewSize(200, 150)
+}
+
+// Resize fits the design until the user zooms or pans
+func (v *Viewer) Resize(s fyne.Size) {
+	v.BaseWidget.Resize(s)
+	if !v.moved && s.Width > 0 && s.Height > 0 {
+		v.Fit()
+	}
+}
+
+// Fit zooms and centres the design and its overlays in the viewer
+func (v *Viewer) Fit() {
+	s := v.Size()
+	minx, miny, maxx, maxy := render.Extent(v.pay, v.Overlays)
+	w := max(float32(maxx-minx), 1)
+	h := max(float32(maxy-miny), 1)
+	v.zoom = min(s.Width/w, s.Height/h) * 0.9
+	v.off = fyne.NewPos((s.Width-w*v.zoom)/2-float32(minx)*v.zoom, (s.Height-h*v.zoom)/2-float32(miny)*v.zoom)
+	v.Refresh()
+}
+
+// SetVisible shows or hides a color block
+func (v *Viewer) SetVisible(block int, on bool) {
+	if block >= 0 && block < len(v.hidden) {
+		v.hidden[block] = !on
+		v.Refresh()
+	}
+}
+
+// SetOverlays changes the guides drawn under the design
+func (v *Viewer) SetOverlays(o render.Overlays) {
+	v.Overlays = o
+	v.Refresh()
+}
+
+// SetStep draws the design up to command n and marks it. Less than 0 draws the whole design
+func (v *Viewer) SetStep(n int) {
+	v.step = min(max(n, -1), len(v.pay.Cmds)-1)
+	v.Refresh()
+}
+
+// Step returns the command drawn up to, -1 for the whole design
+func (v *Viewer) Step() int {
+	return v.step
+}
+
+// Scrolled zooms about the cursor
+func (v *Viewer) Scrolled(ev *fyne.ScrollEvent) {
+	f := float32(1.1)
+	if ev.Scrolled.DY < 0 {
+		f = 1 / f
+	}
+	at := ev.Position
+	v.zoom *= f
+	v.moved = true
+	v.off = fyne.NewPos(at.X-(at.X-v.off.X)*f, at.Y-(at.Y-v.off.Y)*f)
+	v.Refresh()
+}
+
+// Dragged pans the design
+func (v *Viewer) Dragged(ev *fyne.DragEvent) {
+	v.off = v.off.Add(ev.Dragged)
+	v.moved = true
+	v.Refresh()
+}
+
+func (v *Viewer) DragEnd() {}
+
+func (v *Viewer) MouseIn(ev *desktop.MouseEvent) {
+	v.MouseMoved(ev)
+}
+
+// MouseMoved reports the cursor position in mm
+func (v *Viewer) MouseMoved(ev *desktop.MouseEvent) {
+	if v.OnMove == nil {
+		return
+	}
+	scale := v.pay.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	x := (ev.Position.X - v.off.X) / v.zoom / scale
+	y := (ev.Position.Y - v.off.Y) / v.zoom / scale
+	v.OnMove(x, y)
+}
+
+func (v *Viewer) MouseOut() {}
+
+// draw renders the visible blocks at the current zoom
+func (v *Viewer) draw(w, h int) image.Image {
+	dc := gg.NewContext(w, h)
+	dc.SetColor(color.White)
+	dc.Clear()
+	dc.SetLineCap(gg.LineCapRound)
+	px := float32(1)
+	if s := v.Size(); s.Width > 0 {
+		px = float32(w) / s.Width
+	}
+	dc.SetLineWidth(float64(v.Width * px))
+	pt := func(p shared.Point) (float64, float64) {
+		return float64((v.off.X + p.X*v.zoom) * px), float64((v.off.Y + p.Y*v.zoom) * px)
+	}
+	g, l := render.Guides(v.pay, v.Overlays)
+	dc.SetLineWidth(float64(px))
+	for _, k := range g {
+		x1, y1 := pt(k.A)
+		x2, y2 := pt(k.B)
+		dc.SetColor(render.GuideColors[k.Kind])
+		dc.DrawLine(x1, y1, x2, y2)
+		dc.Stroke()
+	}
+	dc.SetColor(render.GuideColors[render.RulerTick])
+	for _, k := range l {
+		x, y := pt(k.At)
+		dc.DrawStringAnchored(k.Text, x, y, float64(k.AX), float64(1-k.AY))
+	}
+	dc.SetLineWidth(float64(v.Width * px))
+
+	if v.Mode == render.KindColors && v.kinds == nil {
+		v.kinds = process.Kinds(v.pay)
+	}
+	var mark *render.Step
+	render.Walk(v.pay, func(s render.Step) bool {
+		if v.step >= 0 && s.Index > v.step {
+			return false
+		}
+		if s.Index == v.step {
+			mark = &s
+		}
+		if v.Hook != nil {
+			v.Hook(s)
+		}
+		if s.Op != shared.Stitch || s.Block < len(v.hidden) && v.hidden[s.Block] {
+			return true
+		}
+		col := s.Color
+		if v.kinds != nil {
+			col = render.TypeColors[v.kinds[s.Index]]
+		}
+		col, ok := v.Filter.Color(s, col)
+		if !ok {
+			return true
+		}
+		x1, y1 := pt(s.From)
+		x2, y2 := pt(s.To)
+		dc.SetColor(col)
+		dc.DrawLine(x1, y1, x2, y2)
+		dc.Stroke()
+		return true
+	})
+	if mark != nil {
+		x1, y1 := pt(mark.From)
+		x2, y2 := pt(mark.To)
+		dc.SetColor(Highlight)
+		dc.SetLineWidth(float64(v.Width * px * 2))
+		dc.DrawLine(x1, y1, x2, y2)
+		dc.Stroke()
+		dc.DrawCircle(x2, y2, float64(4*px))
+		dc.Stroke()
+	}
+	return dc.Image()
+}
+
+/*
+**
+** Step debugger
+**
+ */
+
+// Highlight is the color of the command the viewer is stepped to
+var Highlight = color.RGBA{0xff, 0x00, 0x80, 0xff}
+
+// next_op returns the first command after n that does op, -1 when there is none
+func next_op(p *shared.Payload, n int, op int) int {
+	found := -1
+	render.Walk(p, func(s render.Step) bool {
+		if s.Index > n && s.Op == op {
+			found = s.Index
+		}
+		return found < 0
+	})
+	return found
+}
+
+// command_text decodes command n and gives where it came from in the source file
+func command_text(p *shared.Payload, n int) string {
+	if n < 0 || n >= len(p.Cmds) {
+		return ""
+	}
+	c := p.Cmds[n]
+	at := "-"
+	if n < len(p.Offsets) && p.Offsets[n] >= 0 {
+		at = fmt.Sprintf("0x%x (%d)", p.Offsets[n], p.Offsets[n])
+	}
+	return fmt.Sprintf("%d/%d: Command1 %s  Command2 %s  Dx %g  Dy %g  Color %d  offset %s",
+		n, len(p.Cmds)-1, shared.CommandName(c.Command1), shared.CommandName(c.Command2), c.Dx, c.Dy, c.Color, at)
+}
+
+// debugger lays out a timeline and step controls for v. The design is drawn up to the command
+// under the slider and the command is decoded below it
+func debugger(v *Viewer, p *shared.Payload) fyne.CanvasObject {
+	last := float64(max(len(p.Cmds)-1, 0))
+	info := widget.NewLabel("")
+	slider := widget.NewSlider(0, last)
+	slider.Step = 1
+	slider.Value = last
+	slider.OnChanged = func(f float64) {
+		v.SetStep(int(f))
+		info.SetText(command_text(p, v.Step()))
+	}
+	to := func(n int) {
+		switch {
+		case n < 0:
+		case slider.Value == float64(n):
+			slider.OnChanged(float64(n)) // the slider is quiet when the value is the same
+		default:
+			slider.SetValue(float64(n))
+		}
+	}
+	at := func() int {
+		if v.Step() < 0 {
+			return len(p.Cmds) - 1
+		}
+		return v.Step()
+	}
+	find := func(o int) func() {
+		return func() { to(next_op(p, at(), o)) }
+	}
+	all := widget.NewButton("All", func() {
+		slider.Value = last
+		slider.Refresh()
+		v.SetStep(-1)
+		info.SetText("")
+	})
+	buttons := container.NewHBox(
+		widget.NewButton("|<", func() { to(0) }),
+		widget.NewButton("<", func() { to(max(at()-1, 0)) }),
+		widget.NewButton(">", func() { to(min(at()+1, int(last))) }),
+		widget.NewButton(">|", func() { to(int(last)) }),
+		widget.NewButton("Next color", find(shared.ColorChg)),
+		widget.NewButton("Next trim", find(shared.Trim)),
+		widget.NewButton("Next jump", find(shared.Jump)),
+		all,
+	)
+	return container.NewVBox(slider, container.NewBorder(nil, nil, buttons, nil, info))
+}
+
+/*
+**
+** Viewer window
+**
+ */
+
+// block_name labels a block with its thread
+func block_name(b int, t shared.Thread) string {
+	var l []string
+	for _, s := range []string{t.Brand, t.Code, t.Name} {
+		if s != "" {
+			l = append(l, s)
+		}
+	}
+	if len(l) == 0 {
+		l = append(l, shared.Hex(t.Color))
+	}
+	return fmt.Sprintf("%d: %s", b+1, strings.Join(l, " "))
+}
+
+// overlay_checks makes a check for each overlay of v. A grid is 10mm unless o asks for another
+func overlay_checks(v *Viewer, o render.Overlays) fyne.CanvasObject {
+	grid := o.Grid
+	if grid <= 0 {
+		grid = 10
+	}
+	check := func(name string, on bool, set func(o *render.Overlays, on bool)) *widget.Check {
+		c := widget.NewCheck(name, func(on bool) {
+			o := v.Overlays
+			set(&o, on)
+			v.SetOverlays(o)
+		})
+		c.SetChecked(on)
+		return c
+	}
+	hoop := "Hoop"
+	if h := o.Use; h.Known() {
+		hoop = h.Name
+	} else if h := v.pay.Hoop; h.Known() {
+		hoop = h.Name
+	}
+	return container.NewVBox(
+		check(hoop, o.Hoop, func(o *render.Overlays, on bool) { o.Hoop = on }),
+		check(fmt.Sprintf("Grid %gmm", grid), o.Grid > 0, func(o *render.Overlays, on bool) {
+			o.Grid = 0
+			if on {
+				o.Grid = grid
+			}
+		}),
+		check("Crosshairs", o.Cross, func(o *render.Overlays, on bool) { o.Cross = on }),
+		check("Rulers", o.Rulers, func(o *render.Overlays, on bool) { o.Rulers = on }),
+	)
+}
+
+// ViewerContent lays out a viewer with a panel of color blocks that can be hidden, overlay
+// toggles, a fit button, a step debugger and a status bar showing the cursor and the stitch
+// statistics. o are the overlays to start with
+func ViewerContent(p *shared.Payload, o render.Overlays) (*Viewer, fyne.CanvasObject) {
+	v := NewViewer(p)
+	v.Overlays = o
+	stats := render.Statistics(p).String()
+	status := widget.NewLabel(stats)
+	v.OnMove = func(x, y float32) {
+		status.SetText(fmt.Sprintf("%.1f, %.1f mm    %s", x, y, stats))
+	}
+
+	blocks := container.NewVBox()
+	for b, blk := range p.Blocks {
+		sw := canvas.NewRectangle(blk.Thread.Color)
+		sw.SetMinSize(fyne.NewSize(16, 16))
+		check := widget.NewCheck(block_name(b, blk.Thread), func(on bool) { v.SetVisible(b, on) })
+		check.SetChecked(true)
+		blocks.Add(container.NewHBox(sw, check))
+	}
+	fit := widget.NewButton("Fit", v.Fit)
+	side := container.NewBorder(fit, overlay_checks(v, o), nil, nil, container.NewVScroll(blocks))
+	return v, container.NewBorder(nil, container.NewVBox(debugger(v, p), status), nil, side, v)
+}
+
+// ShowViewer opens a window with the viewer and runs until it is closed
+func ShowViewer(p *shared.Payload, title string, o render.Overlays) {
+	_, content := ViewerContent(p, o)
+	show(title, content)
+}
+
+// show opens a window with content and runs until it is closed
+func show(title string, content fyne.CanvasObject) {
+	a := app.New()
+	w := a.NewWindow(title)
+	w.SetContent(content)
+	w.Resize(fyne.NewSize(1000, 700))
+	w.ShowAndRun()
+}
@@ -0,0 +1,200 @@
+package process
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// BlockOptions controls block ordering
+type BlockOptions struct {
+	Cell       float32       // mm - blocks that sew into the same cell of this size overlap
+	ChangeTime time.Duration // time a color change costs the operator
+	Trim       float32       // mm - travel longer than this between merged blocks is trimmed
+}
+
+// DefaultBlockOptions returns a half millimetre overlap grid, a minute per color change and
+// trims travel over 3mm as OptimizePath does
+func DefaultBlockOptions() BlockOptions {
+	return BlockOptions{Cell: 0.5, ChangeTime: time.Minute, Trim: 3}
+}
+
+// BlockReport describes what OptimizeBlocks did
+type BlockReport struct {
+	Before int   // color changes before
+	After  int   // color changes after
+	Order  []int // original block of each new block, merged blocks listed in sewing order
+	Saved  time.Duration
+}
+
+// String summarises the report
+func (r BlockReport) String() string {
+	return fmt.Sprintf("color changes %d -> %d, about %s saved", r.Before, r.After, r.Saved)
+}
+
+// changes counts the color changes between blocks of different threads
+func changes(p *shared.Payload) int {
+	n := 0
+	for i := 1; i < len(p.Blocks); i++ {
+		if p.Blocks[i].Thread != p.Blocks[i-1].Thread {
+			n++
+		}
+	}
+	return n
+}
+
+// cells marks the grid cells the stitches of a piece pass through
+func cells(pc *piece, size float32) map[[2]int32]bool {
+	m := make(map[[2]int32]bool)
+	mark := func(x, y float32) {
+		m[[2]int32{int32(math.Floor(float64(x / size))), int32(math.Floor(float64(y / size)))}] = true
+	}
+	at := pc.from
+	for _, s := range pc.st {
+		if sews(s.PCommand) {
+			dx := s.X - at.X
+			dy := s.Y - at.Y
+			n := int(math.Hypot(float64(dx), float64(dy))/float64(size)*2) + 1
+			for k := 0; k <= n; k++ {
+				f := float32(k) / float32(n)
+				mark(at.X+dx*f, at.Y+dy*f)
+			}
+		}
+		at = shared.Point{X: s.X, Y: s.Y}
+	}
+	return m
+}
+
+// overlaps returns for each block the earlier blocks it overlaps
+func overlaps(l []piece, size float32) [][]int {
+	owners := make(map[[2]int32][]int)
+	for i := range l {
+		for c := range cells(&l[i], size) {
+			owners[c] = append(owners[c], i)
+		}
+	}
+	seen := make(map[[2]int]bool)
+	before := make([][]int, len(l))
+	for _, o := range owners {
+		for a := 0; a < len(o); a++ {
+			for b := a + 1; b < len(o); b++ {
+				if !seen[[2]int{o[a], o[b]}] {
+					seen[[2]int{o[a], o[b]}] = true
+					before[o[b]] = append(before[o[b]], o[a])
+				}
+			}
+		}
+	}
+	return before
+}
+
+// Overlaps returns for each block of p the earlier blocks it overlaps on a grid of cell mm, the
+// test OptimizeBlocks uses to keep the layering
+func Overlaps(p *shared.Payload, cell float32) [][]int {
+	return overlaps(pieces(p), cell*unit(p))
+}
+
+// order picks the sewing order. A block can only be sewn once every earlier block it overlaps has
+// been sewn so the layering is kept. Among the blocks that are free the next block on the current
+// thread wins, otherwise the earliest block
+func order(l []piece, before [][]int) []int {
+	done := make([]bool, len(l))
+	var seq []int
+	for len(seq) < len(l) {
+		next := -1
+		for i := range l {
+			if done[i] {
+				continue
+			}
+			free := true
+			for _, b := range before[i] {
+				free = free && done[b]
+			}
+			if !free {
+				continue
+			}
+			if next < 0 {
+				next = i
+			}
+			if len(seq) > 0 && l[i].thread == l[seq[len(seq)-1]].thread {
+				next = i
+				break
+			}
+		}
+		done[next] = true
+		seq = append(seq, next)
+	}
+	return seq
+}
+
+// OptimizeBlocks reorders the color blocks of p to bring blocks of the same thread together and
+// merges neighbouring blocks of the same thread. Blocks that overlap keep their order so what
+// ends up on top does not change
+func OptimizeBlocks(p *shared.Payload, o BlockOptions) (*shared.Payload, BlockReport) {
+	r := BlockReport{Before: changes(p)}
+	l := pieces(p)
+	if o.Cell <= 0 {
+		o.Cell = DefaultBlockOptions().Cell
+	}
+	if o.Trim <= 0 {
+		o.Trim = DefaultBlockOptions().Trim
+	}
+	seq := order(l, overlaps(l, o.Cell*unit(p)))
+
+	var out []piece
+	for _, i := range seq {
+		pc := l[i]
+		r.Order = append(r.Order, i)
+		if len(out) > 0 && out[len(out)-1].thread == pc.thread {
+			last := &out[len(out)-1]
+			at := last.end()
+			join := len(last.st)
+			if at != pc.from {
+				last.st = append(last.st, jump_to(pc.from))
+			}
+			last.st = append(last.st, pc.st...)
+			join_trim(last, join, at, o.Trim*unit(p))
+			continue
+		}
+		out = append(out, pc)
+	}
+	if len(out) == len(l) && !moved(seq) {
+		r.After = r.Before
+		return p.Clone(), r
+	}
+	q := rebuild(p, out)
+	r.After = changes(q)
+	r.Saved = time.Duration(r.Before-r.After) * o.ChangeTime
+	return q, r
+}
+
+// join_trim trims the travel starting at st[join] of a merged piece when it is longer than limit.
+// The color change between the blocks cut the thread and the merged travel has to as well
+func join_trim(pc *piece, join int, at shared.Point, limit float32) {
+	to := at
+	for _, s := range pc.st[join:] {
+		if sews(s.PCommand) {
+			break
+		}
+		if trims(s.PCommand) {
+			return
+		}
+		to = shared.Point{X: s.X, Y: s.Y}
+	}
+	if dist(at, to) > limit {
+		pc.st = slices.Insert(pc.st, join, trim_at(at))
+	}
+}
+
+// moved tests if a sewing order differs from the original
+func moved(seq []int) bool {
+	for i, s := range seq {
+		if s != i {
+			return true
+		}
+	}
+	return false
+}
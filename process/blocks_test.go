@@ -0,0 +1,104 @@
+package process
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+func TestOptimizeBlocks(t *testing.T) {
+	red := thread("1", 0xff, 0, 0)
+	blue := thread("2", 0, 0, 0xff)
+	pt := func(x, y float32) shared.Point { return shared.Point{X: x, Y: y} }
+	for _, c := range []struct {
+		name   string
+		blocks []blk
+		order  []int
+		after  int
+	}{
+		{
+			name: "apart",
+			blocks: []blk{
+				{red, [][]shared.Point{line(pt(0, 0), pt(100, 0))}},
+				{blue, [][]shared.Point{line(pt(0, 200), pt(100, 200))}},
+				{red, [][]shared.Point{line(pt(0, 400), pt(100, 400))}},
+			},
+			order: []int{0, 2, 1},
+			after: 1,
+		},
+		{
+			name: "on top of the other thread",
+			blocks: []blk{
+				{red, [][]shared.Point{line(pt(0, 0), pt(100, 0))}},
+				{blue, [][]shared.Point{line(pt(50, -50), pt(50, 50))}},
+				{red, [][]shared.Point{line(pt(0, 20), pt(100, 20))}},
+			},
+			order: []int{0, 1, 2},
+			after: 2,
+		},
+		{
+			name: "on top of the same thread",
+			blocks: []blk{
+				{red, [][]shared.Point{line(pt(0, 0), pt(100, 0))}},
+				{blue, [][]shared.Point{line(pt(0, 200), pt(100, 200))}},
+				{red, [][]shared.Point{line(pt(50, -50), pt(50, 50))}},
+			},
+			order: []int{0, 2, 1},
+			after: 1,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := design(c.blocks...)
+			q, r := OptimizeBlocks(p, DefaultBlockOptions())
+			if r.Before != 2 || r.After != c.after || changes(q) != c.after {
+				t.Errorf("changes %d -> %d, payload has %d, want 2 -> %d", r.Before, r.After, changes(q), c.after)
+			}
+			if !slices.Equal(r.Order, c.order) {
+				t.Errorf("order %v, want %v", r.Order, c.order)
+			}
+			same_stitches(t, p, q)
+		})
+	}
+}
+
+func TestOptimizeBlocksTrim(t *testing.T) {
+	red := thread("1", 0xff, 0, 0)
+	blue := thread("2", 0, 0, 0xff)
+	pt := func(x, y float32) shared.Point { return shared.Point{X: x, Y: y} }
+	// the red blocks are 40mm apart, so joining them needs a trim. The near ones need none
+	for _, c := range []struct {
+		name  string
+		far   shared.Point
+		trims int
+	}{
+		{"distant", pt(0, 400), 1},
+		{"close", pt(100, 20), 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := design(
+				blk{red, [][]shared.Point{line(pt(0, 0), pt(100, 0))}},
+				blk{blue, [][]shared.Point{line(pt(0, 200), pt(100, 200))}},
+				blk{red, [][]shared.Point{line(c.far, pt(c.far.X+100, c.far.Y))}},
+			)
+			q, r := OptimizeBlocks(p, DefaultBlockOptions())
+			if r.After != 1 {
+				t.Fatalf("%d color changes, want the red blocks merged", r.After)
+			}
+			same_stitches(t, p, q)
+			n := 0
+			pos := q.Positions()
+			for i, cmd := range q.Cmds[:q.Blocks[0].End] {
+				if trims(cmd) {
+					n++
+					if pos[i] != pt(100, 0) {
+						t.Errorf("trim at %v, want at the end of the first block", pos[i])
+					}
+				}
+			}
+			if n != c.trims {
+				t.Errorf("%d trims in the merged block, want %d", n, c.trims)
+			}
+		})
+	}
+}
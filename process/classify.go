@@ -0,0 +1,231 @@
+package process
+
+import (
+	"math"
+	"slices"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Kind is the kind of stitching in a segment
+type Kind int
+
+const (
+	Running Kind = iota
+	Satin        // zig-zag with one stitch across the column
+	Fill         // tatami rows of several stitches joined by short connectors
+)
+
+// String names the kind
+func (k Kind) String() string {
+	switch k {
+	case Running:
+		return "running"
+	case Satin:
+		return "satin"
+	case Fill:
+		return "fill"
+	}
+	return "unk"
+}
+
+// Segment is a stretch of one kind of stitching inside a color block
+type Segment struct {
+	Kind    Kind
+	Block   int
+	Start   int            // first command
+	End     int            // index after the last command
+	Polygon []shared.Point // the outline of a zig-zag, the line itself for running stitches
+}
+
+// vec is the move from a to b
+func vec(a, b shared.Point) shared.Point {
+	return shared.Point{X: b.X - a.X, Y: b.Y - a.Y}
+}
+
+// cosine of the angle between two moves, 1 when either has no length
+func cosine(a, b shared.Point) float64 {
+	la := math.Hypot(float64(a.X), float64(a.Y))
+	lb := math.Hypot(float64(b.X), float64(b.Y))
+	if la == 0 || lb == 0 {
+		return 1
+	}
+	return float64(a.X*b.X+a.Y*b.Y) / (la * lb)
+}
+
+// length of a polyline
+func length(pts []shared.Point) float64 {
+	var l float64
+	for k := 1; k < len(pts); k++ {
+		l += float64(dist(pts[k-1], pts[k]))
+	}
+	return l
+}
+
+// row is a straight stretch of stitching
+type row struct {
+	a shared.Point
+	b shared.Point
+}
+
+// span is a row and the points of the run it covers
+type span struct {
+	row
+	i int
+	j int
+}
+
+// spans joins stitches that carry on in the same direction into straight stretches
+func spans(pts []shared.Point) []span {
+	var l []span
+	for k := 1; k < len(pts); k++ {
+		if n := len(l); n > 0 && cosine(vec(l[n-1].a, l[n-1].b), vec(pts[k-1], pts[k])) > 0.9 {
+			l[n-1].b = pts[k]
+			l[n-1].j = k
+			continue
+		}
+		l = append(l, span{row{pts[k-1], pts[k]}, k - 1, k})
+	}
+	return l
+}
+
+// reverses tests if two rows run back against each other
+func reverses(a, b row) bool {
+	return cosine(vec(a.a, a.b), vec(b.a, b.b)) < -0.5
+}
+
+// region is a stretch of a run from point i to point j
+type region struct {
+	kind Kind
+	i    int
+	j    int
+	rows []row // zig-zags only
+}
+
+// regions splits a run of points into zig-zags - at least four long rows each reversing the one
+// before, joined directly or by up to two short connectors - and the running stitches between them
+func regions(pts []shared.Point) []region {
+	sp := spans(pts)
+	if len(sp) == 0 {
+		return nil
+	}
+	lens := make([]float64, len(sp))
+	for k, s := range sp {
+		lens[k] = float64(dist(s.a, s.b))
+	}
+	sorted := slices.Clone(lens)
+	slices.Sort(sorted)
+	short := 0.35 * sorted[len(sorted)*3/4]
+
+	var zig []region
+	var group []int // long spans of the zig-zag being built
+	finish := func() {
+		if len(group) >= 4 {
+			rg := region{i: sp[group[0]].i, j: sp[group[len(group)-1]].j}
+			for _, g := range group {
+				rg.rows = append(rg.rows, sp[g].row)
+			}
+			rg.kind = Fill
+			if float64(rg.j-rg.i)/float64(len(rg.rows)) < 1.5 {
+				rg.kind = Satin
+			}
+			zig = append(zig, rg)
+		}
+		group = nil
+	}
+	for k, s := range sp {
+		if lens[k] < short {
+			continue
+		}
+		if n := len(group); n > 0 && (k-group[n-1] > 3 || !reverses(sp[group[n-1]].row, s.row)) {
+			finish()
+		}
+		group = append(group, k)
+	}
+	finish()
+
+	// running stitches fill the gaps
+	var l []region
+	at := 0
+	for _, z := range zig {
+		if z.i > at {
+			l = append(l, region{kind: Running, i: at, j: z.i})
+		}
+		l = append(l, z)
+		at = z.j
+	}
+	if at < len(pts)-1 {
+		l = append(l, region{kind: Running, i: at, j: len(pts) - 1})
+	}
+	return l
+}
+
+// rails splits the ends of the rows into the two sides of a zig-zag
+func rails(rows []row) (a, b []shared.Point) {
+	for k, r := range rows {
+		if k%2 == 0 {
+			a = append(a, r.a)
+			b = append(b, r.b)
+		} else {
+			a = append(a, r.b)
+			b = append(b, r.a)
+		}
+	}
+	return a, b
+}
+
+// outline returns the polygon of a region
+func (rg *region) outline(pts []shared.Point) []shared.Point {
+	if rg.kind == Running {
+		return slices.Clone(pts[rg.i : rg.j+1])
+	}
+	a, b := rails(rg.rows)
+	slices.Reverse(b)
+	return append(a, b...)
+}
+
+// Classify splits every color block of p into running, satin and fill segments
+func Classify(p *shared.Payload) []Segment {
+	pos := p.Positions()
+	var l []Segment
+	for bi, b := range p.Blocks {
+		for i := b.Start; i < b.End; {
+			if !sews(p.Cmds[i]) {
+				i++
+				continue
+			}
+			// a run of stitches - point k is where stitch cmds[i+k-1] ends
+			j := i
+			for j < b.End && sews(p.Cmds[j]) {
+				j++
+			}
+			pts := []shared.Point{{}}
+			if i > 0 {
+				pts[0] = pos[i-1]
+			}
+			pts = append(pts, pos[i:j]...)
+			for _, rg := range regions(pts) {
+				l = append(l, Segment{
+					Kind:    rg.kind,
+					Block:   bi,
+					Start:   i + rg.i,
+					End:     i + rg.j,
+					Polygon: rg.outline(pts),
+				})
+			}
+			i = j
+		}
+	}
+	return l
+}
+
+// Kinds returns the kind of stitching of each command. Commands that do not sew are Running
+func Kinds(p *shared.Payload) []Kind {
+	k := make([]Kind, len(p.Cmds))
+	for _, s := range Classify(p) {
+		for i := s.Start; i < s.End; i++ {
+			k[i] = s.Kind
+		}
+	}
+	return k
+}
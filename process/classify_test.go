@@ -0,0 +1,46 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+func TestClassify(t *testing.T) {
+	// one run - a running line into a satin column, another line and a fill of 10 rows
+	run := line(shared.Point{Y: -100}, shared.Point{})
+	run = append(run, satin(0, 0, 30, 60, 4)[1:]...)
+	run = append(run, line(shared.Point{Y: 120}, shared.Point{Y: 200})[1:]...)
+	run = append(run, fill(0, 200, 10, 100, 4, 25)[1:]...)
+	p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{run}})
+
+	// command k sews to point k of the run, the jump is command 0
+	want := []struct {
+		kind       Kind
+		start, end int
+	}{
+		{Running, 1, 11},
+		{Satin, 11, 41},
+		{Running, 41, 49},
+		{Fill, 49, 98},
+	}
+	segs := Classify(p)
+	if len(segs) != len(want) {
+		t.Fatalf("%d segments, want %d: %+v", len(segs), len(want), segs)
+	}
+	for k, s := range segs {
+		w := want[k]
+		if s.Kind != w.kind || s.Block != 0 || s.Start != w.start || s.End != w.end {
+			t.Errorf("segment %d is %s %d-%d, want %s %d-%d", k, s.Kind, s.Start, s.End, w.kind, w.start, w.end)
+		}
+	}
+
+	kinds := Kinds(p)
+	for _, w := range want {
+		for i := w.start; i < w.end; i++ {
+			if kinds[i] != w.kind {
+				t.Errorf("command %d is %s, want %s", i, kinds[i], w.kind)
+			}
+		}
+	}
+}
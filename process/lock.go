@@ -0,0 +1,178 @@
+package process
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// LockOptions controls lock stitches. Patterns are offsets in mm along the line of the first or
+// last stitch of a run - positive is the way the run is sewn
+type LockOptions struct {
+	In   []float32 // tie-in pattern sewn before the first stitch
+	Out  []float32 // tie-off pattern sewn after the last stitch
+	Jump float32   // mm - jumps longer than this leave loose thread
+	Tiny float32   // mm - stitches this short count as an existing lock
+}
+
+// DefaultLockOptions ties in with three tiny back and forth stitches and ties off with four
+// that end where the run ended
+func DefaultLockOptions() LockOptions {
+	return LockOptions{
+		In:   []float32{0.4, 0, 0.4},
+		Out:  []float32{-0.4, 0, -0.4, 0},
+		Jump: 3,
+		Tiny: 1,
+	}
+}
+
+// LockReport describes what AddLocks did
+type LockReport struct {
+	TieIns  int
+	TieOffs int
+}
+
+// String summarises the report
+func (r LockReport) String() string {
+	return fmt.Sprintf("tie-ins %d, tie-offs %d", r.TieIns, r.TieOffs)
+}
+
+// locked is how many tiny stitches in a row make a lock
+const locked = 2
+
+// run_ends marks the first and last stitch of every run of sewing that starts or ends with loose
+// thread - at the start of the design, around trims, color changes and long jumps
+func run_ends(p *shared.Payload, jump float32) (first, last map[int]bool) {
+	first = make(map[int]bool)
+	last = make(map[int]bool)
+	open := false
+	prev := -1
+	for i := 0; i < len(p.Cmds); {
+		c := p.Cmds[i]
+		if sews(c) {
+			if !open {
+				first[i] = true
+				open = true
+			}
+			prev = i
+			i++
+			continue
+		}
+		end := travel_end(p.Cmds, i)
+		cut := end == i // color change or end
+		if !cut {
+			var dx, dy float32
+			for _, t := range p.Cmds[i:end] {
+				dx += t.Dx
+				dy += t.Dy
+			}
+			cut = trimmed(p.Cmds[i:end], TrimCommand, 0) || float32(math.Hypot(float64(dx), float64(dy))) > jump
+		}
+		if cut && open {
+			last[prev] = true
+			open = false
+		}
+		i = max(end, i+1)
+	}
+	if open {
+		last[prev] = true
+	}
+	return first, last
+}
+
+// tiny_run tests if the stitches from i stepping by step are short enough to be a lock
+func tiny_run(p *shared.Payload, pos []shared.Point, i, step int, tiny float32) bool {
+	for k := 0; k < locked; k++ {
+		j := i + k*step
+		if j < 0 || j >= len(p.Cmds) || !sews(p.Cmds[j]) {
+			return false
+		}
+		from := shared.Point{}
+		if j > 0 {
+			from = pos[j-1]
+		}
+		if dist(from, pos[j]) > tiny {
+			return false
+		}
+	}
+	return true
+}
+
+// heading finds the unit vector from a along the first of the points that is somewhere else
+func heading(a shared.Point, pts ...shared.Point) shared.Point {
+	for _, b := range pts {
+		if d := dist(a, b); d > 0 {
+			return shared.Point{X: (b.X - a.X) / d, Y: (b.Y - a.Y) / d}
+		}
+	}
+	return shared.Point{X: 1}
+}
+
+// pattern makes lock stitches around at along the unit vector u
+func pattern(offs []float32, at, u shared.Point, unit float32) []stitch {
+	var l []stitch
+	for _, o := range offs {
+		o *= unit
+		s := stitch{PCommand: shared.PCommand{Command1: shared.Stitch}, X: at.X + u.X*o, Y: at.Y + u.Y*o}
+		l = append(l, s)
+	}
+	return l
+}
+
+// AddLocks adds tie-ins and tie-offs to runs of sewing that start or end with loose thread and do
+// not already have a lock
+func AddLocks(p *shared.Payload, o LockOptions) (*shared.Payload, LockReport) {
+	var r LockReport
+	u := unit(p)
+	pos := p.Positions()
+	first, last := run_ends(p, o.Jump*u)
+	tiny := o.Tiny * u
+
+	var out []stitch
+	at := func(i int) shared.Point {
+		if i < 0 {
+			return shared.Point{}
+		}
+		return pos[i]
+	}
+	for i, c := range p.Cmds {
+		if first[i] && len(o.In) > 0 && !tiny_run(p, pos, i, 1, tiny) {
+			var ahead []shared.Point
+			for j := i; j < len(p.Cmds) && sews(p.Cmds[j]); j++ {
+				ahead = append(ahead, pos[j])
+			}
+			out = append(out, pattern(o.In, at(i-1), heading(at(i-1), ahead...), u)...)
+			r.TieIns++
+		}
+		out = append(out, stitch{PCommand: c, X: pos[i].X, Y: pos[i].Y})
+		if last[i] && len(o.Out) > 0 && !tiny_run(p, pos, i, -1, tiny) {
+			var behind []shared.Point
+			for j := i; j >= 0 && sews(p.Cmds[j]); j-- {
+				behind = append(behind, at(j-1))
+			}
+			back := heading(pos[i], behind...)
+			out = append(out, pattern(o.Out, pos[i], shared.Point{X: -back.X, Y: -back.Y}, u)...)
+			r.TieOffs++
+		}
+	}
+	if r.TieIns == 0 && r.TieOffs == 0 {
+		return p.Clone(), r
+	}
+
+	q := p.Clone()
+	q.Cmds = make([]shared.PCommand, len(out))
+	q.Offsets = nil
+	var prev shared.Point
+	for k, s := range out {
+		c := s.PCommand
+		if c.Command1 != shared.ColorChg {
+			c.Dx = s.X - prev.X
+			c.Dy = s.Y - prev.Y
+			prev = shared.Point{X: s.X, Y: s.Y}
+		}
+		q.Cmds[k] = c
+	}
+	q.SetBlocks(p.Threads())
+	return q, r
+}
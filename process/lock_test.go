@@ -0,0 +1,83 @@
+package process
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// ends returns where the needle is at the end of each run of stitching
+func ends(p *shared.Payload) []shared.Point {
+	pos := p.Positions()
+	var l []shared.Point
+	for i, c := range p.Cmds {
+		if sews(c) && (i+1 == len(p.Cmds) || !sews(p.Cmds[i+1])) {
+			l = append(l, pos[i])
+		}
+	}
+	return l
+}
+
+func TestAddLocks(t *testing.T) {
+	pt := func(x, y float32) shared.Point { return shared.Point{X: x, Y: y} }
+	// 2mm stitches so only the locks count as tiny
+	line := func(a, b shared.Point) []shared.Point { return append([]shared.Point{a}, split(a, b, 20)...) }
+	// a ends in a tiny back and forth lock of its own, b starts with one and follows a trim. c is
+	// reached by a long jump and d carries on after a short jump so c and d are one run
+	a := append(line(pt(0, 0), pt(100, 0)), pt(95, 0), pt(100, 0))
+	b := append([]shared.Point{pt(100, 20), pt(105, 20), pt(100, 20)}, line(pt(100, 20), pt(200, 20))[1:]...)
+	c := line(pt(500, 20), pt(600, 20))
+	d := line(pt(600, 40), pt(700, 40))
+	p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{a, b, c, d}})
+	i := slices.IndexFunc(p.Cmds, func(c shared.PCommand) bool { return c.Command1 == shared.Jump && c.Dy == 20 })
+	p.Cmds = slices.Insert(p.Cmds, i, trim_at(shared.Point{}).PCommand)
+	p.SetBlocks(p.Threads())
+
+	q, r := AddLocks(p, DefaultLockOptions())
+	// a needs a tie-in, b a tie-off and c and d between them one of each
+	if r.TieIns != 2 || r.TieOffs != 2 {
+		t.Errorf("%v, want 2 tie-ins and 2 tie-offs", r)
+	}
+	o := DefaultLockOptions()
+	if got, want := len(q.Cmds)-len(p.Cmds), r.TieIns*len(o.In)+r.TieOffs*len(o.Out); got != want {
+		t.Errorf("%d commands added, want %d", got, want)
+	}
+
+	// every original stitch is still sewn in order and the runs end where they did
+	if want, got := sewn(p), sewn(q); !contains_in_order(got, want) {
+		t.Errorf("original stitches lost:\n%v\n%v", want, got)
+	}
+	if want, got := ends(p), ends(q); !slices.Equal(got, want) {
+		t.Errorf("runs end at %v, want %v", got, want)
+	}
+	if got, want := q.Positions()[len(q.Cmds)-1], p.Positions()[len(p.Cmds)-1]; got != want {
+		t.Errorf("needle finishes at %v, want %v", got, want)
+	}
+
+	// locks are within a mm of the run they tie
+	pos := q.Positions()
+	if first := slices.IndexFunc(q.Cmds, sews); dist(pos[first], pt(0, 0)) > 10 {
+		t.Errorf("tie-in at %v", pos[first])
+	}
+
+	// a locked design is left alone
+	if _, r := AddLocks(q, DefaultLockOptions()); r.TieIns != 0 || r.TieOffs != 0 {
+		t.Errorf("locks doubled: %v", r)
+	}
+	// no patterns, no locks
+	if q, r := AddLocks(p, LockOptions{Jump: 3, Tiny: 1}); r.TieIns != 0 || r.TieOffs != 0 || !slices.Equal(q.Cmds, p.Cmds) {
+		t.Errorf("empty patterns added %v", r)
+	}
+}
+
+// contains_in_order tests if every point of want appears in got in the same order
+func contains_in_order(got, want []shared.Point) bool {
+	k := 0
+	for _, p := range got {
+		if k < len(want) && p == want[k] {
+			k++
+		}
+	}
+	return k == len(want)
+}
@@ -0,0 +1,202 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// PathOptions controls travel optimisation
+type PathOptions struct {
+	Trim   float32 // mm - jumps longer than this are trimmed
+	Passes int     // 2-opt passes over each block, 0 for nearest neighbour only
+}
+
+// DefaultPathOptions trims jumps over 3mm and runs 2-opt until it stops improving
+func DefaultPathOptions() PathOptions {
+	return PathOptions{Trim: 3, Passes: 50}
+}
+
+// PathReport describes what OptimizePath did
+type PathReport struct {
+	TravelBefore float32 // mm of jumps
+	TravelAfter  float32
+	TrimsBefore  int
+	TrimsAfter   int
+}
+
+// String summarises the report
+func (r PathReport) String() string {
+	return fmt.Sprintf("travel %.1fmm -> %.1fmm, trims %d -> %d", r.TravelBefore, r.TravelAfter,
+		r.TrimsBefore, r.TrimsAfter)
+}
+
+// travel measures the jumps of a payload in mm and counts its trims
+func travel(p *shared.Payload) (float32, int) {
+	var mm float32
+	n := 0
+	pos := p.Positions()
+	var at shared.Point
+	for i, c := range p.Cmds {
+		if trims(c) {
+			n++
+		}
+		if c.Command1 != shared.ColorChg && c.Command1 != shared.End && !sews(c) {
+			mm += dist(at, pos[i])
+		}
+		at = pos[i]
+	}
+	return mm / unit(p), n
+}
+
+// run is a stretch of sewing with no travel inside it
+type run struct {
+	from shared.Point
+	st   []stitch
+}
+
+// end returns the needle position after the run
+func (r *run) end() shared.Point {
+	s := r.st[len(r.st)-1]
+	return shared.Point{X: s.X, Y: s.Y}
+}
+
+// runs splits a piece at every jump or trim. The travel itself is dropped
+func runs(pc *piece) []run {
+	var l []run
+	at := pc.from
+	sewing := false
+	for _, s := range pc.st {
+		if !sews(s.PCommand) {
+			sewing = false
+		} else {
+			if !sewing {
+				l = append(l, run{from: at})
+				sewing = true
+			}
+			l[len(l)-1].st = append(l[len(l)-1].st, s)
+		}
+		at = shared.Point{X: s.X, Y: s.Y}
+	}
+	return l
+}
+
+// cost is the travel from start through the runs in the order given
+func cost(start shared.Point, l []run, seq []int) float32 {
+	var c float32
+	at := start
+	for _, i := range seq {
+		c += dist(at, l[i].from)
+		at = l[i].end()
+	}
+	return c
+}
+
+// nearest orders the runs by always moving to the closest unsewn run
+func nearest(start shared.Point, l []run) []int {
+	done := make([]bool, len(l))
+	seq := make([]int, 0, len(l))
+	at := start
+	for len(seq) < len(l) {
+		best := -1
+		var d float32
+		for i := range l {
+			if !done[i] && (best < 0 || dist(at, l[i].from) < d) {
+				best = i
+				d = dist(at, l[i].from)
+			}
+		}
+		done[best] = true
+		seq = append(seq, best)
+		at = l[best].end()
+	}
+	return seq
+}
+
+// two_opt reverses stretches of the order while that shortens the travel. Runs keep their
+// direction so the travel inside a reversed stretch changes too and is summed as the stretch grows
+func two_opt(start shared.Point, l []run, seq []int, passes int) []int {
+	hop := func(a, b int) float32 { return dist(l[a].end(), l[b].from) }
+	for pass := 0; pass < passes; pass++ {
+		better := false
+		for i := 0; i < len(seq)-1; i++ {
+			in := start
+			if i > 0 {
+				in = l[seq[i-1]].end()
+			}
+			var fwd, rev float32 // travel inside seq[i..j] as it is and reversed
+			for j := i + 1; j < len(seq); j++ {
+				fwd += hop(seq[j-1], seq[j])
+				rev += hop(seq[j], seq[j-1])
+				was := dist(in, l[seq[i]].from) + fwd
+				now := dist(in, l[seq[j]].from) + rev
+				if j+1 < len(seq) {
+					was += hop(seq[j], seq[j+1])
+					now += hop(seq[i], seq[j+1])
+				}
+				if now < was-0.01 {
+					for a, b := i, j; a < b; a, b = a+1, b-1 {
+						seq[a], seq[b] = seq[b], seq[a]
+					}
+					better = true
+					fwd, rev = rev, fwd
+				}
+			}
+		}
+		if !better {
+			break
+		}
+	}
+	return seq
+}
+
+// order_runs improves both the nearest neighbour order and the current order with 2-opt and
+// keeps the shorter so running the optimiser again never makes things worse
+func order_runs(start shared.Point, l []run, passes int) []int {
+	seq := nearest(start, l)
+	if passes <= 0 || len(seq) < 3 {
+		return seq
+	}
+	seq = two_opt(start, l, seq, passes)
+	cur := make([]int, len(l))
+	for i := range cur {
+		cur[i] = i
+	}
+	cur = two_opt(start, l, cur, passes)
+	if cost(start, l, cur) < cost(start, l, seq) {
+		return cur
+	}
+	return seq
+}
+
+// OptimizePath reorders the separate runs of stitching inside each color block to cut the
+// travel between them. Jumps are trimmed only when they are longer than the trim distance
+func OptimizePath(p *shared.Payload, o PathOptions) (*shared.Payload, PathReport) {
+	var r PathReport
+	r.TravelBefore, r.TrimsBefore = travel(p)
+	limit := o.Trim * unit(p)
+
+	l := pieces(p)
+	var at shared.Point
+	sewn := false // nothing to trim before the first stitch
+	for k := range l {
+		rs := runs(&l[k])
+		seq := order_runs(at, rs, o.Passes)
+		l[k].from = at
+		l[k].st = nil
+		for _, i := range seq {
+			if d := dist(at, rs[i].from); d > 0 {
+				if d > limit && sewn {
+					l[k].st = append(l[k].st, trim_at(at))
+				}
+				l[k].st = append(l[k].st, jump_to(rs[i].from))
+			}
+			l[k].st = append(l[k].st, rs[i].st...)
+			at = rs[i].end()
+			sewn = true
+		}
+	}
+	q := rebuild(p, l)
+	r.TravelAfter, r.TrimsAfter = travel(q)
+	return q, r
+}
@@ -0,0 +1,62 @@
+package process
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Nearest neighbour goes 10, 35 then all the way back to -20. Only 2-opt from the original order
+// finds -20, 10, 35
+func TestOrderRuns(t *testing.T) {
+	var l []run
+	for _, x := range []float32{10, -20, 35} {
+		at := shared.Point{X: x}
+		l = append(l, run{from: at, st: []stitch{{X: x}}})
+	}
+	if c := cost(shared.Point{}, l, nearest(shared.Point{}, l)); c != 90 {
+		t.Fatalf("nearest neighbour travel %v, want 90", c)
+	}
+	seq := order_runs(shared.Point{}, l, DefaultPathOptions().Passes)
+	if c := cost(shared.Point{}, l, seq); c != 75 || !slices.Equal(seq, []int{1, 0, 2}) {
+		t.Errorf("order %v travel %v, want [1 0 2] travel 75", seq, c)
+	}
+}
+
+func TestOptimizePath(t *testing.T) {
+	red := thread("1", 0xff, 0, 0)
+	pt := func(x, y float32) shared.Point { return shared.Point{X: x, Y: y} }
+	for _, c := range []struct {
+		name  string
+		gap   float32 // units between the runs
+		trims int
+	}{
+		{"far apart", 200, 2},
+		{"close", 20, 0},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var runs [][]shared.Point
+			for _, k := range []float32{0, 2, 1} {
+				x := k * (50 + c.gap)
+				runs = append(runs, line(pt(x, 0), pt(x+50, 0)))
+			}
+			p := design(blk{red, runs})
+			q, r := OptimizePath(p, DefaultPathOptions())
+			if r.TravelAfter >= r.TravelBefore {
+				t.Errorf("travel %.1f -> %.1f mm, want shorter", r.TravelBefore, r.TravelAfter)
+			}
+			if r.TrimsAfter != c.trims {
+				t.Errorf("%d trims, want %d", r.TrimsAfter, c.trims)
+			}
+			same_stitches(t, p, q)
+			x := float32(-1)
+			for _, at := range sewn(q) {
+				if at.X < x {
+					t.Fatalf("runs are not in order along x: %v after %v", at.X, x)
+				}
+				x = at.X
+			}
+		})
+	}
+}
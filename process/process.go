@@ -0,0 +1,139 @@
+/*
+** process
+** optimisations and edits that work on a whole payload - block ordering, travel, trims, lock
+** stitches and resizing. Every operation returns a new payload and leaves its input alone
+**
+** Commands are relative moves so most operations first turn each block into stitches at absolute
+** positions, rearrange those and then rebuild the relative commands
+ */
+
+package process
+
+import (
+	"math"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// stitch is a command with the absolute needle position after it
+type stitch struct {
+	shared.PCommand
+	X float32
+	Y float32
+}
+
+// piece is a block as absolute stitches. Color changes and the end are not included
+type piece struct {
+	thread shared.Thread
+	needle int
+	from   shared.Point // needle position before the first stitch
+	st     []stitch
+}
+
+// sews tests if a command lays thread - long pec stitches decode with no command
+func sews(c shared.PCommand) bool {
+	if c.Command2 == shared.Jump || c.Command2 == shared.Trim {
+		return false
+	}
+	return c.Command1 == shared.Stitch || c.Command1 == 0
+}
+
+// pieces splits a payload into its blocks at absolute positions
+func pieces(p *shared.Payload) []piece {
+	pos := p.Positions()
+	var l []piece
+	for _, b := range p.Blocks {
+		pc := piece{thread: b.Thread, needle: b.Needle}
+		if b.Start > 0 {
+			pc.from = pos[b.Start-1]
+		}
+		for i := b.Start; i < b.End; i++ {
+			c := p.Cmds[i]
+			if c.Command1 == shared.ColorChg || c.Command1 == shared.End {
+				continue
+			}
+			pc.st = append(pc.st, stitch{PCommand: c, X: pos[i].X, Y: pos[i].Y})
+		}
+		l = append(l, pc)
+	}
+	return l
+}
+
+// end returns the needle position after the last stitch of a piece
+func (pc *piece) end() shared.Point {
+	if len(pc.st) == 0 {
+		return pc.from
+	}
+	s := pc.st[len(pc.st)-1]
+	return shared.Point{X: s.X, Y: s.Y}
+}
+
+// jump_to makes a jump to a position
+func jump_to(at shared.Point) stitch {
+	return stitch{PCommand: shared.PCommand{Command1: shared.Jump}, X: at.X, Y: at.Y}
+}
+
+// trim_at makes a trim that does not move the needle. Both commands are set so pes and jef
+// writers see it
+func trim_at(at shared.Point) stitch {
+	return stitch{PCommand: shared.PCommand{Command1: shared.Trim, Command2: shared.Trim}, X: at.X, Y: at.Y}
+}
+
+// trims tests if a command cuts the thread
+func trims(c shared.PCommand) bool {
+	return c.Command1 == shared.Trim || c.Command2 == shared.Trim
+}
+
+// dist between two points
+func dist(a, b shared.Point) float32 {
+	return float32(math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y)))
+}
+
+// rebuild turns pieces back into a payload shaped like src. A jump is added wherever a piece does
+// not start where the one before it ended
+func rebuild(src *shared.Payload, l []piece) *shared.Payload {
+	q := src.Clone()
+	q.Cmds = nil
+	q.Offsets = nil
+	q.Blocks = nil
+	lead := len(src.Cmds) > 0 && src.Cmds[0].Command1 == shared.ColorChg
+	end := len(src.Cmds) > 0 && src.Cmds[len(src.Cmds)-1].Command1 == shared.End
+
+	var pos shared.Point
+	var threads []shared.Thread
+	for k, pc := range l {
+		if k > 0 || lead {
+			q.Cmds = append(q.Cmds, shared.PCommand{Command1: shared.ColorChg, Color: k})
+		}
+		st := pc.st
+		if pc.from != pos {
+			st = append([]stitch{jump_to(pc.from)}, st...)
+		}
+		for _, s := range st {
+			c := s.PCommand
+			c.Dx = s.X - pos.X
+			c.Dy = s.Y - pos.Y
+			q.Cmds = append(q.Cmds, c)
+			pos = shared.Point{X: s.X, Y: s.Y}
+		}
+		threads = append(threads, pc.thread)
+	}
+	if end {
+		q.Cmds = append(q.Cmds, shared.PCommand{Command1: shared.End})
+	}
+	q.SetBlocks(threads)
+	for k := range q.Blocks {
+		if k < len(l) {
+			q.Blocks[k].Needle = l[k].needle
+		}
+	}
+	return q
+}
+
+// unit returns payload units per mm
+func unit(p *shared.Payload) float32 {
+	if p.Scale > 0 {
+		return p.Scale
+	}
+	return 1
+}
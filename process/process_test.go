@@ -0,0 +1,122 @@
+package process
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// blk is a color block of a test design - runs of needle positions each reached by a jump
+type blk struct {
+	thread shared.Thread
+	runs   [][]shared.Point
+}
+
+// design builds a payload at 10 units per mm from blocks of runs
+func design(bs ...blk) *shared.Payload {
+	p := &shared.Payload{Scale: 10}
+	var pos shared.Point
+	var threads []shared.Thread
+	for k, b := range bs {
+		if k > 0 {
+			p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.ColorChg})
+		}
+		for _, run := range b.runs {
+			for i, at := range run {
+				c := shared.PCommand{Command1: shared.Stitch, Dx: at.X - pos.X, Dy: at.Y - pos.Y}
+				if i == 0 {
+					c.Command1 = shared.Jump
+				}
+				p.Cmds = append(p.Cmds, c)
+				pos = at
+			}
+		}
+		threads = append(threads, b.thread)
+	}
+	p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.End})
+	p.SetBlocks(threads)
+	return p
+}
+
+// thread makes a test thread
+func thread(code string, r, g, b uint8) shared.Thread {
+	return shared.Thread{Code: code, Color: color.RGBA{r, g, b, 0xff}}
+}
+
+// same_stitches fails unless both payloads sew the same stitches with the same threads in any order
+func same_stitches(t *testing.T, p, q *shared.Payload) {
+	t.Helper()
+	count := func(p *shared.Payload) map[[5]float32]int {
+		m := make(map[[5]float32]int)
+		pos := p.Positions()
+		cols := p.Colors()
+		block := 0
+		var at shared.Point
+		for i, c := range p.Cmds {
+			if c.Command1 == shared.ColorChg {
+				block = c.Color
+			}
+			if c.Command1 == shared.Stitch {
+				r, g, b, _ := cols[block].RGBA()
+				m[[5]float32{at.X, at.Y, pos[i].X, pos[i].Y, float32(r>>8<<16 | g>>8<<8 | b>>8)}]++
+			}
+			at = pos[i]
+		}
+		return m
+	}
+	a, b := count(p), count(q)
+	if len(a) == 0 {
+		t.Fatal("nothing sewn")
+	}
+	if len(a) != len(b) {
+		t.Fatalf("%d different stitches, want %d", len(b), len(a))
+	}
+	for k, n := range a {
+		if b[k] != n {
+			t.Fatalf("stitch %v sewn %d times, want %d", k, b[k], n)
+		}
+	}
+}
+
+// line sews a straight running line from a to b in 1mm stitches
+func line(a, b shared.Point) []shared.Point {
+	return append([]shared.Point{a}, split(a, b, 10)...)
+}
+
+// satin zig-zags n times across a column w units wide, each penetration step units below the last
+func satin(x, y float32, n int, w, step float32) []shared.Point {
+	var l []shared.Point
+	for k := 0; k <= n; k++ {
+		l = append(l, shared.Point{X: x + w*float32(k%2), Y: y + step*float32(k)})
+	}
+	return l
+}
+
+// fill sews n rows w units long, each step units below the last, joined by short connectors and
+// split into stitches of at most l units
+func fill(x, y float32, n int, w, step, l float32) []shared.Point {
+	var pts []shared.Point
+	for k := 0; k < n; k++ {
+		a, b := x, x+w
+		if k%2 == 1 {
+			a, b = b, a
+		}
+		ry := y + step*float32(k)
+		pts = append(pts, shared.Point{X: a, Y: ry})
+		pts = append(pts, split(shared.Point{X: a, Y: ry}, shared.Point{X: b, Y: ry}, l)...)
+	}
+	return pts
+}
+
+// sewn returns the needle positions of every stitch of p in order
+func sewn(p *shared.Payload) []shared.Point {
+	pos := p.Positions()
+	var l []shared.Point
+	for i, c := range p.Cmds {
+		if c.Command1 == shared.Stitch {
+			l = append(l, pos[i])
+		}
+	}
+	return l
+}
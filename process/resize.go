@@ -0,0 +1,488 @@
+package process
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// ResizeOptions controls smart resizing. Lengths are in mm. Satin widths are taken to carry pull
+// compensation of PullRatio of the column width but at least Pull - narrow columns pull in by a
+// fixed amount and wide ones in proportion. The compensation is worked out again at the new width
+type ResizeOptions struct {
+	Pull      float32 // least pull compensation built into satin widths
+	PullRatio float32 // pull compensation as a fraction of the column width
+	Corner    float64 // degrees - running stitches turning more than this keep their corner
+}
+
+// DefaultResizeOptions returns pull compensation of 10% of the width but at least 0.2mm and 30
+// degree corners
+func DefaultResizeOptions() ResizeOptions {
+	return ResizeOptions{Pull: 0.2, PullRatio: 0.1, Corner: 30}
+}
+
+// Density compares how closely one kind of stitching is sewn before and after. Every stitch is
+// counted - per mm along the column for satin, per mm along the line for running stitches and per
+// square mm for fill
+type Density struct {
+	Runs   int
+	Before float64
+	After  float64
+}
+
+// Change returns the difference in density as a percentage of the original
+func (d Density) Change() float64 {
+	if d.Before == 0 {
+		return 0
+	}
+	return (d.After - d.Before) / d.Before * 100
+}
+
+// ResizeReport describes what Resize did
+type ResizeReport struct {
+	Factor   float32
+	Density  [3]Density // indexed by Kind
+	Underlay int        // running runs found under a satin or fill and resized with it
+}
+
+// String summarises the report
+func (r ResizeReport) String() string {
+	var l []string
+	for k, d := range r.Density {
+		if d.Runs > 0 {
+			per := "mm"
+			if Kind(k) == Fill {
+				per = "mm²"
+			}
+			l = append(l, fmt.Sprintf("%s %d runs %.2f -> %.2f/%s (%+.1f%%)", Kind(k), d.Runs,
+				d.Before, d.After, per, d.Change()))
+		}
+	}
+	if r.Underlay > 0 {
+		l = append(l, fmt.Sprintf("underlay %d runs", r.Underlay))
+	}
+	return fmt.Sprintf("x%.2f: %s", r.Factor, strings.Join(l, ", "))
+}
+
+// area of a polygon
+func area(poly []shared.Point) float64 {
+	var a float64
+	for k := range poly {
+		p := poly[k]
+		q := poly[(k+1)%len(poly)]
+		a += float64(p.X*q.Y - q.X*p.Y)
+	}
+	return math.Abs(a) / 2
+}
+
+// column_length measures a satin column along the middle of its two sides
+func column_length(pen []shared.Point) float64 {
+	var side [2][]shared.Point
+	for k, p := range pen {
+		side[k%2] = append(side[k%2], p)
+	}
+	return (length(side[0]) + length(side[1])) / 2
+}
+
+// sample interpolates a rail at t between 0 and 1. Rail points are placed by their row
+func sample(rail []shared.Point, t float64) shared.Point {
+	f := t * float64(len(rail)-1)
+	i := min(int(math.Floor(f)), len(rail)-1)
+	if i+1 >= len(rail) {
+		return rail[i]
+	}
+	w := float32(f - float64(i))
+	return shared.Point{X: rail[i].X + (rail[i+1].X-rail[i].X)*w, Y: rail[i].Y + (rail[i+1].Y-rail[i].Y)*w}
+}
+
+// scale_pts scales points about the origin
+func scale_pts(pts []shared.Point, f float32) []shared.Point {
+	l := make([]shared.Point, len(pts))
+	for k, p := range pts {
+		l[k] = shared.Point{X: p.X * f, Y: p.Y * f}
+	}
+	return l
+}
+
+// penetrations returns the needle points of a satin column in order. Each row starts where the
+// one before ended so the penetrations swap sides every stitch
+func penetrations(rows []row) []shared.Point {
+	pen := []shared.Point{rows[0].a}
+	for _, r := range rows {
+		pen = append(pen, r.b)
+	}
+	return pen
+}
+
+// along interpolates the points of a side of a column placed at ts. Beyond the first or last
+// point the side carries on in the direction of its end
+func along(side []shared.Point, ts []float64, t float64) shared.Point {
+	if len(side) == 1 {
+		return side[0]
+	}
+	k, _ := slices.BinarySearch(ts, t)
+	k = min(max(k, 1), len(ts)-1)
+	w := float32((t - ts[k-1]) / (ts[k] - ts[k-1]))
+	return shared.Point{X: side[k-1].X + (side[k].X-side[k-1].X)*w, Y: side[k-1].Y + (side[k].Y-side[k-1].Y)*w}
+}
+
+// pull is the pull compensation of satin columns in payload units
+type pull struct {
+	least float32
+	ratio float32
+}
+
+// width returns the width a satin column sewn w wide should be sewn at f. The compensation is
+// taken off, the rest scaled and the compensation for the new width added back. A column narrower
+// than its compensation is simply scaled
+func (pl pull) width(w, f float32) float32 {
+	core := w - pl.least
+	if pl.ratio > 0 && core*pl.ratio > pl.least {
+		core = w / (1 + pl.ratio)
+	}
+	if core <= 0 {
+		return w * f
+	}
+	core *= f
+	return core + max(pl.least, core*pl.ratio)
+}
+
+// resize_satin rebuilds a scaled satin column with the penetrations per mm of the original.
+// Penetration k goes on side k%2 at its own place along the column, as the original did, so every
+// stitch crosses the column from where the last one ended. Widths are worked out again with their
+// pull compensation. The ends stay put so the column still joins the stitching either side
+func resize_satin(rows []row, f float32, pl pull) []shared.Point {
+	pen := scale_pts(penetrations(rows), f)
+	n := len(pen)
+	var side [2][]shared.Point
+	var ts [2][]float64
+	for k, p := range pen {
+		side[k%2] = append(side[k%2], p)
+		ts[k%2] = append(ts[k%2], float64(k)/float64(n-1))
+	}
+	m := max(2, int(math.Round(float64(n-1)*float64(f)))+1)
+	if (m-n)%2 != 0 {
+		m++ // finish on the same side
+	}
+	out := make([]shared.Point, m)
+	for k := range out {
+		t := float64(k) / float64(m-1)
+		p := along(side[k%2], ts[k%2], t)
+		q := along(side[1-k%2], ts[1-k%2], t)
+		if w := dist(p, q); k > 0 && k < m-1 && w > 0 {
+			c := pl.width(w/f, f) / w
+			mid := shared.Point{X: (p.X + q.X) / 2, Y: (p.Y + q.Y) / 2}
+			p = shared.Point{X: mid.X + (p.X-mid.X)*c, Y: mid.Y + (p.Y-mid.Y)*c}
+		}
+		out[k] = p
+	}
+	return out
+}
+
+// resize_fill rebuilds scaled fill rows with the rows per mm of the original. Both ends of a row
+// are taken at the same place along the rails so the rows stay parallel and the connectors run
+// along the edges
+func resize_fill(rows []row, f float32) []row {
+	a, b := rails(rows)
+	a = scale_pts(a, f)
+	b = scale_pts(b, f)
+	m := max(2, int(math.Round(float64(len(rows)-1)*float64(f)))+1)
+	if (m-len(rows))%2 != 0 {
+		m++ // finish on the same side
+	}
+	out := make([]row, m)
+	for j := range out {
+		t := float64(j) / float64(m-1)
+		pa := sample(a, t)
+		pb := sample(b, t)
+		if j%2 == 0 {
+			out[j] = row{pa, pb}
+		} else {
+			out[j] = row{pb, pa}
+		}
+	}
+	return out
+}
+
+// sew_rows turns rows into points, splitting them into stitches no longer than l. Rows that do
+// not start where the last ended are joined by a connecting stitch
+func sew_rows(from shared.Point, rows []row, l float32) []shared.Point {
+	out := []shared.Point{from}
+	for _, r := range rows {
+		if out[len(out)-1] != r.a {
+			out = append(out, r.a)
+		}
+		out = append(out, split(r.a, r.b, l)...)
+	}
+	return out
+}
+
+// split returns the points after a and up to b no more than l apart
+func split(a, b shared.Point, l float32) []shared.Point {
+	n := max(1, int(math.Ceil(float64(dist(a, b)/l))))
+	var out []shared.Point
+	for i := 1; i <= n; i++ {
+		w := float32(i) / float32(n)
+		out = append(out, shared.Point{X: a.X + (b.X-a.X)*w, Y: a.Y + (b.Y-a.Y)*w})
+	}
+	return out
+}
+
+// resize_line rescales a running line and spaces its stitches as the original were. Corners are kept
+func resize_line(pts []shared.Point, f float32, corner float64) []shared.Point {
+	l := float32(length(pts) / float64(len(pts)-1))
+	pts = scale_pts(pts, f)
+	limit := math.Cos(corner * math.Pi / 180)
+	out := []shared.Point{pts[0]}
+	from := 0
+	for k := 1; k < len(pts); k++ {
+		if k+1 < len(pts) && cosine(vec(pts[k-1], pts[k]), vec(pts[k], pts[k+1])) >= limit {
+			continue
+		}
+		out = append(out, resample(pts[from:k+1], l)...)
+		from = k
+	}
+	return out
+}
+
+// resample walks a polyline placing points about l apart. The first point is left out and the
+// last is always included
+func resample(part []shared.Point, l float32) []shared.Point {
+	total := length(part)
+	if l <= 0 || total == 0 {
+		return part[len(part)-1:]
+	}
+	n := max(1, int(math.Round(total/float64(l))))
+	step := total / float64(n)
+	var out []shared.Point
+	walked := 0.0
+	k := 1
+	for i := 1; i < n; i++ {
+		want := step * float64(i)
+		for k < len(part)-1 && walked+float64(dist(part[k-1], part[k])) < want {
+			walked += float64(dist(part[k-1], part[k]))
+			k++
+		}
+		seg := float64(dist(part[k-1], part[k]))
+		w := float32(0)
+		if seg > 0 {
+			w = float32((want - walked) / seg)
+		}
+		out = append(out, shared.Point{X: part[k-1].X + (part[k].X-part[k-1].X)*w, Y: part[k-1].Y + (part[k].Y-part[k-1].Y)*w})
+	}
+	return append(out, part[len(part)-1])
+}
+
+// inside tests if a point is inside a polygon
+func inside(poly []shared.Point, p shared.Point) bool {
+	in := false
+	for k := range poly {
+		a := poly[k]
+		b := poly[(k+len(poly)-1)%len(poly)]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < a.X+(b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// cover is a satin or fill of a block that running stitches may lie under
+type cover struct {
+	kind Kind
+	rows []row
+	poly []shared.Point
+}
+
+// covers finds the satins and fills of a piece
+func covers(pc *piece) []cover {
+	var l []cover
+	var pts []shared.Point
+	flush := func() {
+		if len(pts) >= 2 {
+			for _, rg := range regions(pts) {
+				if rg.kind != Running {
+					l = append(l, cover{rg.kind, rg.rows, rg.outline(pts)})
+				}
+			}
+		}
+		pts = nil
+	}
+	at := pc.from
+	for _, s := range pc.st {
+		if !sews(s.PCommand) {
+			flush()
+		} else {
+			if pts == nil {
+				pts = []shared.Point{at}
+			}
+			pts = append(pts, shared.Point{X: s.X, Y: s.Y})
+		}
+		at = shared.Point{X: s.X, Y: s.Y}
+	}
+	flush()
+	return l
+}
+
+// under finds the cover a running line is underlay for - at least four fifths of its points
+// inside the outline of the satin or fill
+func under(l []cover, line []shared.Point) *cover {
+	for k := range l {
+		n := 0
+		for _, p := range line {
+			if inside(l[k].poly, p) {
+				n++
+			}
+		}
+		if n*5 >= len(line)*4 {
+			return &l[k]
+		}
+	}
+	return nil
+}
+
+// follow moves scaled underlay points across a satin column as resize_satin changes the width of
+// the column there, so the underlay keeps its place inside the column. Fill rows are only scaled
+// so underlay under a fill needs nothing more
+func follow(cv *cover, pts []shared.Point, f float32, pl pull) {
+	if cv.kind != Satin {
+		return
+	}
+	a, b := rails(cv.rows)
+	for k, q := range pts {
+		p := shared.Point{X: q.X / f, Y: q.Y / f}
+		best := 0
+		var mid shared.Point
+		for j := range a {
+			m := shared.Point{X: (a[j].X + b[j].X) / 2, Y: (a[j].Y + b[j].Y) / 2}
+			if j == 0 || dist(p, m) < dist(p, mid) {
+				best = j
+				mid = m
+			}
+		}
+		w := dist(a[best], b[best])
+		if w == 0 {
+			continue
+		}
+		dir := shared.Point{X: (b[best].X - a[best].X) / w, Y: (b[best].Y - a[best].Y) / w}
+		across := (p.X-mid.X)*dir.X + (p.Y-mid.Y)*dir.Y
+		move := across * f * (pl.width(w, f)/(w*f) - 1)
+		pts[k] = shared.Point{X: q.X + dir.X*move, Y: q.Y + dir.Y*move}
+	}
+}
+
+// Resize scales p by f and regenerates satin columns, fill rows and running lines so they keep the
+// stitches per mm of the original. Running stitches lying under a satin or fill of the same block
+// are underlay and move with the column they are under. Jumps and trims are scaled as they are.
+// Lock stitches do not survive regeneration so run AddLocks afterwards
+func Resize(p *shared.Payload, f float32, o ResizeOptions) (*shared.Payload, ResizeReport, error) {
+	r := ResizeReport{Factor: f}
+	if !(f > 0) || math.IsInf(float64(f), 0) {
+		return nil, r, fmt.Errorf("resize: factor %v is not a positive size", f)
+	}
+	u := unit(p)
+	pl := pull{o.Pull * u, o.PullRatio}
+	corner := o.Corner
+	if corner <= 0 {
+		corner = DefaultResizeOptions().Corner
+	}
+	var sums [3][4]float64 // stitches and length or area before then after, per kind
+	tally := func(k Kind, n0 int, m0 float64, n1 int, m1 float64) {
+		sums[k][0] += float64(n0)
+		sums[k][1] += m0
+		sums[k][2] += float64(n1)
+		sums[k][3] += m1
+	}
+
+	l := pieces(p)
+	for k := range l {
+		pc := &l[k]
+		cv := covers(pc)
+		var st []stitch
+		var pts []shared.Point // unscaled run being collected
+		var tmpl shared.PCommand
+		flush := func() {
+			if len(pts) < 2 {
+				pts = nil
+				return
+			}
+			out := []shared.Point{{X: pts[0].X * f, Y: pts[0].Y * f}}
+			for _, rg := range regions(pts) {
+				part := pts[rg.i : rg.j+1]
+				from := shared.Point{X: part[0].X * f, Y: part[0].Y * f}
+				r.Density[rg.kind].Runs++
+				var sized []shared.Point
+				switch rg.kind {
+				case Satin:
+					sized = resize_satin(rg.rows, f, pl)
+				case Fill:
+					var longest float32
+					for i := 1; i < len(part); i++ {
+						longest = max(longest, dist(part[i-1], part[i]))
+					}
+					sized = sew_rows(from, resize_fill(rg.rows, f), longest)
+				default:
+					sized = resize_line(part, f, corner)
+					if c := under(cv, part); c != nil {
+						follow(c, sized, f, pl)
+						r.Underlay++
+					}
+				}
+				before := len(out)
+				if sized[0] != out[len(out)-1] {
+					out = append(out, sized[0])
+				}
+				out = append(out, sized[1:]...)
+				sewn := out[before-1:]
+				switch rg.kind {
+				case Satin:
+					tally(Satin, len(part)-1, column_length(penetrations(rg.rows)), len(sewn)-1, column_length(sewn))
+				case Fill:
+					a, b := rails(rg.rows)
+					slices.Reverse(b)
+					tally(Fill, len(part)-1, area(append(a, b...)), len(sewn)-1, area(append(a, b...))*float64(f*f))
+				default:
+					tally(Running, len(part)-1, length(part), len(sewn)-1, length(sewn))
+				}
+			}
+			for _, q := range out[1:] {
+				st = append(st, stitch{PCommand: tmpl, X: q.X, Y: q.Y})
+			}
+			pts = nil
+		}
+		at := pc.from
+		pc.from = shared.Point{X: at.X * f, Y: at.Y * f}
+		for _, s := range pc.st {
+			if !sews(s.PCommand) {
+				flush()
+				st = append(st, stitch{PCommand: s.PCommand, X: s.X * f, Y: s.Y * f})
+			} else {
+				if pts == nil {
+					pts = []shared.Point{at}
+					tmpl = s.PCommand
+				}
+				pts = append(pts, shared.Point{X: s.X, Y: s.Y})
+			}
+			at = shared.Point{X: s.X, Y: s.Y}
+		}
+		flush()
+		pc.st = st
+	}
+	for k, sm := range sums {
+		per := float64(u) // lengths are in payload units
+		if Kind(k) == Fill {
+			per *= per
+		}
+		if sm[1] > 0 && sm[3] > 0 {
+			r.Density[k].Before = sm[0] / sm[1] * per
+			r.Density[k].After = sm[2] / sm[3] * per
+		}
+	}
+
+	q := rebuild(p, l)
+	q.Width *= f
+	q.Height *= f
+	return q, r, nil
+}
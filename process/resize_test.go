@@ -0,0 +1,147 @@
+package process
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+func TestResizeSatin(t *testing.T) {
+	// 30 stitches across a 6mm column, 0.4mm apart
+	p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{satin(0, 0, 30, 60, 4)}})
+	pull := DefaultResizeOptions().Pull * 10
+	for _, tc := range []struct {
+		f    float32
+		want int // stitches
+	}{
+		{0.5, 16},
+		{2, 60},
+	} {
+		q, r, err := Resize(p, tc.f, DefaultResizeOptions())
+		if err != nil {
+			t.Fatalf("x%v: %v", tc.f, err)
+		}
+		pen := append(q.Positions()[:1], sewn(q)...) // the jump to the column then its stitches
+		if got := len(pen) - 1; got != tc.want {
+			t.Errorf("x%v: %d stitches, want %d", tc.f, got, tc.want)
+		}
+		w := 60 * tc.f
+		for k := 1; k < len(pen); k++ {
+			dx := pen[k].X - pen[k-1].X
+			if (k%2 == 1) != (dx > 0) {
+				t.Errorf("x%v: stitch %d does not cross the column: %v -> %v", tc.f, k, pen[k-1], pen[k])
+			}
+			if d := math.Abs(math.Abs(float64(dx)) - float64(w)); d > float64(pull) {
+				t.Errorf("x%v: stitch %d is %.2f wide, want %.2f", tc.f, k, math.Abs(float64(dx)), w)
+			}
+			if pen[k].Y <= pen[k-1].Y {
+				t.Errorf("x%v: stitch %d steps back: %v -> %v", tc.f, k, pen[k-1], pen[k])
+			}
+		}
+		d := r.Density[Satin]
+		if d.Runs != 1 || math.Abs(d.Change()) > 10 {
+			t.Errorf("x%v: density %+v changed %.1f%%", tc.f, d, d.Change())
+		}
+	}
+}
+
+func TestResizeFactor(t *testing.T) {
+	p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{line(shared.Point{}, shared.Point{X: 100})}})
+	for _, f := range []float32{0, -1, float32(math.NaN()), float32(math.Inf(1))} {
+		if _, _, err := Resize(p, f, DefaultResizeOptions()); err == nil {
+			t.Errorf("x%v: no error", f)
+		}
+	}
+}
+
+func TestResizeDensity(t *testing.T) {
+	run := line(shared.Point{Y: -100}, shared.Point{})
+	run = append(run, satin(0, 0, 30, 60, 4)[1:]...)
+	run = append(run, line(shared.Point{Y: 120}, shared.Point{Y: 200})[1:]...)
+	// the fill is a run of its own so its wider rows do not make the satin look short
+	p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{run, fill(0, 300, 30, 200, 4, 25)}})
+	for _, f := range []float32{0.5, 1.5, 3} {
+		_, r, err := Resize(p, f, DefaultResizeOptions())
+		if err != nil {
+			t.Fatalf("x%v: %v", f, err)
+		}
+		for k, runs := range []int{2, 1, 1} {
+			d := r.Density[k]
+			if d.Runs != runs || d.Before == 0 || math.Abs(d.Change()) > 20 {
+				t.Errorf("x%v: %s density %+v changed %.1f%%", f, Kind(k), d, d.Change())
+			}
+		}
+	}
+}
+
+func TestResizePull(t *testing.T) {
+	o := DefaultResizeOptions()
+	for _, tc := range []struct {
+		w, f, want float32 // units at 10 per mm
+	}{
+		{15, 2, 28.6},    // 1.3mm and the least 0.2mm, then 2.6mm and 10% of it
+		{100, 2, 200},    // compensated in proportion so it simply scales
+		{30, 0.5, 15.64}, // 10% of 3mm, so 2.73mm then 1.36mm and the least 0.2mm
+	} {
+		p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{satin(0, 0, 30, tc.w, 4)}})
+		q, _, err := Resize(p, tc.f, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pen := sewn(q)
+		mid := pen[len(pen)/2]
+		got := math.Abs(float64(mid.X - pen[len(pen)/2-1].X))
+		if math.Abs(got-float64(tc.want)) > 0.05 {
+			t.Errorf("%v wide x%v: %.2f wide, want %v", tc.w, tc.f, got, tc.want)
+		}
+	}
+}
+
+func TestResizeUnderlay(t *testing.T) {
+	pt := func(x, y float32) shared.Point { return shared.Point{X: x, Y: y} }
+	// an edge walk 0.5mm inside a 6mm column - up the right, across the top and down the left -
+	// then the satin over it
+	run := line(pt(55, 0), pt(55, 116))
+	run = append(run, line(pt(55, 116), pt(5, 116))[1:]...)
+	run = append(run, line(pt(5, 116), pt(5, 0))[1:]...)
+	run = append(run, satin(0, 0, 30, 60, 4)...)
+	p := design(blk{thread("1", 0, 0, 0), [][]shared.Point{run, line(pt(200, 0), pt(200, 100))}})
+
+	// a fixed 1mm compensation leaves the column 11mm wide at twice the size, not 12
+	o := ResizeOptions{Pull: 1, Corner: 30}
+	q, r, err := Resize(p, 2, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Underlay != 1 || r.Density[Satin].Runs != 1 {
+		t.Fatalf("report %v, want one satin and one underlay", r)
+	}
+	pts := sewn(q)
+	var top float32
+	for _, p := range pts {
+		if p.X < 150 {
+			top = max(top, p.Y)
+		}
+	}
+	left, right := float32(math.Inf(1)), float32(math.Inf(-1))
+	for _, p := range pts {
+		if p.X < 150 && p.Y > 20 && p.Y < top-20 && math.Abs(float64(p.X-60)) < 50 {
+			// only underlay lies well inside the column
+			left = min(left, p.X)
+			right = max(right, p.X)
+		}
+	}
+	// the walk stays 0.5mm in from each edge scaled with the column - 25mm from the middle
+	// scaled by 2 and 11/12
+	want := float32(50 * 11.0 / 12)
+	if math.Abs(float64(60-left-want)) > 0.5 || math.Abs(float64(right-60-want)) > 0.5 {
+		t.Errorf("underlay from %.2f to %.2f, want %.2f either side of 60", left, right, want)
+	}
+
+	// running stitches outside any satin are not underlay
+	p = design(blk{thread("1", 0, 0, 0), [][]shared.Point{line(pt(200, 0), pt(200, 100)), satin(0, 0, 30, 60, 4)}})
+	if _, r, _ = Resize(p, 2, o); r.Underlay != 0 {
+		t.Errorf("%d underlay runs, want none", r.Underlay)
+	}
+}
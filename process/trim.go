@@ -0,0 +1,138 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// TrimStyle is how a design marks a trim
+type TrimStyle int
+
+const (
+	TrimCommand TrimStyle = iota // a command of its own - pes flags, jef 80 02 00 00
+	TrimJumps                    // a run of jumps the machine reads as a trim - dst and machines without a trim command
+)
+
+// TrimPolicy says how trims are normalised. The zero policy reads and writes trim commands
+type TrimPolicy struct {
+	In     TrimStyle // how the payload marks trims
+	Out    TrimStyle // how the result marks trims
+	Jumps  int       // jumps that make a trim in the jump style, 3 when 0
+	Before float32   // mm - add a trim before jumps longer than this, 0 adds none
+	Strip  float32   // mm - remove trims followed by a jump shorter than this, 0 removes none
+}
+
+// TrimReport describes what NormalizeTrims did
+type TrimReport struct {
+	Added   int
+	Removed int
+}
+
+// String summarises the report
+func (r TrimReport) String() string {
+	return fmt.Sprintf("trims added %d, removed %d", r.Added, r.Removed)
+}
+
+// travel_end finds the end of the travel starting at i - the first command that sews, changes
+// color or ends
+func travel_end(cmds []shared.PCommand, i int) int {
+	for ; i < len(cmds); i++ {
+		c := cmds[i]
+		if sews(c) || c.Command1 == shared.ColorChg || c.Command1 == shared.End {
+			break
+		}
+	}
+	return i
+}
+
+// trimmed tests if a stretch of travel holds a trim in the given style
+func trimmed(travel []shared.PCommand, style TrimStyle, jumps int) bool {
+	n := 0
+	for _, c := range travel {
+		if trims(c) {
+			return true
+		}
+		if c.Command1 == shared.Jump {
+			n++
+		}
+	}
+	return style == TrimJumps && n >= jumps
+}
+
+// trim_cmds makes a trim that does not move the needle in the given style. The jump style
+// swings 0.2mm either side and comes back
+func trim_cmds(style TrimStyle, jumps int, unit float32) []shared.PCommand {
+	if style == TrimCommand {
+		return []shared.PCommand{trim_at(shared.Point{}).PCommand}
+	}
+	d := 0.2 * unit
+	l := make([]shared.PCommand, jumps)
+	var at float32
+	for k := range l {
+		to := d
+		switch {
+		case k == jumps-1:
+			to = 0
+		case k%2 == 1:
+			to = -d
+		}
+		l[k] = shared.PCommand{Command1: shared.Jump, Dx: to - at, Dy: to - at}
+		at = to
+	}
+	return l
+}
+
+// NormalizeTrims rewrites the trims of p to the policy. Travel that keeps its trim and style is
+// left as it is. Travel that changes becomes an optional trim followed by a single jump
+func NormalizeTrims(p *shared.Payload, pol TrimPolicy) (*shared.Payload, TrimReport) {
+	var r TrimReport
+	if pol.Jumps <= 0 {
+		pol.Jumps = 3
+	}
+	u := unit(p)
+	q := p.Clone()
+	q.Cmds = nil
+	q.Offsets = nil
+	for i := 0; i < len(p.Cmds); {
+		end := travel_end(p.Cmds, i)
+		if end == i {
+			q.Cmds = append(q.Cmds, p.Cmds[i])
+			i++
+			continue
+		}
+		travel := p.Cmds[i:end]
+		var dx, dy float32
+		for _, c := range travel {
+			dx += c.Dx
+			dy += c.Dy
+		}
+		d := dist(shared.Point{}, shared.Point{X: dx, Y: dy}) / u
+		had := trimmed(travel, pol.In, pol.Jumps)
+		want := had || pol.Before > 0 && d > pol.Before
+		// a trim before a color change or the end is left for the machine
+		if had && pol.Strip > 0 && d < pol.Strip && end < len(p.Cmds) && sews(p.Cmds[end]) {
+			want = false
+		}
+		switch {
+		case want && !had:
+			r.Added++
+		case had && !want:
+			r.Removed++
+		}
+		if want == had && (!had || pol.In == pol.Out) {
+			q.Cmds = append(q.Cmds, travel...)
+			i = end
+			continue
+		}
+		if want {
+			q.Cmds = append(q.Cmds, trim_cmds(pol.Out, pol.Jumps, u)...)
+		}
+		if dx != 0 || dy != 0 {
+			q.Cmds = append(q.Cmds, shared.PCommand{Command1: shared.Jump, Dx: dx, Dy: dy})
+		}
+		i = end
+	}
+	q.SetBlocks(p.Threads())
+	return q, r
+}
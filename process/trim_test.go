@@ -0,0 +1,133 @@
+package process
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// trimmed_design sews two runs 25mm apart with a trim command on the travel between them
+func trimmed_design() *shared.Payload {
+	p := design(blk{thread("1", 255, 0, 0), [][]shared.Point{
+		line(shared.Point{X: 0, Y: 0}, shared.Point{X: 50, Y: 0}),
+		line(shared.Point{X: 300, Y: 0}, shared.Point{X: 350, Y: 0}),
+	}})
+	i := slices.IndexFunc(p.Cmds[1:], func(c shared.PCommand) bool { return c.Command1 == shared.Jump }) + 1
+	p.Cmds = slices.Insert(p.Cmds, i, trim_at(shared.Point{}).PCommand)
+	p.SetBlocks(p.Threads())
+	return p
+}
+
+// travels returns the commands of each stretch of travel of p
+func travels(p *shared.Payload) [][]shared.PCommand {
+	var l [][]shared.PCommand
+	for i := 0; i < len(p.Cmds); {
+		end := travel_end(p.Cmds, i)
+		if end == i {
+			i++
+			continue
+		}
+		l = append(l, p.Cmds[i:end])
+		i = end
+	}
+	return l
+}
+
+// jump_trim checks travel is a trim of n jumps, swinging no more than 0.2mm, and a jump
+func jump_trim(t *testing.T, travel []shared.PCommand, n int, scale float32) {
+	t.Helper()
+	if len(travel) != n+1 {
+		t.Fatalf("travel %v, want %d jumps of trim and one of travel", travel, n)
+	}
+	var at shared.Point
+	for _, c := range travel {
+		if c.Command1 != shared.Jump || trims(c) {
+			t.Fatalf("travel %v holds more than jumps", travel)
+		}
+	}
+	for _, c := range travel[:n] {
+		at.X += c.Dx
+		at.Y += c.Dy
+		if dist(shared.Point{}, at) > 0.3*scale {
+			t.Errorf("trim swings %v from the needle", at)
+		}
+	}
+	if at != (shared.Point{}) {
+		t.Errorf("trim leaves the needle %v away", at)
+	}
+}
+
+func TestTrimsToJumps(t *testing.T) {
+	p := trimmed_design()
+	q, r := NormalizeTrims(p, TrimPolicy{In: TrimCommand, Out: TrimJumps})
+	if r.Added != 0 || r.Removed != 0 {
+		t.Errorf("%v for a change of style", r)
+	}
+	same_stitches(t, p, q)
+	if !slices.Equal(q.Positions()[len(q.Cmds)-1:], p.Positions()[len(p.Cmds)-1:]) {
+		t.Error("the needle ends somewhere else")
+	}
+	tr := travels(q)
+	if len(tr) != 2 || len(tr[0]) != 1 {
+		t.Fatalf("travel %v, want the first jump untouched and one trim", tr)
+	}
+	jump_trim(t, tr[1], 3, q.Scale)
+
+	// a longer run of jumps when the machine wants one
+	q, _ = NormalizeTrims(p, TrimPolicy{In: TrimCommand, Out: TrimJumps, Jumps: 5})
+	jump_trim(t, travels(q)[1], 5, q.Scale)
+
+	// jumps added for long travel are in the output style too
+	plain := design(blk{thread("1", 255, 0, 0), [][]shared.Point{
+		line(shared.Point{X: 0, Y: 0}, shared.Point{X: 50, Y: 0}),
+		line(shared.Point{X: 300, Y: 0}, shared.Point{X: 350, Y: 0}),
+	}})
+	q, r = NormalizeTrims(plain, TrimPolicy{Out: TrimJumps, Before: 10})
+	if r.Added != 1 {
+		t.Errorf("%v, want one trim added", r)
+	}
+	same_stitches(t, plain, q)
+	jump_trim(t, travels(q)[1], 3, q.Scale)
+}
+
+func TestJumpsToTrims(t *testing.T) {
+	p := trimmed_design()
+	jumps, _ := NormalizeTrims(p, TrimPolicy{Out: TrimJumps})
+	q, r := NormalizeTrims(jumps, TrimPolicy{In: TrimJumps, Out: TrimCommand})
+	if r.Added != 0 || r.Removed != 0 {
+		t.Errorf("%v for a change of style", r)
+	}
+	if !slices.Equal(q.Cmds, p.Cmds) {
+		t.Errorf("round trip gave\n%v\nwant\n%v", q.Cmds, p.Cmds)
+	}
+
+	// fewer jumps than the policy asks for are only travel
+	q, _ = NormalizeTrims(jumps, TrimPolicy{In: TrimJumps, Out: TrimCommand, Jumps: 5})
+	if !slices.Equal(q.Cmds, jumps.Cmds) {
+		t.Error("a run of 3 jumps made a trim of 5")
+	}
+	// and the jumps are not read as a trim at all in the command style
+	q, r = NormalizeTrims(jumps, TrimPolicy{})
+	if r.Added != 0 || !slices.Equal(q.Cmds, jumps.Cmds) {
+		t.Errorf("command style changed jump travel: %v", r)
+	}
+}
+
+func TestTrimPolicy(t *testing.T) {
+	p := trimmed_design()
+	// a trim before 25mm of travel is kept under a 10mm strip and removed under a 30mm one
+	if q, r := NormalizeTrims(p, TrimPolicy{Strip: 10}); r.Removed != 0 || !slices.Equal(q.Cmds, p.Cmds) {
+		t.Errorf("strip 10 gave %v", r)
+	}
+	q, r := NormalizeTrims(p, TrimPolicy{Strip: 30})
+	if r.Removed != 1 || slices.ContainsFunc(q.Cmds, trims) {
+		t.Errorf("strip 30 gave %v", r)
+	}
+	same_stitches(t, p, q)
+	// and comes back under before
+	q, r = NormalizeTrims(q, TrimPolicy{Before: 20})
+	if r.Added != 1 || !slices.Equal(q.Cmds, p.Cmds) {
+		t.Errorf("before 20 gave %v", r)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+** render
+** draws payloads without a display - the composers, headless renders, overlays and mockups.
+** Nothing here needs cgo so it builds for batch jobs and servers
+ */
+
+package render
+
+import (
+	"image/color"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/process"
+)
+
+/*
+** Interface composer
+ */
+
+/*
+** Setup: does whatever is needed to setup this dingle. ox, oy is where the centre of the design
+**        goes - canvases are 2*ox by 2*oy, see Centre
+** Line: draws a line between two points, takes x1,y1,x2,y2 and a color.Color
+** Guide: draws an overlay line - hoop, grid, crosshair or ruler tick - without moving the needle
+** Label: writes a ruler number anchored at a point
+** Get: returns the object we are working with - image, container etc
+** Display: displays the image on a screen - jpg, fyne img etc
+ */
+
+type Composer interface {
+	Setup(ox, oy float32, name string)
+	SetPos(ox, oy float32)
+	Line(ex, ey float32, c color.Color)
+	Guide(x1, y1, x2, y2 float32, k GuideKind)
+	Label(x, y float32, text string, ax, ay float32)
+	Get() any
+	Display()
+}
+
+/*
+** Decoding - Command1 and Command2 combined
+ */
+
+// Step is one command as the machine sees it. Op is Stitch, Jump, Trim, ColorChg or End.
+// A pec long stitch carries a flag for each half so a jump or trim in either half makes the whole
+// move a jump or trim
+type Step struct {
+	Index int // command index
+	Op    int
+	From  shared.Point
+	To    shared.Point
+	Block int
+	Color color.Color // thread color of the block
+}
+
+// op combines the two halves of a command
+func op(c shared.PCommand) int {
+	switch {
+	case c.Command1 == shared.ColorChg || c.Command1 == shared.End:
+		return c.Command1
+	case c.Command1 == shared.Trim || c.Command2 == shared.Trim:
+		return shared.Trim
+	case c.Command1 == shared.Jump || c.Command2 == shared.Jump:
+		return shared.Jump
+	}
+	return shared.Stitch
+}
+
+// Walk decodes the commands of p in order and calls fn with each step. It stops after End or
+// when fn returns false
+func Walk(p *shared.Payload, fn func(Step) bool) {
+	cols := p.Colors()
+	pos := p.Positions()
+	var at shared.Point
+	block := 0
+	for i, c := range p.Cmds {
+		s := Step{Index: i, Op: op(c), From: at, To: pos[i], Block: block}
+		if s.Op == shared.ColorChg {
+			block = c.Color
+			s.Block = block
+		}
+		if s.Block < len(cols) {
+			s.Color = cols[s.Block]
+		} else {
+			s.Color = color.Black
+		}
+		if !fn(s) || s.Op == shared.End {
+			return
+		}
+		at = pos[i]
+	}
+}
+
+// ColorMode chooses what the color of a stitch shows
+type ColorMode int
+
+const (
+	ThreadColors ColorMode = iota // the thread of each block
+	KindColors                    // running, satin and fill in the colors of TypeColors
+)
+
+// TypeColors are the colors of each kind of stitching in KindColors mode
+var TypeColors = map[process.Kind]color.Color{
+	process.Running: color.RGBA{0x1f, 0x77, 0xb4, 0xff},
+	process.Satin:   color.RGBA{0xff, 0x7f, 0x0e, 0xff},
+	process.Fill:    color.RGBA{0x2c, 0xa0, 0x2c, 0xff},
+}
+
+// Centre returns where a composer puts the centre of p - half the width and height of a canvas
+// that takes in the stitches and the overlays with a mm to spare
+func Centre(p *shared.Payload, o Overlays) (float32, float32) {
+	minx, miny, maxx, maxy := Extent(p, o)
+	u := float64(max(p.Scale, 1))
+	ox := max(-minx, maxx, float64(p.Width/2)) + u
+	oy := max(-miny, maxy, float64(p.Height/2)) + u
+	return float32(ox), float32(oy)
+}
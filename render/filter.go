@@ -0,0 +1,59 @@
+package render
+
+import (
+	"image/color"
+	"slices"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Filter picks the parts of a design to draw. The zero filter draws everything
+type Filter struct {
+	Blocks []int   // color blocks to draw, nil for all
+	From   int     // first command to draw
+	To     int     // index after the last command to draw, 0 for the end
+	Ops    []int   // Stitch, Jump and Trim steps to draw, nil for all
+	Ghost  bool    // draw what is left out as faint lines rather than leaving it out
+	Fade   float64 // how far ghosted lines fade towards white from 0 to 1, 0 for 0.85
+}
+
+// Keep tests if a step passes the filter
+func (f Filter) Keep(s Step) bool {
+	if f.Blocks != nil && !slices.Contains(f.Blocks, s.Block) {
+		return false
+	}
+	if s.Index < f.From || f.To > 0 && s.Index >= f.To {
+		return false
+	}
+	return f.Ops == nil || slices.Contains(f.Ops, s.Op)
+}
+
+// Color returns the color a step drawn in col is drawn in through the filter, false when the
+// filter leaves it out
+func (f Filter) Color(s Step, col color.Color) (color.Color, bool) {
+	switch {
+	case f.Keep(s):
+		return col, true
+	case f.Ghost:
+		return ghost(col, f.Fade), true
+	}
+	return nil, false
+}
+
+// ghost fades a color towards white for parts of a design a filter leaves out
+func ghost(col color.Color, fade float64) color.Color {
+	if fade <= 0 || fade > 1 {
+		fade = 0.85
+	}
+	return tint(col, fade)
+}
+
+// BlockFilters returns a filter for each color block of p that keeps the rest of f
+func BlockFilters(p *shared.Payload, f Filter) []Filter {
+	l := make([]Filter, len(p.Blocks))
+	for b := range p.Blocks {
+		l[b] = f
+		l[b].Blocks = []int{b}
+	}
+	return l
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+func TestFilterKeep(t *testing.T) {
+	s := Step{Index: 5, Op: shared.Stitch, Block: 1}
+	for _, tc := range []struct {
+		f    Filter
+		keep bool
+	}{
+		{Filter{}, true},
+		{Filter{Blocks: []int{0, 1}}, true},
+		{Filter{Blocks: []int{0}}, false},
+		{Filter{Blocks: []int{}}, false},
+		{Filter{From: 5, To: 6}, true},
+		{Filter{From: 6}, false},
+		{Filter{To: 5}, false},
+		{Filter{Ops: []int{shared.Stitch}}, true},
+		{Filter{Ops: []int{shared.Jump, shared.Trim}}, false},
+	} {
+		if got := tc.f.Keep(s); got != tc.keep {
+			t.Errorf("%+v keeps %v, want %v", tc.f, got, tc.keep)
+		}
+	}
+}
+
+func TestFilterHide(t *testing.T) {
+	p := sample()
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for _, tc := range []struct {
+		f    Filter
+		want color.Color // the pixel of the hidden red line
+	}{
+		{Filter{Blocks: []int{1, 2}}, white},
+		{Filter{Blocks: []int{1, 2}, Ghost: true}, color.RGBA{0xff, 0xd8, 0xd8, 0xff}},            // 85% of the way to white
+		{Filter{Blocks: []int{1, 2}, Ghost: true, Fade: 0.5}, color.RGBA{0xff, 0x7f, 0x7f, 0xff}}, // half way
+		{Filter{To: 11}, red}, // the red line is the first 11 commands
+	} {
+		o := plain()
+		o.Filter = tc.f
+		img, err := Render(p, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := at(img, 60, 10); got != tc.want {
+			t.Errorf("%+v: red line pixel %v, want %v", tc.f, got, tc.want)
+		}
+		// what the filter keeps is drawn as it is
+		blue_kept := tc.f.To == 0
+		if got := at(img, 60, 110); (got == blue) != blue_kept {
+			t.Errorf("%+v: blue line pixel %v", tc.f, got)
+		}
+	}
+}
+
+func TestRenderBlocks(t *testing.T) {
+	p := sample()
+	o := plain()
+	imgs, err := RenderBlocks(p, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != len(p.Blocks) {
+		t.Fatalf("%d images for %d blocks", len(imgs), len(p.Blocks))
+	}
+	whole, _ := Render(p, o)
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	// each image holds its own block, in the place it has in the whole design
+	pixels := []image.Point{{60, 10}, {60, 110}, {60, 60}}
+	for k, img := range imgs {
+		if img.Bounds() != whole.Bounds() {
+			t.Errorf("block %d is %v, want %v", k, img.Bounds(), whole.Bounds())
+		}
+		for j, pt := range pixels {
+			got := at(img, pt.X, pt.Y)
+			switch {
+			case j == k && got != at(whole, pt.X, pt.Y):
+				t.Errorf("block %d: pixel %v is %v, want %v", k, pt, got, at(whole, pt.X, pt.Y))
+			case j != k && got != white:
+				t.Errorf("block %d: pixel %v of block %d is %v, want it left out", k, pt, j, got)
+			}
+		}
+	}
+
+	// the rest of the filter still applies to each image
+	o.Filter = Filter{Ghost: true}
+	o.Filter.Ops = []int{shared.Jump}
+	imgs, _ = RenderBlocks(p, o)
+	if got := at(imgs[0], 60, 10); got != color.RGBAModel.Convert(ghost(red, 0)) {
+		t.Errorf("ghosted stitches of block 0 are %v", got)
+	}
+	if _, err := RenderBlocks(&shared.Payload{Cmds: p.Cmds}, o); err == nil {
+		t.Error("no blocks: no error")
+	}
+}
@@ -0,0 +1,229 @@
+package render
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/process"
+	"github.com/fogleman/gg"
+)
+
+// MockupOptions places a design on a garment photo. Positions and sizes are in mm from the top
+// left of the photo
+type MockupOptions struct {
+	X      float64
+	Y      float64
+	Width  float64 // the design is fitted inside the placement keeping its shape
+	Height float64
+	PPM    float64 // photo pixels per mm - measure something of known size in the photo
+	Weight int     // thread weight - 40 is the common embroidery thread
+	Shadow float64 // mm the drop shadow spreads, 0 for none
+	Offset float64 // mm the shadow falls down and to the right
+	Dark   float64 // how dark the shadow is from 0 to 1
+	Blend  float64 // how much of the light and shade of the garment shows on the thread from 0 to 1
+	Mode   ColorMode
+}
+
+// DefaultMockupOptions returns a 40 weight design with a soft 1mm shadow and half the garment
+// shading showing through. The placement and calibration are left to the caller
+func DefaultMockupOptions() MockupOptions {
+	return MockupOptions{
+		Weight: 40,
+		Shadow: 1.0,
+		Offset: 0.5,
+		Dark:   0.45,
+		Blend:  0.5,
+	}
+}
+
+// Mockup draws p as thread on a copy of a garment photo
+func Mockup(garment image.Image, p *shared.Payload, o MockupOptions) (image.Image, error) {
+	if garment == nil {
+		return nil, errors.New("mockup: no garment")
+	}
+	if p == nil || len(p.Cmds) == 0 {
+		return nil, errors.New("mockup: nothing to draw")
+	}
+	if o.PPM <= 0 || o.Width <= 0 || o.Height <= 0 {
+		return nil, errors.New("mockup: placement and calibration must be positive")
+	}
+	out := image.NewRGBA(garment.Bounds())
+	draw.Draw(out, out.Bounds(), garment, garment.Bounds().Min, draw.Src)
+
+	// fit the design in the placement in photo pixels
+	minx, miny, maxx, maxy := bounds(drawn(p, false))
+	w := max(maxx-minx, 1)
+	h := max(maxy-miny, 1)
+	s := min(o.Width*o.PPM/w, o.Height*o.PPM/h)
+	ox := float64(out.Bounds().Min.X) + o.X*o.PPM + (o.Width*o.PPM-w*s)/2 - minx*s
+	oy := float64(out.Bounds().Min.Y) + o.Y*o.PPM + (o.Height*o.PPM-h*s)/2 - miny*s
+
+	// sew the design on a clear layer covering the placement, the thread either side of it and
+	// the spread of the shadow. Three box blurs spread the shadow three times its radius
+	width := max(1, 16.0/float64(max(o.Weight, 1))*o.PPM)
+	r := int(math.Round(max(o.Shadow, 0) * o.PPM))
+	d := int(math.Round(max(o.Offset, 0) * o.PPM))
+	m := int(math.Ceil(width)) + 3*r + 1
+	place := image.Rect(int(math.Floor(o.X*o.PPM)), int(math.Floor(o.Y*o.PPM)),
+		int(math.Ceil((o.X+o.Width)*o.PPM)), int(math.Ceil((o.Y+o.Height)*o.PPM)))
+	area := place.Add(out.Bounds().Min).Inset(-m).Intersect(out.Bounds())
+	if area.Empty() {
+		return out, nil
+	}
+	layer := image.NewRGBA(image.Rect(0, 0, area.Dx(), area.Dy()))
+	dc := gg.NewContextForRGBA(layer)
+	dc.SetLineCap(gg.LineCapRound)
+	// gg gradients ignore its transform so the design is moved into the layer by hand
+	ox -= float64(area.Min.X)
+	oy -= float64(area.Min.Y)
+	rnd := rand.New(rand.NewSource(1))
+	var kinds []process.Kind
+	if o.Mode == KindColors {
+		kinds = process.Kinds(p)
+	}
+	Walk(p, func(st Step) bool {
+		if st.Op != shared.Stitch {
+			return true
+		}
+		col := st.Color
+		if kinds != nil {
+			col = TypeColors[kinds[st.Index]]
+		}
+		thread_stroke(dc, ox+float64(st.From.X)*s, oy+float64(st.From.Y)*s, ox+float64(st.To.X)*s,
+			oy+float64(st.To.Y)*s, width, col, 0.25+0.2*rnd.Float64())
+		return true
+	})
+
+	layer.Rect = area // the layer now sits over the photo
+
+	if o.Blend > 0 {
+		shade_layer(layer, garment, o.Blend)
+	}
+	if r > 0 || d > 0 {
+		shadow := blur_alpha(layer, r)
+		dark := min(max(o.Dark, 0), 1)
+		for k, v := range shadow.Pix {
+			shadow.Pix[k] = uint8(float64(v) * dark)
+		}
+		at := area.Add(image.Pt(d, d)).Intersect(out.Bounds())
+		draw.DrawMask(out, at, image.Black, image.Point{}, shadow, at.Min.Sub(image.Pt(d, d)), draw.Over)
+	}
+	draw.Draw(out, area, layer, area.Min, draw.Over)
+	return out, nil
+}
+
+// shade_layer lets the folds and texture of the garment show on the thread. Each pixel is lit by
+// how bright the garment is there compared with the average under the design
+func shade_layer(layer *image.RGBA, garment image.Image, blend float64) {
+	lum := func(x, y int) float64 {
+		r, g, b, _ := garment.At(x, y).RGBA()
+		return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+	}
+	r := layer.Bounds()
+	var sum float64
+	n := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if layer.RGBAAt(x, y).A > 0 {
+				sum += lum(x, y)
+				n++
+			}
+		}
+	}
+	if n == 0 || sum == 0 {
+		return
+	}
+	mean := sum / float64(n)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := layer.RGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+			k := 1 + blend*(min(max(lum(x, y)/mean, 0.5), 1.5)-1)
+			f := func(v uint8) uint8 {
+				return uint8(min(float64(c.A), float64(v)*k)) // premultiplied so never above alpha
+			}
+			layer.SetRGBA(x, y, color.RGBA{f(c.R), f(c.G), f(c.B), c.A})
+		}
+	}
+}
+
+// blur_alpha softens the outline of a layer with three box blurs of radius r, close to a gaussian
+func blur_alpha(layer *image.RGBA, r int) *image.Alpha {
+	b := layer.Bounds()
+	w, h := b.Dx(), b.Dy()
+	a := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a[y*w+x] = float64(layer.RGBAAt(b.Min.X+x, b.Min.Y+y).A)
+		}
+	}
+	if r > 0 {
+		tmp := make([]float64, w*h)
+		for pass := 0; pass < 3; pass++ {
+			box(a, tmp, h, w, r, w, 1) // rows
+			box(tmp, a, w, h, r, 1, w) // columns
+		}
+	}
+	out := image.NewAlpha(b)
+	for k, v := range a {
+		out.Pix[(k/w)*out.Stride+k%w] = uint8(min(v, 255))
+	}
+	return out
+}
+
+// box averages src into dst along lines of n values. step moves along a line and next to the
+// following line
+func box(src, dst []float64, lines, n, r, next, step int) {
+	for l := 0; l < lines; l++ {
+		base := l * next
+		var sum float64
+		for k := -r; k <= r; k++ {
+			sum += src[base+min(max(k, 0), n-1)*step]
+		}
+		for k := 0; k < n; k++ {
+			dst[base+k*step] = sum / float64(2*r+1)
+			sum += src[base+min(k+r+1, n-1)*step] - src[base+max(k-r, 0)*step]
+		}
+	}
+}
+
+// LoadGarment reads a png or jpeg photo
+func LoadGarment(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// SaveMockup writes a mockup as a jpeg when the file ends in .jpg or .jpeg, otherwise as a png
+func SaveMockup(file string, img image.Image) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 92})
+	default:
+		err = png.Encode(f, img)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// garment is a plain grey photo 200 by 150mm at 2 pixels per mm
+func garment() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0x80, 0x80, 0x80, 0xff}), image.Point{}, draw.Src)
+	return img
+}
+
+// placed puts the 100 unit sample in a 50mm square 50mm in and 40mm down - a pixel a unit with
+// the top left of the design at 100,80
+func placed() MockupOptions {
+	o := DefaultMockupOptions()
+	o.X, o.Y = 50, 40
+	o.Width, o.Height = 50, 50
+	o.PPM = 2
+	return o
+}
+
+// nearest names the thread of the sample a pixel shows by its strongest channel, grey for the
+// garment. Shading and sheen change how bright thread is but not its hue
+func nearest(c color.RGBA) string {
+	r, g, b := int(c.R), int(c.G), int(c.B)
+	switch {
+	case r > g+40 && r > b+40:
+		return "red"
+	case b > r+40 && b > g+40:
+		return "blue"
+	case g > r+40 && g > b+40:
+		return "green"
+	}
+	return "grey"
+}
+
+func TestMockup(t *testing.T) {
+	g := garment()
+	o := placed()
+	img, err := Mockup(g, sample(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != g.Bounds() {
+		t.Fatalf("mockup is %v, want %v", img.Bounds(), g.Bounds())
+	}
+
+	// nothing changes beyond the thread and its shadow around the placement
+	width := 16.0 / float64(o.Weight) * o.PPM
+	m := int(math.Ceil(width)) + 3*int(math.Round(o.Shadow*o.PPM)) + 1
+	place := image.Rect(100, 80, 200, 180)
+	b := g.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !image.Pt(x, y).In(place.Inset(-m)) && at(img, x, y) != at(g, x, y) {
+				t.Fatalf("pixel %d,%d outside the placement changed to %v", x, y, at(img, x, y))
+			}
+		}
+	}
+
+	// each thread shows inside the placement
+	seen := map[string]int{}
+	for y := place.Min.Y; y < place.Max.Y; y++ {
+		for x := place.Min.X; x < place.Max.X; x++ {
+			seen[nearest(at(img, x, y))]++
+		}
+	}
+	for _, name := range []string{"red", "blue", "green"} {
+		if seen[name] == 0 {
+			t.Errorf("no %s thread in the placement: %v", name, seen)
+		}
+	}
+	if nearest(at(img, 150, 80)) != "red" || nearest(at(img, 150, 180)) != "blue" {
+		t.Errorf("lines at %v and %v", at(img, 150, 80), at(img, 150, 180))
+	}
+}
+
+func TestMockupShadow(t *testing.T) {
+	g := garment()
+	o := placed()
+	o.Shadow = 0 // a hard shadow 3mm down and right of the thread
+	o.Offset = 3
+	o.Dark = 0.5
+	img, err := Mockup(g, sample(), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the red line runs along y 80 so its shadow is 6 pixels below and right of it
+	shade, plain := at(img, 150, 86), at(img, 150, 95)
+	if shade.R >= 0x80 || shade.R < 0x30 {
+		t.Errorf("shadow pixel %v, want the grey darkened", shade)
+	}
+	if plain != at(g, 150, 95) {
+		t.Errorf("pixel away from the shadow %v, want it left alone", plain)
+	}
+
+	o.Dark = 0
+	img, _ = Mockup(g, sample(), o)
+	if got := at(img, 150, 86); got != at(g, 150, 86) {
+		t.Errorf("a shadow with no darkness changed %v", got)
+	}
+}
+
+func TestMockupErrors(t *testing.T) {
+	g := garment()
+	p := sample()
+	for name, edit := range map[string]func(*MockupOptions){
+		"no ppm":       func(o *MockupOptions) { o.PPM = 0 },
+		"negative ppm": func(o *MockupOptions) { o.PPM = -2 },
+		"no width":     func(o *MockupOptions) { o.Width = 0 },
+	} {
+		o := placed()
+		edit(&o)
+		if _, err := Mockup(g, p, o); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if _, err := Mockup(nil, p, placed()); err == nil {
+		t.Error("nil garment: no error")
+	}
+	if _, err := Mockup(g, nil, placed()); err == nil {
+		t.Error("nil payload: no error")
+	}
+}
@@ -0,0 +1,208 @@
+package render
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Overlays are guides drawn under a design to help position it. Lengths are in mm
+type Overlays struct {
+	Hoop   bool        // the hoop outline and its sewing field
+	Use    shared.Hoop // the hoop to draw - zero for the hoop the design was saved with
+	Grid   float32     // grid spacing, 0 for no grid
+	Cross  bool        // crosshairs through the centre
+	Rulers bool        // rulers along the top and left edges marked from the centre
+}
+
+// Any tests if any overlay is turned on
+func (o Overlays) Any() bool {
+	return o.Hoop || o.Grid > 0 || o.Cross || o.Rulers
+}
+
+// GuideKind is what a guide line belongs to
+type GuideKind int
+
+const (
+	HoopEdge GuideKind = iota
+	SewingField
+	GridLine
+	Crosshair
+	RulerTick
+)
+
+// GuideColors are the colors of each kind of guide
+var GuideColors = map[GuideKind]color.Color{
+	HoopEdge:    color.RGBA{0x55, 0x55, 0x55, 0xff},
+	SewingField: color.RGBA{0x1f, 0x77, 0xb4, 0xff},
+	GridLine:    color.RGBA{0xd0, 0xd0, 0xd0, 0xff},
+	Crosshair:   color.RGBA{0xd6, 0x27, 0x28, 0xff},
+	RulerTick:   color.RGBA{0x33, 0x33, 0x33, 0xff},
+}
+
+// Guide is one line of an overlay in payload units
+type Guide struct {
+	Kind GuideKind
+	A    shared.Point
+	B    shared.Point
+}
+
+// Label is a ruler number. AX and AY place the anchor - 0 left or top, 0.5 centre, 1 right or bottom
+type Label struct {
+	At   shared.Point
+	Text string
+	AX   float32
+	AY   float32
+}
+
+// field returns the half width and height of the area the overlays cover in payload units. It is
+// the sewing field of the hoop when known, otherwise the design rounded out to whole cm
+func field(p *shared.Payload, h shared.Hoop) (float32, float32) {
+	u := p.Scale
+	if u <= 0 {
+		u = 1
+	}
+	if h.Known() {
+		return h.Width / 2 * u, h.Height / 2 * u
+	}
+	minx, miny, maxx, maxy := bounds(drawn(p, false))
+	if math.IsInf(minx, 0) {
+		return 10 * u, 10 * u
+	}
+	cm := float64(10 * u)
+	hw := math.Ceil(max(-minx, maxx)/cm) * cm
+	hh := math.Ceil(max(-miny, maxy)/cm) * cm
+	return float32(max(hw, cm)), float32(max(hh, cm))
+}
+
+// Guides works out the guides and labels for p. The origin is the centre of the hoop
+func Guides(p *shared.Payload, o Overlays) ([]Guide, []Label) {
+	var g []Guide
+	var l []Label
+	if !o.Any() {
+		return nil, nil
+	}
+	u := p.Scale
+	if u <= 0 {
+		u = 1
+	}
+	h := o.Use
+	if !h.Known() {
+		h = p.Hoop
+	}
+	hw, hh := field(p, h)
+	line := func(k GuideKind, x1, y1, x2, y2 float32) {
+		g = append(g, Guide{Kind: k, A: shared.Point{X: x1, Y: y1}, B: shared.Point{X: x2, Y: y2}})
+	}
+
+	if o.Grid > 0 {
+		step := o.Grid * u
+		for x := float32(0); x <= hw; x += step {
+			line(GridLine, x, -hh, x, hh)
+			if x > 0 {
+				line(GridLine, -x, -hh, -x, hh)
+			}
+		}
+		for y := float32(0); y <= hh; y += step {
+			line(GridLine, -hw, y, hw, y)
+			if y > 0 {
+				line(GridLine, -hw, -y, hw, -y)
+			}
+		}
+	}
+	if o.Hoop && h.Known() {
+		line(SewingField, -hw, -hh, hw, -hh)
+		line(SewingField, hw, -hh, hw, hh)
+		line(SewingField, hw, hh, -hw, hh)
+		line(SewingField, -hw, hh, -hw, -hh)
+		g = append(g, rounded(hw+h.Frame*u, hh+h.Frame*u, h.Frame*u)...)
+	}
+	if o.Cross {
+		line(Crosshair, -hw, 0, hw, 0)
+		line(Crosshair, 0, -hh, 0, hh)
+	}
+	if o.Rulers {
+		for k := 0; float32(k)*u <= max(hw, hh); k++ {
+			n := float32(1)
+			switch {
+			case k%10 == 0:
+				n = 3
+			case k%5 == 0:
+				n = 2
+			}
+			for _, s := range []float32{1, -1} {
+				d := s * float32(k) * u
+				if k == 0 && s < 0 {
+					continue
+				}
+				if math.Abs(float64(d)) <= float64(hw) {
+					line(RulerTick, d, -hh, d, -hh-n*u)
+					if k%10 == 0 {
+						l = append(l, Label{At: shared.Point{X: d, Y: -hh - 4*u}, Text: fmt.Sprint(int(s) * k), AX: 0.5, AY: 1})
+					}
+				}
+				if math.Abs(float64(d)) <= float64(hh) {
+					line(RulerTick, -hw, d, -hw-n*u, d)
+					if k%10 == 0 {
+						l = append(l, Label{At: shared.Point{X: -hw - 4*u, Y: d}, Text: fmt.Sprint(int(s) * k), AX: 1, AY: 0.5})
+					}
+				}
+			}
+		}
+	}
+	return g, l
+}
+
+// rounded outlines a rectangle of half width hw and half height hh with corners of radius r
+func rounded(hw, hh, r float32) []Guide {
+	var pts []shared.Point
+	corners := [4][3]float32{{hw - r, hh - r, 0}, {-hw + r, hh - r, 90}, {-hw + r, -hh + r, 180}, {hw - r, -hh + r, 270}}
+	for _, c := range corners {
+		for k := 0; k <= 6; k++ {
+			a := float64(c[2]+float32(k)*15) * math.Pi / 180
+			pts = append(pts, shared.Point{X: c[0] + r*float32(math.Cos(a)), Y: c[1] + r*float32(math.Sin(a))})
+		}
+	}
+	var g []Guide
+	for k := range pts {
+		g = append(g, Guide{Kind: HoopEdge, A: pts[k], B: pts[(k+1)%len(pts)]})
+	}
+	return g
+}
+
+// overlay_bounds grows a bounding box to take in the guides and labels
+func overlay_bounds(g []Guide, l []Label, u float32, minx, miny, maxx, maxy float64) (float64, float64, float64, float64) {
+	var pts []shared.Point
+	for _, k := range g {
+		pts = append(pts, k.A, k.B)
+	}
+	for _, k := range l {
+		pts = append(pts, shared.Point{X: k.At.X - 6*u, Y: k.At.Y - 3*u}, shared.Point{X: k.At.X + 6*u, Y: k.At.Y + 3*u})
+	}
+	if len(pts) == 0 {
+		return minx, miny, maxx, maxy
+	}
+	x1, y1, x2, y2 := bounds(pts)
+	return min(minx, x1), min(miny, y1), max(maxx, x2), max(maxy, y2)
+}
+
+// Extent returns the bounds of the stitches of p and the overlays drawn under them in payload
+// units
+func Extent(p *shared.Payload, o Overlays) (minx, miny, maxx, maxy float64) {
+	minx, miny, maxx, maxy = bounds(drawn(p, false))
+	g, l := Guides(p, o)
+	return overlay_bounds(g, l, max(p.Scale, 1), minx, miny, maxx, maxy)
+}
+
+// DrawOverlays hands the guides and labels of p to a composer
+func DrawOverlays(c Composer, p *shared.Payload, o Overlays) {
+	g, l := Guides(p, o)
+	for _, k := range g {
+		c.Guide(k.A.X, k.A.Y, k.B.X, k.B.Y, k.Kind)
+	}
+	for _, k := range l {
+		c.Label(k.At.X, k.At.Y, k.Text, k.AX, k.AY)
+	}
+}
@@ -0,0 +1,193 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// Fabric is the color of the fabric when the payload has no background
+var Fabric = color.RGBA{0xf1, 0xec, 0xe2, 0xff}
+
+// RealComposer draws stitches as shaded thread on a woven fabric. It needs no display and
+// Display writes a png beside the design
+type RealComposer struct {
+	px     float32
+	py     float32
+	img    *gg.Context
+	ox     float32
+	oy     float32
+	scale  float32 // payload units per mm
+	ppu    float64 // pixels per payload unit
+	width  float64 // thread width in pixels
+	bg     color.Color
+	rnd    *rand.Rand
+	name   string
+	path   string
+	Weight int     // thread weight - 40 is the common embroidery thread
+	PPM    float64 // pixels per mm
+}
+
+// NewRealComposer is a constructor for a realistic composer. scale is the number of payload units
+// in a mm and bg the fabric color, nil for plain calico
+func NewRealComposer(scale float32, bg color.Color) *RealComposer {
+	if scale <= 0 {
+		scale = 1.0
+	}
+	if bg == nil {
+		bg = Fabric
+	}
+	return &RealComposer{
+		px:     0.0,
+		py:     0.0,
+		img:    nil,
+		ox:     0.0,
+		oy:     0.0,
+		scale:  scale,
+		ppu:    0.0,
+		bg:     bg,
+		name:   "",
+		path:   "",
+		Weight: 40,
+		PPM:    10.0,
+	}
+}
+
+// Setup makes the canvas and weaves the fabric. The same design always renders the same
+func (c *RealComposer) Setup(ox, oy float32, name string) {
+	c.ppu = c.PPM / float64(c.scale)
+	c.width = max(1, 16.0/float64(max(c.Weight, 1))*c.PPM) // 40 weight is about 0.4mm across
+	c.ox = ox
+	c.oy = oy
+	c.px = ox
+	c.py = oy
+	c.rnd = rand.New(rand.NewSource(1))
+	w := max(1, int(2.0*float64(ox)*c.ppu))
+	h := max(1, int(2.0*float64(oy)*c.ppu))
+	c.img = gg.NewContextForRGBA(weave(w, h, c.bg, c.PPM, c.rnd))
+	c.img.SetLineCap(gg.LineCapRound)
+	c.name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	c.path = filepath.Dir(name)
+}
+
+// weave makes a fabric texture - a plain weave of threads about 0.3mm apart with a little noise
+func weave(w, h int, bg color.Color, ppm float64, rnd *rand.Rand) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	r, g, b, _ := bg.RGBA()
+	period := max(2, 0.3*ppm)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			warp := math.Sin(2 * math.Pi * float64(x) / period)
+			weft := math.Sin(2 * math.Pi * float64(y) / period)
+			k := 1 + 0.05*warp*weft - 0.03*math.Abs(weft) + 0.02*(rnd.Float64()-0.5)
+			img.SetRGBA(x, y, color.RGBA{shade(r, k), shade(g, k), shade(b, k), 0xff})
+		}
+	}
+	return img
+}
+
+// shade scales a 16 bit channel and returns it as 8 bits
+func shade(v uint32, k float64) uint8 {
+	return uint8(min(255, max(0, float64(v>>8)*k)))
+}
+
+// tint moves a color towards white by k, or towards black when k is negative
+func tint(col color.Color, k float64) color.Color {
+	r, g, b, _ := col.RGBA()
+	f := func(v uint32) uint8 {
+		c := float64(v >> 8)
+		if k >= 0 {
+			return uint8(min(255, c+(255-c)*k))
+		}
+		return uint8(max(0, c*(1+k)))
+	}
+	return color.RGBA{f(r), f(g), f(b), 0xff}
+}
+
+func (c *RealComposer) SetPos(x, y float32) {
+	c.px = x + c.ox
+	c.py = y + c.oy
+}
+
+// Line draws a stitch as a capsule of thread - a soft shadow on the fabric, then the thread shaded
+// dark at the needle holes and lit along the middle. Each stitch catches the light a little
+// differently
+func (c *RealComposer) Line(ex, ey float32, col color.Color) {
+	x1 := float64(c.px) * c.ppu
+	y1 := float64(c.py) * c.ppu
+	c.px = c.ox + ex
+	c.py = c.oy + ey
+	x2 := float64(c.px) * c.ppu
+	y2 := float64(c.py) * c.ppu
+
+	off := c.width * 0.2
+	c.img.SetColor(color.RGBA{0, 0, 0, 0x40})
+	c.img.SetLineWidth(c.width * 1.1)
+	c.img.DrawLine(x1+off, y1+off, x2+off, y2+off)
+	c.img.Stroke()
+
+	thread_stroke(c.img, x1, y1, x2, y2, c.width, col, 0.25+0.2*c.rnd.Float64())
+}
+
+// thread_stroke draws a stitch as thread - dark where it goes into the fabric and lit by sheen
+// along the middle
+func thread_stroke(dc *gg.Context, x1, y1, x2, y2, width float64, col color.Color, sheen float64) {
+	if x1 == x2 && y1 == y2 {
+		dc.SetColor(col)
+	} else {
+		grad := gg.NewLinearGradient(x1, y1, x2, y2)
+		grad.AddColorStop(0, tint(col, -0.35))
+		grad.AddColorStop(0.5, tint(col, sheen))
+		grad.AddColorStop(1, tint(col, -0.35))
+		dc.SetStrokeStyle(grad)
+	}
+	dc.SetLineWidth(width)
+	dc.DrawLine(x1, y1, x2, y2)
+	dc.Stroke()
+}
+
+// Guide draws an overlay line over the fabric
+func (c *RealComposer) Guide(x1, y1, x2, y2 float32, k GuideKind) {
+	c.img.SetColor(GuideColors[k])
+	c.img.SetLineWidth(max(1, c.PPM/10))
+	c.img.DrawLine(float64(c.ox+x1)*c.ppu, float64(c.oy+y1)*c.ppu, float64(c.ox+x2)*c.ppu, float64(c.oy+y2)*c.ppu)
+	c.img.Stroke()
+}
+
+// Label writes a ruler number
+func (c *RealComposer) Label(x, y float32, text string, ax, ay float32) {
+	c.img.SetColor(GuideColors[RulerTick])
+	c.img.DrawStringAnchored(text, float64(c.ox+x)*c.ppu, float64(c.oy+y)*c.ppu, float64(ax), float64(1-ay))
+}
+
+func (c *RealComposer) Get() any {
+	return c.img.Image()
+}
+
+// Save writes the render out as a png next to the design file
+func (c *RealComposer) Save() error {
+	f, err := os.Create(filepath.Join(c.path, c.name+".png"))
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, c.img.Image())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Display saves the png, a failed write is logged to stderr
+func (c *RealComposer) Display() {
+	if err := c.Save(); err != nil {
+		log.Println(err)
+	}
+}
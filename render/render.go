@@ -0,0 +1,253 @@
+package render
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/process"
+	"github.com/fogleman/gg"
+)
+
+// RenderOptions controls Render. Width and Height fit the design inside that many pixels keeping
+// its shape - give one and the other follows. With neither the size comes from DPI
+type RenderOptions struct {
+	Width      int
+	Height     int
+	DPI        float64     // pixels per inch when no size is given
+	Padding    int         // pixels around the design
+	Background color.Color // nil for transparent
+	LineWidth  float64     // pixels
+	Antialias  bool
+	Jumps      bool        // draw jumps and trims as thin lines
+	JumpColor  color.Color // nil for grey
+	Mode       ColorMode
+	Overlays   Overlays
+	Filter     Filter // the parts of the design to draw
+}
+
+// DefaultRenderOptions returns a 96 dpi antialiased render on white with 2 pixel lines
+func DefaultRenderOptions() RenderOptions {
+	return RenderOptions{
+		DPI:        96,
+		Padding:    10,
+		Background: color.White,
+		LineWidth:  2,
+		Antialias:  true,
+	}
+}
+
+// bounds returns the extent of the needle positions
+func bounds(pts []shared.Point) (minx, miny, maxx, maxy float64) {
+	minx, miny = math.Inf(1), math.Inf(1)
+	maxx, maxy = math.Inf(-1), math.Inf(-1)
+	for _, pt := range pts {
+		minx = min(minx, float64(pt.X))
+		miny = min(miny, float64(pt.Y))
+		maxx = max(maxx, float64(pt.X))
+		maxy = max(maxy, float64(pt.Y))
+	}
+	return
+}
+
+// drawn returns the ends of every line that will be drawn, all the positions when there are none
+func drawn(p *shared.Payload, jumps bool) []shared.Point {
+	var l []shared.Point
+	Walk(p, func(s Step) bool {
+		if s.Op == shared.Stitch || jumps && (s.Op == shared.Jump || s.Op == shared.Trim) {
+			l = append(l, s.From, s.To)
+		}
+		return true
+	})
+	if len(l) == 0 {
+		return p.Positions()
+	}
+	return l
+}
+
+// fit works out the image size and the pixels per payload unit
+func fit(p *shared.Payload, w, h float64, o RenderOptions) (int, int, float64, error) {
+	pad := float64(2 * o.Padding)
+	w = max(w, 1)
+	h = max(h, 1)
+	switch {
+	case o.Width > 0 && o.Height > 0:
+		s := min((float64(o.Width)-pad)/w, (float64(o.Height)-pad)/h)
+		if s <= 0 {
+			return 0, 0, 0, errors.New("render: padding leaves no room for the design")
+		}
+		return o.Width, o.Height, s, nil
+	case o.Width > 0:
+		s := (float64(o.Width) - pad) / w
+		if s <= 0 {
+			return 0, 0, 0, errors.New("render: padding leaves no room for the design")
+		}
+		return o.Width, int(math.Ceil(h*s + pad)), s, nil
+	case o.Height > 0:
+		s := (float64(o.Height) - pad) / h
+		if s <= 0 {
+			return 0, 0, 0, errors.New("render: padding leaves no room for the design")
+		}
+		return int(math.Ceil(w*s + pad)), o.Height, s, nil
+	}
+	if o.DPI <= 0 {
+		return 0, 0, 0, errors.New("render: no size and no dpi")
+	}
+	scale := float64(p.Scale)
+	if scale <= 0 {
+		scale = 1
+	}
+	s := o.DPI / 25.4 / scale
+	return int(math.Ceil(w*s + pad)), int(math.Ceil(h*s + pad)), s, nil
+}
+
+// Render draws a payload to an image without needing a display - for batch jobs and servers
+func Render(p *shared.Payload, o RenderOptions) (image.Image, error) {
+	l, err := render(p, o, []Filter{o.Filter})
+	if err != nil {
+		return nil, err
+	}
+	return l[0], nil
+}
+
+// RenderBlocks draws each color block of a payload to its own image in one pass over the
+// commands. The images share the framing of the whole design so they line up. o.Filter still
+// picks the commands and ghosting of each image
+func RenderBlocks(p *shared.Payload, o RenderOptions) ([]image.Image, error) {
+	if p == nil || len(p.Cmds) == 0 {
+		return nil, errors.New("render: nothing to draw")
+	}
+	if len(p.Blocks) == 0 {
+		return nil, errors.New("render: no color blocks")
+	}
+	return render(p, o, BlockFilters(p, o.Filter))
+}
+
+// pen draws a line on one image
+type pen func(x1, y1, x2, y2, width float64, col color.Color)
+
+// new_pen returns a pen for img, antialiased or with square pixels
+func new_pen(img *image.RGBA, antialias bool) pen {
+	if !antialias {
+		return func(x1, y1, x2, y2, width float64, col color.Color) {
+			hard_line(img, x1, y1, x2, y2, width, col)
+		}
+	}
+	dc := gg.NewContextForRGBA(img)
+	dc.SetLineCap(gg.LineCapRound)
+	return func(x1, y1, x2, y2, width float64, col color.Color) {
+		dc.SetColor(col)
+		dc.SetLineWidth(width)
+		dc.DrawLine(x1, y1, x2, y2)
+		dc.Stroke()
+	}
+}
+
+// render draws an image for each filter walking the commands once
+func render(p *shared.Payload, o RenderOptions, filters []Filter) ([]image.Image, error) {
+	if p == nil || len(p.Cmds) == 0 {
+		return nil, errors.New("render: nothing to draw")
+	}
+	if o.LineWidth <= 0 {
+		o.LineWidth = 1
+	}
+	minx, miny, maxx, maxy := bounds(drawn(p, o.Jumps))
+	guides, labels := Guides(p, o.Overlays)
+	minx, miny, maxx, maxy = overlay_bounds(guides, labels, max(p.Scale, 1), minx, miny, maxx, maxy)
+	w, h, s, err := fit(p, maxx-minx, maxy-miny, o)
+	if err != nil {
+		return nil, err
+	}
+	// centre the design in the image
+	offx := (float64(w) - (maxx-minx)*s) / 2
+	offy := (float64(h) - (maxy-miny)*s) / 2
+	px := func(pt shared.Point) (float64, float64) {
+		return (float64(pt.X)-minx)*s + offx, (float64(pt.Y)-miny)*s + offy
+	}
+
+	imgs := make([]*image.RGBA, len(filters))
+	pens := make([]pen, len(filters))
+	for k := range filters {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		if o.Background != nil {
+			draw.Draw(img, img.Bounds(), image.NewUniform(o.Background), image.Point{}, draw.Src)
+		}
+		line := new_pen(img, o.Antialias)
+		for _, g := range guides {
+			x1, y1 := px(g.A)
+			x2, y2 := px(g.B)
+			line(x1, y1, x2, y2, 1, GuideColors[g.Kind])
+		}
+		if len(labels) > 0 {
+			dc := gg.NewContextForRGBA(img)
+			dc.SetColor(GuideColors[RulerTick])
+			for _, l := range labels {
+				x, y := px(l.At)
+				dc.DrawStringAnchored(l.Text, x, y, float64(l.AX), float64(1-l.AY))
+			}
+		}
+		imgs[k] = img
+		pens[k] = line
+	}
+	jump := o.JumpColor
+	if jump == nil {
+		jump = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	}
+	var kinds []process.Kind
+	if o.Mode == KindColors {
+		kinds = process.Kinds(p)
+	}
+
+	Walk(p, func(s Step) bool {
+		var col color.Color
+		width := o.LineWidth
+		switch s.Op {
+		case shared.Jump, shared.Trim:
+			if !o.Jumps {
+				return true
+			}
+			col = jump
+			width = max(1, o.LineWidth/2)
+		case shared.Stitch:
+			col = s.Color
+			if kinds != nil {
+				col = TypeColors[kinds[s.Index]]
+			}
+		default:
+			return true
+		}
+		x1, y1 := px(s.From)
+		x2, y2 := px(s.To)
+		for k, f := range filters {
+			if c, ok := f.Color(s, col); ok {
+				pens[k](x1, y1, x2, y2, width, c)
+			}
+		}
+		return true
+	})
+	l := make([]image.Image, len(imgs))
+	for k, img := range imgs {
+		l[k] = img
+	}
+	return l, nil
+}
+
+// hard_line draws a line with square pixels and no antialiasing
+func hard_line(img *image.RGBA, x1, y1, x2, y2, width float64, col color.Color) {
+	n := int(math.Ceil(max(math.Abs(x2-x1), math.Abs(y2-y1)))) + 1
+	half := width / 2
+	for k := 0; k <= n; k++ {
+		t := float64(k) / float64(n)
+		x := x1 + (x2-x1)*t
+		y := y1 + (y2-y1)*t
+		r := image.Rect(int(math.Round(x-half)), int(math.Round(y-half)),
+			int(math.Round(x+half)), int(math.Round(y+half)))
+		if r.Empty() {
+			r = image.Rect(int(x), int(y), int(x)+1, int(y)+1)
+		}
+		draw.Draw(img, r, image.NewUniform(col), image.Point{}, draw.Over)
+	}
+}
@@ -0,0 +1,163 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+var (
+	red   = color.RGBA{0xff, 0, 0, 0xff}
+	blue  = color.RGBA{0, 0, 0xff, 0xff}
+	green = color.RGBA{0, 0x80, 0, 0xff}
+)
+
+// sample builds a 10 unit per mm design in a 100 unit square - a red running line along the
+// top, a blue one along the bottom and a green satin column between them
+func sample() *shared.Payload {
+	p := &shared.Payload{Scale: 10}
+	var at shared.Point
+	move := func(op int, x, y float32) {
+		p.Cmds = append(p.Cmds, shared.PCommand{Command1: op, Dx: x - at.X, Dy: y - at.Y})
+		at = shared.Point{X: x, Y: y}
+	}
+	run := func(y float32) {
+		move(shared.Jump, 0, y)
+		for x := float32(10); x <= 100; x += 10 {
+			move(shared.Stitch, x, y)
+		}
+	}
+	run(0)
+	p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.ColorChg, Color: 1})
+	run(100)
+	p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.ColorChg, Color: 2})
+	move(shared.Jump, 20, 30)
+	for k := 1; k <= 40; k++ {
+		move(shared.Stitch, 20+60*float32(k%2), 30+float32(k))
+	}
+	p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.End})
+	p.SetBlocks([]shared.Thread{{Color: red}, {Color: blue}, {Color: green}})
+	return p
+}
+
+// at returns the color of a pixel
+func at(img image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
+
+// plain returns options that draw one unit to a pixel with square 3 pixel lines on white
+func plain() RenderOptions {
+	o := DefaultRenderOptions()
+	o.DPI = 254
+	o.Padding = 10
+	o.LineWidth = 3
+	o.Antialias = false
+	return o
+}
+
+func TestRenderSize(t *testing.T) {
+	p := sample()
+	for _, tc := range []struct {
+		name string
+		edit func(*RenderOptions)
+		w, h int
+	}{
+		{"dpi", func(o *RenderOptions) {}, 120, 120},
+		{"half the dpi", func(o *RenderOptions) { o.DPI = 127 }, 70, 70},
+		{"padding", func(o *RenderOptions) { o.Padding = 0 }, 100, 100},
+		{"width", func(o *RenderOptions) { o.Width = 220 }, 220, 220},
+		{"height", func(o *RenderOptions) { o.Height = 70 }, 70, 70},
+		{"both", func(o *RenderOptions) { o.Width, o.Height = 300, 100 }, 300, 100},
+	} {
+		o := plain()
+		tc.edit(&o)
+		img, err := Render(p, o)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h {
+			t.Errorf("%s: %dx%d, want %dx%d", tc.name, b.Dx(), b.Dy(), tc.w, tc.h)
+		}
+	}
+
+	for name, edit := range map[string]func(*RenderOptions){
+		"no room":   func(o *RenderOptions) { o.Width, o.Padding = 20, 10 },
+		"no height": func(o *RenderOptions) { o.Height, o.Padding = 4, 2 },
+		"no size":   func(o *RenderOptions) { o.DPI = 0 },
+	} {
+		o := plain()
+		edit(&o)
+		if _, err := Render(p, o); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestRenderEmpty(t *testing.T) {
+	for name, p := range map[string]*shared.Payload{
+		"nil":         nil,
+		"no commands": {Scale: 10},
+	} {
+		if _, err := Render(p, plain()); err == nil {
+			t.Errorf("Render %s: no error", name)
+		}
+		if _, err := RenderBlocks(p, plain()); err == nil {
+			t.Errorf("RenderBlocks %s: no error", name)
+		}
+	}
+}
+
+func TestRenderColors(t *testing.T) {
+	p := sample()
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	// pixels are the design position plus the padding
+	for _, tc := range []struct {
+		mode ColorMode
+		x, y int
+		want color.Color
+	}{
+		{ThreadColors, 60, 10, red},
+		{ThreadColors, 60, 110, blue},
+		{ThreadColors, 60, 60, green},
+		{ThreadColors, 60, 25, white}, // between the top line and the satin
+		{KindColors, 60, 10, TypeColors[0]},
+		{KindColors, 60, 110, TypeColors[0]},
+		{KindColors, 60, 60, TypeColors[1]},
+		{KindColors, 60, 25, white},
+	} {
+		o := plain()
+		o.Mode = tc.mode
+		img, err := Render(p, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := at(img, tc.x, tc.y); got != color.RGBAModel.Convert(tc.want) {
+			t.Errorf("mode %d: pixel %d,%d is %v, want %v", tc.mode, tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	// jumps are drawn in the jump color only when asked for. The jump from the end of the top
+	// line to the start of the bottom one passes 80,20
+	o := plain()
+	o.JumpColor = color.RGBA{0xff, 0, 0xff, 0xff}
+	img, _ := Render(p, o)
+	if got := at(img, 90, 30); got != white {
+		t.Errorf("jump pixel is %v when jumps are not drawn", got)
+	}
+	o.Jumps = true
+	img, _ = Render(p, o)
+	if got := at(img, 90, 30); got != o.JumpColor {
+		t.Errorf("jump pixel is %v, want %v", got, o.JumpColor)
+	}
+
+	// a transparent background is left clear
+	o = plain()
+	o.Background = nil
+	img, _ = Render(p, o)
+	if got := at(img, 60, 25); got.A != 0 {
+		t.Errorf("background pixel is %v, want clear", got)
+	}
+}
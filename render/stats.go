@@ -0,0 +1,51 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Stats counts what a design asks the machine to do
+type Stats struct {
+	Stitches int
+	Jumps    int
+	Trims    int
+	Changes  int     // color changes
+	Width    float32 // mm
+	Height   float32 // mm
+}
+
+// String summarises the stats
+func (s Stats) String() string {
+	return fmt.Sprintf("%d stitches, %d jumps, %d trims, %d color changes, %.1f x %.1f mm",
+		s.Stitches, s.Jumps, s.Trims, s.Changes, s.Width, s.Height)
+}
+
+// Statistics counts the steps of a design and measures its stitching
+func Statistics(p *shared.Payload) Stats {
+	var s Stats
+	Walk(p, func(st Step) bool {
+		switch st.Op {
+		case shared.Stitch:
+			s.Stitches++
+		case shared.Jump:
+			s.Jumps++
+		case shared.Trim:
+			s.Trims++
+		case shared.ColorChg:
+			if st.Index > 0 {
+				s.Changes++
+			}
+		}
+		return true
+	})
+	minx, miny, maxx, maxy := bounds(drawn(p, false))
+	scale := p.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	s.Width = float32(maxx-minx) / scale
+	s.Height = float32(maxy-miny) / scale
+	return s
+}
@@ -0,0 +1,193 @@
+package render
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// svg_block is one color block of the design - drawn as a single path
+type svg_block struct {
+	col color.Color
+	d   strings.Builder
+}
+
+// SvgComposer writes the stitch path out as a scalable vector graphic with real world dimensions
+type SvgComposer struct {
+	px     float32
+	py     float32
+	scale  float32 // payload units per mm
+	blocks []*svg_block
+	jumps  strings.Builder
+	guides strings.Builder
+	moved  bool // a jump happened since the last stitch
+	minx   float32
+	miny   float32
+	maxx   float32
+	maxy   float32
+	name   string
+	path   string
+}
+
+// NewSvgComposer is a constructor for an svg composer. scale is the number of payload units in a mm
+func NewSvgComposer(scale float32) *SvgComposer {
+	if scale <= 0 {
+		scale = 1.0
+	}
+	return &SvgComposer{
+		px:     0.0,
+		py:     0.0,
+		scale:  scale,
+		blocks: nil,
+		moved:  true,
+		name:   "",
+		path:   "",
+	}
+}
+
+// Setup resets the composer. Stitches are kept relative to the design centre so the offsets are not needed
+func (c *SvgComposer) Setup(ox, oy float32, name string) {
+	c.px = 0.0
+	c.py = 0.0
+	c.blocks = nil
+	c.jumps.Reset()
+	c.guides.Reset()
+	c.moved = true
+	c.minx, c.miny, c.maxx, c.maxy = 0, 0, 0, 0
+	c.name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	c.path = filepath.Dir(name)
+}
+
+// SetPos moves the needle without sewing. The move is recorded on the hidden jump layer
+func (c *SvgComposer) SetPos(x, y float32) {
+	fmt.Fprintf(&c.jumps, "M%s L%s ", svg_pt(c.px, c.py), svg_pt(x, y))
+	c.px = x
+	c.py = y
+	c.moved = true
+	c.extend(x, y)
+}
+
+// Line sews from the current position to ex, ey. A new path is started whenever the color changes
+func (c *SvgComposer) Line(ex, ey float32, col color.Color) {
+	n := len(c.blocks)
+	if n == 0 || shared.Hex(c.blocks[n-1].col) != shared.Hex(col) {
+		c.blocks = append(c.blocks, &svg_block{col: col})
+		n++
+		c.moved = true
+	}
+	b := c.blocks[n-1]
+	if c.moved {
+		fmt.Fprintf(&b.d, "M%s ", svg_pt(c.px, c.py))
+		c.moved = false
+	}
+	fmt.Fprintf(&b.d, "L%s ", svg_pt(ex, ey))
+	c.px = ex
+	c.py = ey
+	c.extend(ex, ey)
+}
+
+// Guide adds an overlay line to the guides layer
+func (c *SvgComposer) Guide(x1, y1, x2, y2 float32, k GuideKind) {
+	fmt.Fprintf(&c.guides, "    <line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke=\"%s\" stroke-width=\"%s\"/>\n",
+		svg_num(x1), svg_num(y1), svg_num(x2), svg_num(y2), shared.Hex(GuideColors[k]), svg_num(0.2*c.scale))
+	c.extend(x1, y1)
+	c.extend(x2, y2)
+}
+
+// Label adds a ruler number to the guides layer
+func (c *SvgComposer) Label(x, y float32, text string, ax, ay float32) {
+	size := 3 * c.scale // 3mm high
+	anchor := "middle"
+	switch {
+	case ax < 0.25:
+		anchor = "start"
+	case ax > 0.75:
+		anchor = "end"
+	}
+	base := y + size*(1-ay) - size*0.15 // baseline of digits sits a little above the bottom
+	fmt.Fprintf(&c.guides, "    <text x=\"%s\" y=\"%s\" font-family=\"sans-serif\" font-size=\"%s\" text-anchor=\"%s\" fill=\"%s\">%s</text>\n",
+		svg_num(x), svg_num(base), svg_num(size), anchor, shared.Hex(GuideColors[RulerTick]), xml_escape(text))
+	w := float32(len(text)) * size * 0.6
+	c.extend(x-w*ax, y-size*ay)
+	c.extend(x+w*(1-ax), y+size*(1-ay))
+}
+
+// extend grows the bounding box of the design to include x, y
+func (c *SvgComposer) extend(x, y float32) {
+	c.minx = min(c.minx, x)
+	c.miny = min(c.miny, y)
+	c.maxx = max(c.maxx, x)
+	c.maxy = max(c.maxy, y)
+}
+
+// Get returns the svg document as a string
+func (c *SvgComposer) Get() any {
+	var sb strings.Builder
+	w := c.maxx - c.minx
+	h := c.maxy - c.miny
+	thread := 0.4 * c.scale // 40 weight thread is roughly 0.4mm across
+
+	sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\" ")
+	fmt.Fprintf(&sb, "width=\"%.2fmm\" height=\"%.2fmm\" viewBox=\"%s %s %s %s\">\n",
+		w/c.scale, h/c.scale, svg_num(c.minx), svg_num(c.miny), svg_num(w), svg_num(h))
+	fmt.Fprintf(&sb, "  <title>%s</title>\n", xml_escape(c.name))
+
+	// guides sit under everything on their own layer
+	if c.guides.Len() > 0 {
+		sb.WriteString("  <g id=\"guides\" inkscape:groupmode=\"layer\" inkscape:label=\"Guides\">\n")
+		sb.WriteString(c.guides.String())
+		sb.WriteString("  </g>\n")
+	}
+
+	// jumps live on their own layer, hidden by default
+	sb.WriteString("  <g id=\"jumps\" inkscape:groupmode=\"layer\" inkscape:label=\"Jumps\" style=\"display:none\">\n")
+	if c.jumps.Len() > 0 {
+		fmt.Fprintf(&sb, "    <path d=\"%s\" fill=\"none\" stroke=\"#808080\" stroke-width=\"%s\" stroke-dasharray=\"%s\"/>\n",
+			strings.TrimSpace(c.jumps.String()), svg_num(thread/2), svg_num(thread*2))
+	}
+	sb.WriteString("  </g>\n")
+
+	sb.WriteString("  <g id=\"stitches\" inkscape:groupmode=\"layer\" inkscape:label=\"Stitches\">\n")
+	for i, b := range c.blocks {
+		fmt.Fprintf(&sb, "    <path id=\"block%d\" d=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"%s\" stroke-linecap=\"round\" stroke-linejoin=\"round\"/>\n",
+			i+1, strings.TrimSpace(b.d.String()), shared.Hex(b.col), svg_num(thread))
+	}
+	sb.WriteString("  </g>\n")
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// Save writes the svg out next to the design file
+func (c *SvgComposer) Save() error {
+	file := filepath.Join(c.path, c.name+".svg")
+	return os.WriteFile(file, []byte(c.Get().(string)), 0644)
+}
+
+// Display saves the svg, a failed write is logged to stderr
+func (c *SvgComposer) Display() {
+	if err := c.Save(); err != nil {
+		log.Println(err)
+	}
+}
+
+// svg_num formats a coordinate compactly
+func svg_num(f float32) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", f), "0"), ".")
+}
+
+// svg_pt formats a point for a path
+func svg_pt(x, y float32) string {
+	return svg_num(x) + "," + svg_num(y)
+}
+
+// xml_escape makes a string safe to put into an xml element
+func xml_escape(s string) string {
+	r := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+	return r.Replace(s)
+}
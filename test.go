@@ -24,9 +24,9 @@ func main() {
 	file_type := strings.ToLower(filepath.Ext(file))
 	switch file_type {
 	case ".pes":
-		pay = pes_pec.Read_pes(file)
+		pay = pes_pec.Read_pes(file, pes_pec.DefaultReadOptions())
 	case ".jef":
-		pay = jef.Read_jef(file)
+		pay = jef.Read_jef(file, jef.DefaultReadOptions())
 	}
 
 	render := engine.NewEngine(file)
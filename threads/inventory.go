@@ -0,0 +1,228 @@
+package threads
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/emblib/adapters/shared"
+	"github.com/emblib/process"
+)
+
+// Stock is a thread on the shelf
+type Stock struct {
+	Thread
+	Cones int
+}
+
+// Inventory is the threads in stock
+type Inventory struct {
+	Items []Stock
+}
+
+// Merge proposes sewing color blocks that ended up on the same thread one after the other. Only
+// blocks that were different threads in the design are proposed, and only when no block sewn
+// between them overlaps them
+type Merge struct {
+	Thread   Thread
+	Blocks   []int // color blocks in sewing order, 0 based
+	Adjacent bool  // the blocks already follow each other so the color changes are simply redundant
+}
+
+// Pick is one line of the pick list
+type Pick struct {
+	Thread   Thread
+	Blocks   []int
+	Stitches int
+	Cones    int
+}
+
+// Plan is the result of fitting a design to the inventory
+type Plan struct {
+	Subs   []Substitution // one per block
+	Merges []Merge
+	Picks  []Pick // in order of first use
+}
+
+/*
+**
+** Loading
+**
+ */
+
+// LoadInventory reads an inventory file
+func (c *Catalogue) LoadInventory(path string) (*Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	inv, err := c.ReadInventory(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return inv, nil
+}
+
+// ReadInventory reads brand,code,cones rows with an optional header. Codes are looked up in the
+// catalogue to find their colors and threads with no cones are left out
+func (c *Catalogue) ReadInventory(r io.Reader) (*Inventory, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 3
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	for i, row := range rows {
+		if i == 0 && strings.EqualFold(row[0], "brand") {
+			continue // header
+		}
+		cones, err := strconv.Atoi(strings.TrimSpace(row[2]))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: bad cone count %q", i+1, row[2])
+		}
+		if cones <= 0 {
+			continue
+		}
+		t := c.Code(row[0], row[1])
+		if len(t) == 0 {
+			return nil, fmt.Errorf("row %d: no %s thread %s in the catalogue", i+1, row[0], row[1])
+		}
+		inv.Items = append(inv.Items, Stock{Thread: t[0], Cones: cones})
+	}
+	return &inv, nil
+}
+
+/*
+**
+** Fitting a design to the inventory
+**
+ */
+
+// block_stitches counts the stitches of a block
+func block_stitches(p *shared.Payload, b int) int {
+	n := 0
+	blk := p.Blocks[b]
+	for _, c := range p.Cmds[blk.Start:blk.End] {
+		if c.Command1 == shared.Stitch {
+			n++
+		}
+	}
+	return n
+}
+
+// Fit replaces the thread of every block of p with the nearest thread in stock and plans the
+// job - the substitutions, the blocks that could be merged and the pick list
+func (inv *Inventory) Fit(p *shared.Payload) *Plan {
+	var plan Plan
+	if len(inv.Items) == 0 {
+		return &plan
+	}
+	stock := Chart{Name: "Inventory"}
+	cones := make(map[Thread]int)
+	for _, s := range inv.Items {
+		stock.Threads = append(stock.Threads, s.Thread)
+		cones[s.Thread] += s.Cones
+	}
+	plan.Subs = ConvertPalette(p, &stock)
+
+	// follow the blocks in sewing order
+	var order []Thread
+	used := make(map[Thread][]int)
+	for b, blk := range p.Blocks {
+		t := blk.Thread
+		if used[t] == nil {
+			order = append(order, t)
+		}
+		used[t] = append(used[t], b)
+	}
+	before := process.Overlaps(p, process.DefaultBlockOptions().Cell)
+	for _, t := range order {
+		pick := Pick{Thread: t, Blocks: used[t], Cones: cones[t]}
+		for _, b := range used[t] {
+			pick.Stitches += block_stitches(p, b)
+		}
+		plan.Picks = append(plan.Picks, pick)
+		plan.Merges = append(plan.Merges, merges(t, used[t], plan.Subs, before)...)
+	}
+	return &plan
+}
+
+// merges groups the blocks on thread t that can be sewn together. A block joins the group before
+// it unless a block sewn in between overlaps it, and groups that were already one thread in the
+// design are left out
+func merges(t Thread, blocks []int, subs []Substitution, before [][]int) []Merge {
+	var l []Merge
+	flush := func(g []int) {
+		if len(g) < 2 {
+			return
+		}
+		collapsed := false
+		adj := true
+		for i := 1; i < len(g); i++ {
+			collapsed = collapsed || subs[g[i]].From != subs[g[0]].From
+			adj = adj && g[i] == g[i-1]+1
+		}
+		if collapsed {
+			l = append(l, Merge{Thread: t, Blocks: g, Adjacent: adj})
+		}
+	}
+	var g []int
+	for _, b := range blocks {
+		if len(g) > 0 && slices.ContainsFunc(before[b], func(k int) bool { return k > g[len(g)-1] }) {
+			flush(g)
+			g = nil
+		}
+		g = append(g, b)
+	}
+	flush(g)
+	return l
+}
+
+// block_list writes 0 based blocks as a 1 based list for people
+func block_list(blocks []int) string {
+	var l []string
+	for _, b := range blocks {
+		l = append(l, strconv.Itoa(b+1))
+	}
+	return strings.Join(l, ",")
+}
+
+// WritePickList writes the threads to fetch in the order they are sewn, followed by poor
+// matches and merge proposals
+func (pl *Plan) WritePickList(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tBrand\tCode\tName\tColor\tBlocks\tStitches\tCones")
+	for i, p := range pl.Picks {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", i+1, p.Thread.Brand, p.Thread.Code,
+			p.Thread.Name, shared.Hex(p.Thread.Color), block_list(p.Blocks), p.Stitches, p.Cones)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	for _, s := range pl.Subs {
+		if s.DeltaE > Poor {
+			fmt.Fprintf(w, "check: %s\n", s)
+		}
+	}
+	for _, m := range pl.Merges {
+		how := "sew together to save"
+		if m.Adjacent {
+			how = "already consecutive - drop"
+		}
+		_, err = fmt.Fprintf(w, "merge: blocks %s use %s %s - %s %d color changes\n",
+			block_list(m.Blocks), m.Thread.Code, m.Thread.Name, how, len(m.Blocks)-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
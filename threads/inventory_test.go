@@ -0,0 +1,122 @@
+package threads
+
+import (
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// rows makes a design with a block of a 10mm row of stitches at each y, in units of 0.1mm
+func rows(cols []color.RGBA, ys []float32) *shared.Payload {
+	p := &shared.Payload{Scale: 10}
+	var at shared.Point
+	var threads []Thread
+	for k, y := range ys {
+		if k > 0 {
+			p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.ColorChg})
+		}
+		p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.Jump, Dx: -at.X, Dy: y - at.Y})
+		for x := float32(10); x <= 100; x += 10 {
+			p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.Stitch, Dx: 10})
+		}
+		at = shared.Point{X: 100, Y: y}
+		threads = append(threads, Thread{Color: cols[k]})
+	}
+	p.Cmds = append(p.Cmds, shared.PCommand{Command1: shared.End})
+	p.SetBlocks(threads)
+	return p
+}
+
+func stock(t *testing.T) *Inventory {
+	inv, err := NewCatalogue().ReadInventory(strings.NewReader(
+		"brand,code,cones\nIsacord,1902,2\nIsacord,3543,1\nIsacord,5510,1\nIsacord,0020,0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+func TestReadInventory(t *testing.T) {
+	inv := stock(t)
+	var got []string
+	for _, s := range inv.Items {
+		got = append(got, s.Code+" "+s.Name)
+	}
+	// black has no cones
+	if want := []string{"1902 Poinsettia", "3543 Royal Blue", "5510 Emerald"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, in := range []string{"Isacord,9999,1\n", "Isacord,1902,lots\n", "Isacord,1902\n"} {
+		if _, err := NewCatalogue().ReadInventory(strings.NewReader(in)); err == nil {
+			t.Errorf("%q read", in)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	p := rows(
+		[]color.RGBA{red, blue, {240, 10, 10, 255}, {10, 10, 240, 255}, blue, green, green},
+		// block 3 is sewn over block 2
+		[]float32{0, 100, 200, 200, 300, 400, 500},
+	)
+	plan := stock(t).Fit(p)
+
+	if len(plan.Subs) != 7 {
+		t.Fatalf("%d substitutions", len(plan.Subs))
+	}
+	var codes []string
+	for _, b := range p.Blocks {
+		codes = append(codes, b.Thread.Code)
+	}
+	if want := []string{"1902", "3543", "1902", "3543", "3543", "5510", "5510"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("blocks sewn with %v, want %v", codes, want)
+	}
+
+	var picks [][]int
+	for _, pk := range plan.Picks {
+		picks = append(picks, pk.Blocks)
+	}
+	if want := [][]int{{0, 2}, {1, 3, 4}, {5, 6}}; !reflect.DeepEqual(picks, want) {
+		t.Errorf("picks %v, want %v", picks, want)
+	}
+	if pk := plan.Picks[0]; pk.Stitches != 20 || pk.Cones != 2 {
+		t.Errorf("red pick has %d stitches and %d cones", pk.Stitches, pk.Cones)
+	}
+
+	// red 0 and 2 can come together. Blue 1 cannot move past red 2 to join 3 as 3 lies on top
+	// of 2, but 3 and 4 were different blues. The greens were one thread all along
+	var got []Merge
+	for _, m := range plan.Merges {
+		got = append(got, Merge{Blocks: m.Blocks, Adjacent: m.Adjacent})
+	}
+	if want := []Merge{{Blocks: []int{0, 2}}, {Blocks: []int{3, 4}, Adjacent: true}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merges %+v, want %+v", got, want)
+	}
+
+	var b strings.Builder
+	if err := plan.WritePickList(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Poinsettia", "merge: blocks 1,3", "merge: blocks 4,5", "already consecutive"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("pick list has no %q:\n%s", s, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "blocks 6,7") {
+		t.Errorf("pick list merges the greens:\n%s", b.String())
+	}
+}
+
+func TestFitEmpty(t *testing.T) {
+	p := rows([]color.RGBA{{255, 0, 0, 255}}, []float32{0})
+	plan := (&Inventory{}).Fit(p)
+	if plan.Subs != nil || plan.Picks != nil || p.Blocks[0].Thread.Code != "" {
+		t.Errorf("empty inventory changed the design: %+v", plan)
+	}
+}
@@ -0,0 +1,63 @@
+package threads
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/emblib/adapters/shared"
+)
+
+// Poor is the ΔE2000 above which a substituted thread is visibly a different color
+const Poor = 5.0
+
+// Substitution records the thread of a block replaced by a chart thread
+type Substitution struct {
+	Index  int // block index
+	From   Thread
+	To     Thread
+	DeltaE float64
+}
+
+// String describes the substitution, flagging poor matches
+func (s Substitution) String() string {
+	flag := ""
+	if s.DeltaE > Poor {
+		flag = " poor match"
+	}
+	return fmt.Sprintf("%d: %s -> %s %s %s (%s) ΔE %.1f%s", s.Index, shared.Hex(s.From.Color),
+		s.To.Chart, s.To.Code, s.To.Name, shared.Hex(s.To.Color), s.DeltaE, flag)
+}
+
+// Nearest finds the thread perceptually closest to c and the ΔE2000 between them
+func (ch *Chart) Nearest(c color.Color) (Thread, float64) {
+	lab := shared.ToLab(c)
+	best := -1
+	var dist float64
+	for i, t := range ch.Threads {
+		d := shared.DeltaE2000(lab, shared.ToLab(t.Color))
+		if best < 0 || d < dist {
+			best = i
+			dist = d
+		}
+	}
+	if best < 0 {
+		return Thread{}, 0
+	}
+	return ch.Threads[best], dist
+}
+
+// ConvertPalette replaces the thread of every block of p with the nearest thread of ch and
+// reports each substitution
+func ConvertPalette(p *shared.Payload, ch *Chart) []Substitution {
+	if len(ch.Threads) == 0 {
+		return nil
+	}
+	subs := make([]Substitution, len(p.Blocks))
+	for i := range p.Blocks {
+		from := p.Blocks[i].Thread
+		t, d := ch.Nearest(from.Color)
+		subs[i] = Substitution{Index: i, From: from, To: t, DeltaE: d}
+		p.Blocks[i].Thread = t
+	}
+	return subs
+}
@@ -0,0 +1,50 @@
+package threads
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/emblib/adapters/shared"
+)
+
+func TestNearest(t *testing.T) {
+	ch := NewCatalogue().Chart("Isacord 40")
+	if ch == nil {
+		t.Fatal("no Isacord 40 chart")
+	}
+	for _, tc := range []struct {
+		col  color.Color
+		code string
+		max  float64
+	}{
+		{color.RGBA{0x1c, 0x3f, 0x94, 255}, "3543", 0}, // exactly Royal Blue
+		{color.RGBA{0x1e, 0x40, 0x90, 255}, "3543", 2}, // a touch off it
+		{color.RGBA{0xb5, 0x12, 0x1b, 255}, "1902", 0}, // Poinsettia
+		{color.RGBA{0x02, 0x02, 0x02, 255}, "0020", 2}, // near black
+		{color.RGBA{0x00, 0x9a, 0x49, 255}, "5510", 0}, // Emerald
+	} {
+		th, d := ch.Nearest(tc.col)
+		if th.Code != tc.code || d > tc.max+1e-9 {
+			t.Errorf("%s: nearest %s %s ΔE %.2f, want %s within %g", shared.Hex(tc.col), th.Code, th.Name, d, tc.code, tc.max)
+		}
+	}
+	if th, d := (&Chart{}).Nearest(color.Black); th != (Thread{}) || d != 0 {
+		t.Errorf("empty chart gave %+v %g", th, d)
+	}
+}
+
+func TestConvertPalette(t *testing.T) {
+	ch := NewCatalogue().Chart("Isacord 40")
+	p := &shared.Payload{}
+	p.Blocks = []shared.Block{
+		{Thread: Thread{Color: color.RGBA{0xff, 0xe3, 0x00, 255}}},
+		{Thread: Thread{Color: color.RGBA{0x40, 0xff, 0xff, 255}}},
+	}
+	subs := ConvertPalette(p, ch)
+	if len(subs) != 2 || subs[0].To.Code != "0700" || p.Blocks[0].Thread.Code != "0700" || subs[0].DeltaE > 1e-9 {
+		t.Fatalf("substitutions %v", subs)
+	}
+	if subs[1].DeltaE <= Poor || p.Blocks[1].Thread.Chart != "Isacord 40" {
+		t.Errorf("cyan matched %s at ΔE %.1f, want a poor match", subs[1].To.Name, subs[1].DeltaE)
+	}
+}
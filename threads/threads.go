@@ -0,0 +1,288 @@
+/*
+** threads
+** named thread charts - Brother and Janome as used by the pes and jef adapters plus the common
+** commercial catalogues. Charts are embedded csv files and users can add their own at runtime
+**
+** csv charts have the columns brand,chart,code,name,hex with a header row. Lines starting with
+** # are comments and a file may hold more than one chart
+** json charts are {"brand": string, "chart": string, "threads": [{"code": string, "name": string, "hex": "#rrggbb"}]}
+ */
+
+package threads
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emblib/adapters/shared"
+)
+
+//go:embed charts/*.csv
+var embedded embed.FS
+
+// Thread is a single thread of a chart - the same type that describes payload blocks
+type Thread = shared.Thread
+
+// Chart is a named list of threads from one brand
+type Chart struct {
+	Name    string
+	Brand   string
+	Threads []Thread
+	codes   map[string]int
+}
+
+// Catalogue holds all the charts we know about
+type Catalogue struct {
+	charts []*Chart
+}
+
+// norm_code makes codes comparable - 0015 and 15 are the same thread
+func norm_code(code string) string {
+	c := strings.TrimLeft(strings.TrimSpace(code), "0")
+	if c == "" && code != "" {
+		return "0"
+	}
+	return strings.ToLower(c)
+}
+
+// parse_hex reads a #rrggbb color
+func parse_hex(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil || len(h) != 6 {
+		return color.RGBA{}, fmt.Errorf("bad color %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+/*
+**
+** Charts
+**
+ */
+
+// add appends a thread keeping the code index up to date
+func (ch *Chart) add(t Thread) {
+	if ch.codes == nil {
+		ch.codes = make(map[string]int)
+	}
+	t.Brand = ch.Brand
+	t.Chart = ch.Name
+	ch.Threads = append(ch.Threads, t)
+	ch.codes[norm_code(t.Code)] = len(ch.Threads) - 1
+}
+
+// Code finds a thread by its catalogue code
+func (ch *Chart) Code(code string) (Thread, bool) {
+	i, ok := ch.codes[norm_code(code)]
+	if !ok {
+		return Thread{}, false
+	}
+	return ch.Threads[i], true
+}
+
+// Colors returns the chart as a palette in chart order
+func (ch *Chart) Colors() []color.Color {
+	cols := make([]color.Color, len(ch.Threads))
+	for i, t := range ch.Threads {
+		cols[i] = t.Color
+	}
+	return cols
+}
+
+/*
+**
+** Catalogue
+**
+ */
+
+// builtin parses the embedded charts the first time they are needed. The charts are shared by
+// every catalogue and never changed
+var builtin = sync.OnceValue(func() *Catalogue {
+	var c Catalogue
+	files, err := fs.Glob(embedded, "charts/*.csv")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		r, err := embedded.Open(f)
+		if err != nil {
+			panic(err)
+		}
+		err = c.read_csv(r)
+		r.Close()
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", f, err))
+		}
+	}
+	return &c
+})
+
+// NewCatalogue returns a catalogue holding the built in charts. Charts added to it are its own
+func NewCatalogue() *Catalogue {
+	return &Catalogue{charts: slices.Clone(builtin().charts)}
+}
+
+// Builtin finds a built in chart by name ignoring case. The chart is shared so must not be changed
+func Builtin(name string) *Chart {
+	return builtin().Chart(name)
+}
+
+// Charts returns every chart in the order they were added
+func (c *Catalogue) Charts() []*Chart {
+	return c.charts
+}
+
+// Chart finds a chart by name ignoring case
+func (c *Catalogue) Chart(name string) *Chart {
+	for _, ch := range c.charts {
+		if strings.EqualFold(ch.Name, name) {
+			return ch
+		}
+	}
+	return nil
+}
+
+// Brand returns the charts of a brand ignoring case
+func (c *Catalogue) Brand(brand string) []*Chart {
+	var l []*Chart
+	for _, ch := range c.charts {
+		if strings.EqualFold(ch.Brand, brand) {
+			l = append(l, ch)
+		}
+	}
+	return l
+}
+
+// Code finds the threads of a brand with the given code - one per chart of that brand
+func (c *Catalogue) Code(brand, code string) []Thread {
+	var l []Thread
+	for _, ch := range c.Brand(brand) {
+		if t, ok := ch.Code(code); ok {
+			l = append(l, t)
+		}
+	}
+	return l
+}
+
+// Name finds threads whose name contains name ignoring case
+func (c *Catalogue) Name(name string) []Thread {
+	var l []Thread
+	name = strings.ToLower(name)
+	for _, ch := range c.charts {
+		for _, t := range ch.Threads {
+			if strings.Contains(strings.ToLower(t.Name), name) {
+				l = append(l, t)
+			}
+		}
+	}
+	return l
+}
+
+// Add adds a chart, replacing any chart with the same name
+func (c *Catalogue) Add(ch *Chart) {
+	for i := range c.charts {
+		if strings.EqualFold(c.charts[i].Name, ch.Name) {
+			c.charts[i] = ch
+			return
+		}
+	}
+	c.charts = append(c.charts, ch)
+}
+
+// Load adds the charts in a csv or json file
+func (c *Catalogue) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = c.read_csv(f)
+	case ".json":
+		err = c.read_json(f)
+	default:
+		err = fmt.Errorf("unknown chart format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// read_csv reads brand,chart,code,name,hex rows. Consecutive rows of the same chart are collected
+func (c *Catalogue) read_csv(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 5
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return err
+	}
+	var ch *Chart
+	for i, row := range rows {
+		if i == 0 && strings.EqualFold(row[0], "brand") {
+			continue // header
+		}
+		col, err := parse_hex(row[4])
+		if err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if ch == nil || ch.Name != row[1] {
+			if ch != nil {
+				c.Add(ch)
+			}
+			ch = &Chart{Name: row[1], Brand: row[0]}
+		}
+		ch.add(Thread{Code: row[2], Name: row[3], Color: col})
+	}
+	if ch != nil {
+		c.Add(ch)
+	}
+	return nil
+}
+
+// json_chart is the layout of a json chart file
+type json_chart struct {
+	Brand   string `json:"brand"`
+	Chart   string `json:"chart"`
+	Threads []struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+		Hex  string `json:"hex"`
+	} `json:"threads"`
+}
+
+// read_json reads a single chart
+func (c *Catalogue) read_json(r io.Reader) error {
+	var doc json_chart
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return err
+	}
+	if doc.Chart == "" {
+		return fmt.Errorf("chart has no name")
+	}
+	ch := &Chart{Name: doc.Chart, Brand: doc.Brand}
+	for _, t := range doc.Threads {
+		col, err := parse_hex(t.Hex)
+		if err != nil {
+			return fmt.Errorf("thread %s: %w", t.Code, err)
+		}
+		ch.add(Thread{Code: t.Code, Name: t.Name, Color: col})
+	}
+	c.Add(ch)
+	return nil
+}
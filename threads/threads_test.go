@@ -0,0 +1,126 @@
+package threads
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinCharts(t *testing.T) {
+	c := NewCatalogue()
+	for _, tc := range []struct{ chart, brand string }{
+		{"Brother", "Brother"}, {"Janome", "Janome"}, {"Isacord 40", "Isacord"},
+		{"Polyneon 40", "Madeira"}, {"Robison-Anton Poly 40", "Robison-Anton"},
+		{"Sulky Rayon 40", "Sulky"}, {"Gunold Poly 40", "Gunold"},
+	} {
+		ch := c.Chart(tc.chart)
+		if ch == nil {
+			t.Errorf("no %s chart", tc.chart)
+			continue
+		}
+		if ch.Brand != tc.brand || len(ch.Threads) == 0 {
+			t.Errorf("%s: brand %q with %d threads", tc.chart, ch.Brand, len(ch.Threads))
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c := NewCatalogue()
+	isacord := c.Chart("isacord 40")
+	if isacord == nil {
+		t.Fatal("no Isacord 40 chart")
+	}
+	// codes match with or without their leading zeros
+	for _, code := range []string{"0020", "20"} {
+		th, ok := isacord.Code(code)
+		if !ok || th.Name != "Black" || th.Brand != "Isacord" || th.Chart != "Isacord 40" {
+			t.Errorf("code %s: %+v %v", code, th, ok)
+		}
+	}
+	if _, ok := isacord.Code("9999"); ok {
+		t.Error("found code 9999")
+	}
+	if l := c.Code("ISACORD", "3543"); len(l) != 1 || l[0].Name != "Royal Blue" {
+		t.Errorf("Code(ISACORD, 3543) = %+v", l)
+	}
+	if l := c.Code("Nobody", "1"); l != nil {
+		t.Errorf("Code(Nobody, 1) = %+v", l)
+	}
+	if l := c.Brand("madeira"); len(l) != 1 || l[0].Name != "Polyneon 40" {
+		t.Errorf("Brand(madeira) = %v charts", len(l))
+	}
+	found := false
+	for _, th := range c.Name("silky") {
+		if th.Chart == "Isacord 40" && th.Code == "0010" {
+			found = true
+		}
+		if th.Name == "" {
+			t.Errorf("Name(silky) gave %+v", th)
+		}
+	}
+	if !found {
+		t.Error("Name(silky) did not find Isacord Silky White")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	csv := filepath.Join(dir, "mine.csv")
+	err := os.WriteFile(csv, []byte("# my threads\nbrand,chart,code,name,hex\n"+
+		"Mine,Mine A,1,Red,#ff0000\nMine,Mine A,2,Blue,#0000ff\nMine,Mine B,1,Green,#00ff00\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js := filepath.Join(dir, "isacord.json")
+	err = os.WriteFile(js, []byte(`{"brand": "Isacord", "chart": "Isacord 40",
+		"threads": [{"code": "0015", "name": "Snow", "hex": "#fefefe"}]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCatalogue()
+	n := len(c.Charts())
+	if err := c.Load(csv); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Charts()) != n+2 {
+		t.Fatalf("%d charts after loading two, want %d", len(c.Charts()), n+2)
+	}
+	if th, ok := c.Chart("Mine A").Code("2"); !ok || th.Color != (color.RGBA{0, 0, 255, 255}) || th.Brand != "Mine" {
+		t.Errorf("Mine A 2 = %+v %v", th, ok)
+	}
+	if len(c.Chart("Mine B").Threads) != 1 {
+		t.Errorf("Mine B has %d threads", len(c.Chart("Mine B").Threads))
+	}
+
+	// a loaded chart replaces the built in one of the same name in this catalogue only
+	if err := c.Load(js); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Charts()) != n+2 || len(c.Chart("Isacord 40").Threads) != 1 {
+		t.Errorf("json chart did not replace Isacord 40")
+	}
+	if th, _ := NewCatalogue().Chart("Isacord 40").Code("15"); th.Name != "White" {
+		t.Errorf("built in chart changed: %+v", th)
+	}
+
+	for name, body := range map[string]string{
+		"short.csv": "brand,chart,code,name,hex\nMine,Mine,1,Red\n",
+		"hex.csv":   "brand,chart,code,name,hex\nMine,Mine,1,Red,#ff00\n",
+		"anon.json": `{"brand": "Mine", "threads": []}`,
+		"bad.json":  `{"brand":`,
+		"chart.txt": "Mine,Mine,1,Red,#ff0000\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Load(path); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if err := c.Load(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Error("missing file: no error")
+	}
+}